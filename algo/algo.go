@@ -0,0 +1,474 @@
+// Package algo executes large orders as a series of smaller child orders: iceberg,
+// TWAP and VWAP slicing, and limit orders chasing the best bid or ask.
+//
+// Fills are tracked by polling the order book of the broker, so the algos work the
+// same against a Client, a paper.Engine or a risk.Gate.
+package algo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/orderbook"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+// Default interval between polls of the order book.
+const DEFAULT_POLL_INTERVAL = time.Second
+
+var (
+	ErrInvalidParams      = fmt.Errorf("invalid algo params")
+	ErrChildOrderRejected = fmt.Errorf("child order rejected")
+	ErrChildOrderCanceled = fmt.Errorf("child order cancelled outside the algo")
+	ErrNoQuote            = fmt.Errorf("no best bid or ask to price the order")
+)
+
+// Progress is the state of an execution.
+type Progress struct {
+	Quantity     int
+	Filled       int
+	AveragePrice float64
+	// Child orders placed so far, oldest first.
+	OrderIDs []string
+}
+
+// Remaining returns the quantity not filled yet.
+func (p Progress) Remaining() int {
+	return p.Quantity - p.Filled
+}
+
+type kind int
+
+const (
+	iceberg kind = iota
+	schedule
+	chase
+)
+
+// Algo executes the quantity of an order as child orders. Create one with NewIceberg,
+// NewTWAP, NewVWAP or NewLimitChaser and execute it with Run.
+type Algo struct {
+	broker        smartapigo.Broker
+	params        smartapigo.OrderParams
+	kind          kind
+	sliceQuantity int
+	window        time.Duration
+	weights       []float64
+	books         *orderbook.Books
+	priceLimit    float64
+	pollInterval  time.Duration
+	onProgress    func(progress Progress)
+	progress      Progress
+	children      map[string]child
+	mutex         sync.Mutex
+}
+
+// child is the fill of a child order.
+type child struct {
+	filled       int
+	averagePrice float64
+}
+
+func newAlgo(broker smartapigo.Broker, params smartapigo.OrderParams, kind kind) *Algo {
+	quantity, _ := strconv.Atoi(params.Quantity)
+	return &Algo{
+		broker:       broker,
+		params:       params,
+		kind:         kind,
+		pollInterval: DEFAULT_POLL_INTERVAL,
+		progress:     Progress{Quantity: quantity},
+		children:     make(map[string]child),
+	}
+}
+
+// NewIceberg creates an algo placing the quantity of params as child orders of at
+// most sliceQuantity, such as the freeze quantity of the instrument, each placed once
+// the previous one is filled.
+func NewIceberg(broker smartapigo.Broker, params smartapigo.OrderParams, sliceQuantity int) *Algo {
+	a := newAlgo(broker, params, iceberg)
+	a.sliceQuantity = sliceQuantity
+	return a
+}
+
+// NewTWAP creates an algo placing the quantity of params as slices of equal size spread
+// evenly over window. A slice still open when the next one is due is cancelled and
+// its unfilled quantity added to the next slice.
+func NewTWAP(broker smartapigo.Broker, params smartapigo.OrderParams, slices int, window time.Duration) *Algo {
+	weights := make([]float64, slices)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return NewVWAP(broker, params, window, weights)
+}
+
+// NewVWAP creates an algo like NewTWAP, with slice sizes proportional to a volume
+// profile, such as the volume traded in each bucket of window on previous days.
+func NewVWAP(broker smartapigo.Broker, params smartapigo.OrderParams, window time.Duration, profile []float64) *Algo {
+	a := newAlgo(broker, params, schedule)
+	a.window = window
+	a.weights = profile
+	return a
+}
+
+// NewLimitChaser creates an algo placing the quantity of params as a limit order at
+// the best bid for buys or the best ask for sells, as reported by books, and modifying
+// it whenever the best price moves until it is filled.
+func NewLimitChaser(broker smartapigo.Broker, books *orderbook.Books, params smartapigo.OrderParams) *Algo {
+	a := newAlgo(broker, params, chase)
+	a.books = books
+	a.params.OrderType = smartapigo.OrderTypeLimit
+	return a
+}
+
+// SetPollInterval sets the interval between polls of the order book.
+func (a *Algo) SetPollInterval(interval time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.pollInterval = interval
+}
+
+// SetPriceLimit stops a limit chaser from buying above or selling below price.
+func (a *Algo) SetPriceLimit(price float64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.priceLimit = price
+}
+
+// OnProgress callback, called whenever a child order is placed or filled.
+func (a *Algo) OnProgress(f func(progress Progress)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.onProgress = f
+}
+
+// Progress returns the current state of the execution.
+func (a *Algo) Progress() Progress {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	progress := a.progress
+	progress.OrderIDs = append([]string(nil), a.progress.OrderIDs...)
+	return progress
+}
+
+// Run executes the algo until the quantity is filled, a child order fails or ctx is
+// done. Cancelling ctx cancels the open child order, the progress then tells the
+// quantity filled so far.
+func (a *Algo) Run(ctx context.Context) (Progress, error) {
+	var err error
+	if a.progress.Quantity <= 0 {
+		err = fmt.Errorf("%w: quantity %q", ErrInvalidParams, a.params.Quantity)
+	} else {
+		switch a.kind {
+		case iceberg:
+			err = a.runIceberg(ctx)
+		case schedule:
+			err = a.runSchedule(ctx)
+		case chase:
+			err = a.runChase(ctx)
+		}
+	}
+	return a.Progress(), err
+}
+
+func (a *Algo) runIceberg(ctx context.Context) error {
+	if a.sliceQuantity <= 0 {
+		return fmt.Errorf("%w: slice quantity %d", ErrInvalidParams, a.sliceQuantity)
+	}
+	for a.Progress().Remaining() > 0 {
+		quantity := a.Progress().Remaining()
+		if quantity > a.sliceQuantity {
+			quantity = a.sliceQuantity
+		}
+		id, err := a.place(quantity, a.params.Price)
+		if err != nil {
+			return err
+		}
+		if err := a.wait(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Algo) runSchedule(ctx context.Context) error {
+	if len(a.weights) == 0 {
+		return fmt.Errorf("%w: no slices", ErrInvalidParams)
+	}
+	var total float64
+	for _, weight := range a.weights {
+		total += weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("%w: empty volume profile", ErrInvalidParams)
+	}
+
+	start := time.Now()
+	interval := a.window / time.Duration(len(a.weights))
+	var cumulative float64
+	var id string
+	for i, weight := range a.weights {
+		if err := sleep(ctx, time.Until(start.Add(time.Duration(i)*interval))); err != nil {
+			return a.abort(id, err)
+		}
+		if id != "" {
+			// A rejected or cancelled slice stops the schedule, the unfilled quantity
+			// of an open one rolls into this one.
+			order, err := a.refresh(id)
+			if err != nil {
+				return err
+			}
+			if _, err := finished(order); err != nil {
+				return err
+			}
+			if err := a.cancel(id); err != nil {
+				return err
+			}
+		}
+
+		cumulative += weight
+		target := int(math.Round(float64(a.progress.Quantity) * cumulative / total))
+		quantity := target - a.Progress().Filled
+		if quantity <= 0 {
+			id = ""
+			continue
+		}
+		var err error
+		if id, err = a.place(quantity, a.params.Price); err != nil {
+			return err
+		}
+	}
+	if id == "" {
+		return nil
+	}
+	return a.wait(ctx, id)
+}
+
+func (a *Algo) runChase(ctx context.Context) error {
+	price, err := a.touch()
+	if err != nil {
+		return err
+	}
+	id, err := a.place(a.progress.Quantity, formatPrice(price))
+	if err != nil {
+		return err
+	}
+
+	for {
+		order, err := a.refresh(id)
+		if err != nil {
+			return err
+		}
+		if done, err := finished(order); done {
+			return err
+		}
+		if next, err := a.touch(); err == nil && next != price {
+			_, err := a.broker.ModifyOrder(smartapigo.ModifyOrderParams{
+				Variety:       a.params.Variety,
+				OrderID:       id,
+				OrderType:     smartapigo.OrderTypeLimit,
+				ProductType:   a.params.ProductType,
+				Duration:      a.params.Duration,
+				Price:         formatPrice(next),
+				TriggerPrice:  "0",
+				Quantity:      strconv.Itoa(a.progress.Quantity),
+				TradingSymbol: a.params.TradingSymbol,
+				SymbolToken:   a.params.SymbolToken,
+				Exchange:      a.params.Exchange,
+			})
+			if err == nil {
+				price = next
+			}
+		}
+		if err := sleep(ctx, a.interval()); err != nil {
+			return a.abort(id, err)
+		}
+	}
+}
+
+// touch returns the price a limit chaser should be at.
+func (a *Algo) touch() (float64, error) {
+	exchangeType, ok := websocket.EXCHANGE_TYPE_MAP[a.params.Exchange]
+	if !ok {
+		return 0, fmt.Errorf("%w: exchange %s", ErrInvalidParams, a.params.Exchange)
+	}
+	book, _ := a.books.Book(exchangeType, a.params.SymbolToken)
+	buy := a.params.TransactionType == smartapigo.TransactionTypeBuy
+	level, ok := book.BestAsk()
+	if buy {
+		level, ok = book.BestBid()
+	}
+	if !ok {
+		return 0, ErrNoQuote
+	}
+
+	a.mutex.Lock()
+	limit := a.priceLimit
+	a.mutex.Unlock()
+	price := level.Price
+	if limit > 0 && ((buy && price > limit) || (!buy && price < limit)) {
+		price = limit
+	}
+	return price, nil
+}
+
+// place places a child order.
+func (a *Algo) place(quantity int, price string) (string, error) {
+	params := a.params
+	params.Quantity = strconv.Itoa(quantity)
+	params.Price = price
+	response, err := a.broker.PlaceOrder(params)
+	if err != nil {
+		return "", err
+	}
+
+	a.mutex.Lock()
+	a.progress.OrderIDs = append(a.progress.OrderIDs, response.OrderID)
+	a.children[response.OrderID] = child{}
+	a.mutex.Unlock()
+	a.notify()
+	return response.OrderID, nil
+}
+
+// wait polls the order book until a child order is done.
+func (a *Algo) wait(ctx context.Context, id string) error {
+	for {
+		order, err := a.refresh(id)
+		if err != nil {
+			return err
+		}
+		if done, err := finished(order); done {
+			return err
+		}
+		if err := sleep(ctx, a.interval()); err != nil {
+			return a.abort(id, err)
+		}
+	}
+}
+
+// abort cancels an open child order and returns err.
+func (a *Algo) abort(id string, err error) error {
+	if id != "" {
+		a.cancel(id)
+	}
+	return err
+}
+
+// cancel cancels a child order if it is still open and records its final fill.
+func (a *Algo) cancel(id string) error {
+	order, err := a.refresh(id)
+	if err != nil {
+		return err
+	}
+	if !order.IsOpen() {
+		return nil
+	}
+	if _, err := a.broker.CancelOrder(a.params.Variety, id); err != nil {
+		return err
+	}
+	_, err = a.refresh(id)
+	return err
+}
+
+// refresh fetches the order book, updates the fills of the child orders and returns
+// the order id.
+func (a *Algo) refresh(id string) (smartapigo.Order, error) {
+	orders, err := a.broker.GetOrderBook()
+	if err != nil {
+		return smartapigo.Order{}, err
+	}
+
+	var found smartapigo.Order
+	changed := false
+	a.mutex.Lock()
+	for _, order := range orders {
+		if order.OrderID == id {
+			found = order
+		}
+		previous, ok := a.children[order.OrderID]
+		if !ok {
+			continue
+		}
+		filled, _ := strconv.Atoi(order.FilledShares)
+		averagePrice, _ := strconv.ParseFloat(order.AveragePrice, 64)
+		if filled != previous.filled || averagePrice != previous.averagePrice {
+			a.children[order.OrderID] = child{filled, averagePrice}
+			changed = true
+		}
+	}
+	if changed {
+		var filled int
+		var value float64
+		for _, c := range a.children {
+			filled += c.filled
+			value += float64(c.filled) * c.averagePrice
+		}
+		a.progress.Filled = filled
+		a.progress.AveragePrice = 0
+		if filled > 0 {
+			a.progress.AveragePrice = value / float64(filled)
+		}
+	}
+	a.mutex.Unlock()
+
+	if changed {
+		a.notify()
+	}
+	if found.OrderID == "" {
+		return found, fmt.Errorf("child order %s not found in the order book", id)
+	}
+	return found, nil
+}
+
+func (a *Algo) notify() {
+	a.mutex.Lock()
+	onProgress := a.onProgress
+	a.mutex.Unlock()
+	if onProgress != nil {
+		onProgress(a.Progress())
+	}
+}
+
+func (a *Algo) interval() time.Duration {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.pollInterval
+}
+
+// finished reports whether a child order is done, with an error if it did not fill.
+func finished(order smartapigo.Order) (bool, error) {
+	if order.IsOpen() {
+		return false, nil
+	}
+	switch strings.ToLower(order.Status) {
+	case smartapigo.OrderStatusRejected:
+		return true, fmt.Errorf("%w: %s", ErrChildOrderRejected, order.Text)
+	case smartapigo.OrderStatusCancelled:
+		return true, ErrChildOrderCanceled
+	}
+	return true, nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
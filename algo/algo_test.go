@@ -0,0 +1,199 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/orderbook"
+	"github.com/piyushpatil22/smartapigo/paper"
+	"github.com/piyushpatil22/smartapigo/smartapitest"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func quote(bid, ask float64) websocket.ParsedData {
+	return websocket.ParsedData{
+		SubscriptionMode: websocket.SNAP_QUOTE,
+		ExchangeType:     websocket.NSE_CM,
+		Token:            "3045",
+		LastTradedPrice:  (bid + ask) / 2,
+		Best5BuyData:     []websocket.OrderData{{Flag: 0, Price: bid, Quantity: 100, NoOfOrders: 1}},
+		Best5SellData:    []websocket.OrderData{{Flag: 1, Price: ask, Quantity: 100, NoOfOrders: 1}},
+	}
+}
+
+func orderParams(transactionType, orderType, quantity string) smartapigo.OrderParams {
+	return smartapigo.OrderParams{
+		Variety:         smartapigo.VarietyNormal,
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: transactionType,
+		Exchange:        smartapigo.NSE,
+		OrderType:       orderType,
+		ProductType:     smartapigo.ProductTypeDelivery,
+		Duration:        smartapigo.DurationDay,
+		Price:           "0",
+		Quantity:        quantity,
+	}
+}
+
+func childQuantities(t *testing.T, engine *paper.Engine) []string {
+	orders, err := engine.GetOrderBook()
+	if err != nil {
+		t.Fatalf("Error fetching order book. %v", err)
+	}
+	var quantities []string
+	for _, order := range orders {
+		quantities = append(quantities, order.Quantity)
+	}
+	return quantities
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIceberg(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	engine.OnTick(quote(99.5, 100))
+
+	algo := NewIceberg(engine, orderParams("BUY", smartapigo.OrderTypeMarket, "25"), 10)
+	algo.SetPollInterval(time.Millisecond)
+	updates := 0
+	algo.OnProgress(func(progress Progress) { updates++ })
+	progress, err := algo.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Error running iceberg. %v", err)
+	}
+	if progress.Filled != 25 || progress.Remaining() != 0 || progress.AveragePrice != 100 || len(progress.OrderIDs) != 3 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+	if quantities := childQuantities(t, engine); len(quantities) != 3 || quantities[2] != "5" {
+		t.Errorf("Expected slices of 10, 10 and 5, got %v", quantities)
+	}
+	if updates != 6 {
+		t.Errorf("Expected a progress update per placement and fill, got %d", updates)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	engine.OnTick(quote(99.5, 100))
+
+	algo := NewVWAP(engine, orderParams("SELL", smartapigo.OrderTypeMarket, "100"), 30*time.Millisecond, []float64{1, 2, 1})
+	algo.SetPollInterval(time.Millisecond)
+	started := time.Now()
+	progress, err := algo.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Error running VWAP. %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected slices spread over the window, took %v", elapsed)
+	}
+	if progress.Filled != 100 || progress.AveragePrice != 99.5 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+	if quantities := childQuantities(t, engine); len(quantities) != 3 || quantities[0] != "25" || quantities[1] != "50" {
+		t.Errorf("Expected slices of 25, 50 and 25, got %v", quantities)
+	}
+}
+
+func TestTWAPCancel(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	engine.OnTick(quote(99.5, 100))
+
+	params := orderParams("BUY", smartapigo.OrderTypeLimit, "30")
+	params.Price = "90"
+	algo := NewTWAP(engine, params, 3, time.Hour)
+	algo.SetPollInterval(time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := algo.Run(ctx)
+		done <- err
+	}()
+	eventually(t, func() bool { return len(algo.Progress().OrderIDs) == 1 })
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	orders, _ := engine.GetOrderBook()
+	if len(orders) != 1 || orders[0].Quantity != "10" || orders[0].Status != smartapigo.OrderStatusCancelled {
+		t.Errorf("Expected the first slice to be cancelled, got %+v", orders)
+	}
+	if progress := algo.Progress(); progress.Remaining() != 30 {
+		t.Errorf("Expected nothing filled, got %+v", progress)
+	}
+}
+
+func TestTWAPRejected(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	var orders smartapigo.Orders
+	client.PlaceOrderFunc = func(params smartapigo.OrderParams) (smartapigo.OrderResponse, error) {
+		id := fmt.Sprint(len(orders) + 1)
+		orders = append(orders, smartapigo.Order{OrderID: id, Quantity: params.Quantity, Status: "Rejected", FilledShares: "0", Text: "Insufficient funds"})
+		return smartapigo.OrderResponse{OrderID: id}, nil
+	}
+	client.GetOrderBookFunc = func() (smartapigo.Orders, error) {
+		return orders, nil
+	}
+
+	algo := NewTWAP(client, orderParams("BUY", smartapigo.OrderTypeMarket, "30"), 3, 30*time.Millisecond)
+	algo.SetPollInterval(time.Millisecond)
+	progress, err := algo.Run(context.Background())
+	if !errors.Is(err, ErrChildOrderRejected) {
+		t.Errorf("Expected ErrChildOrderRejected, got %v", err)
+	}
+	if len(orders) != 1 || len(client.CancelOrderCalls) != 0 || progress.Filled != 0 {
+		t.Errorf("Expected the schedule to stop after the rejected slice, got %d orders and %+v", len(orders), progress)
+	}
+}
+
+func TestLimitChaser(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	books := orderbook.NewBooks()
+	update := func(bid, ask float64) {
+		engine.OnTick(quote(bid, ask))
+		books.OnTick(quote(bid, ask))
+	}
+	update(100, 100.5)
+
+	algo := NewLimitChaser(engine, books, orderParams("BUY", smartapigo.OrderTypeMarket, "10"))
+	algo.SetPollInterval(time.Millisecond)
+	algo.SetPriceLimit(101)
+	done := make(chan error)
+	go func() {
+		_, err := algo.Run(context.Background())
+		done <- err
+	}()
+
+	price := func() string {
+		orders, _ := engine.GetOrderBook()
+		if len(orders) == 0 {
+			return ""
+		}
+		return orders[0].Price
+	}
+	eventually(t, func() bool { return price() == "100" })
+	// The bid moves beyond the limit, the order follows up to it.
+	update(101.5, 102)
+	eventually(t, func() bool { return price() == "101" })
+	update(100.5, 101)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Error chasing. %v", err)
+	}
+	if progress := algo.Progress(); progress.Filled != 10 || progress.AveragePrice != 101 || len(progress.OrderIDs) != 1 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+}
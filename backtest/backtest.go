@@ -0,0 +1,311 @@
+// Package backtest replays historical candles or recorded ticks through a strategy,
+// simulating fills with the paper trading engine, and reports the resulting trades
+// and summary metrics.
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/paper"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+const (
+	// Default time at which intraday positions are squared off, in IST.
+	DEFAULT_SQUARE_OFF_HOUR   = 15
+	DEFAULT_SQUARE_OFF_MINUTE = 15
+
+	// Trading days per year used to annualise the Sharpe ratio.
+	tradingDaysPerYear = 252
+)
+
+var (
+	ErrSquaredOff = fmt.Errorf("intraday orders are not accepted after square-off")
+)
+
+// Strategy trades through the broker in reaction to replayed ticks.
+type Strategy interface {
+	OnTick(broker smartapigo.Broker, tick websocket.ParsedData)
+}
+
+// StrategyFunc adapts a function to Strategy.
+type StrategyFunc func(broker smartapigo.Broker, tick websocket.ParsedData)
+
+// OnTick calls f.
+func (f StrategyFunc) OnTick(broker smartapigo.Broker, tick websocket.ParsedData) {
+	f(broker, tick)
+}
+
+// Backtest holds the simulation settings. A Backtest can run any number of times.
+type Backtest struct {
+	funds           float64
+	slippage        float64
+	charges         paper.Charges
+	squareOff       bool
+	squareOffHour   int
+	squareOffMinute int
+}
+
+// EquityPoint is the value of the account at the close of a trading day.
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// Summary holds the performance metrics of a run.
+type Summary struct {
+	InitialFunds float64
+	FinalEquity  float64
+	NetPnL       float64
+	Charges      float64
+	// Largest fall of equity from a previous peak, in rupees and as a fraction of the peak.
+	MaxDrawdown        float64
+	MaxDrawdownPercent float64
+	// A round trip ends each time the position of a symbol returns to flat or reverses.
+	RoundTrips int
+	Wins       int
+	WinRate    float64
+	// Annualised Sharpe ratio of daily returns, assuming a zero risk-free rate.
+	Sharpe float64
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	Orders  smartapigo.Orders
+	Trades  smartapigo.Trades
+	Equity  []EquityPoint
+	Summary Summary
+}
+
+// New creates a backtest starting with the given funds. Intraday positions are
+// squared off at 15:15 IST by default.
+func New(funds float64) *Backtest {
+	return &Backtest{
+		funds:           funds,
+		squareOff:       true,
+		squareOffHour:   DEFAULT_SQUARE_OFF_HOUR,
+		squareOffMinute: DEFAULT_SQUARE_OFF_MINUTE,
+	}
+}
+
+// SetSlippage sets the slippage applied to market fills, see paper.Engine.SetSlippage.
+func (b *Backtest) SetSlippage(slippage float64) {
+	b.slippage = slippage
+}
+
+// SetCharges sets the charges deducted for every executed order.
+func (b *Backtest) SetCharges(charges paper.Charges) {
+	b.charges = charges
+}
+
+// SetSquareOffTime sets the IST time at which pending INTRADAY orders are cancelled and
+// INTRADAY positions are closed at market. New INTRADAY orders are rejected with
+// ErrSquaredOff from then until the next day.
+func (b *Backtest) SetSquareOffTime(hour, minute int) {
+	b.squareOff = true
+	b.squareOffHour = hour
+	b.squareOffMinute = minute
+}
+
+// DisableSquareOff keeps intraday positions open across days.
+func (b *Backtest) DisableSquareOff() {
+	b.squareOff = false
+}
+
+// Run replays the feed through the strategy. Each tick first fills pending orders,
+// then triggers the intraday square-off if due, and is then passed to the strategy.
+func (b *Backtest) Run(feed Feed, strategy Strategy) (Result, error) {
+	var now time.Time
+	engine := paper.NewEngine(b.funds)
+	engine.SetSlippage(b.slippage)
+	engine.SetCharges(b.charges)
+	engine.SetClock(func() time.Time { return now })
+	broker := &sessionBroker{Engine: engine}
+
+	var (
+		result       Result
+		day          string
+		squaredOff   string
+		peak         = b.funds
+		lastEquity   = b.funds
+		lastTickTime time.Time
+	)
+	for {
+		tick, err := feed.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if tick.ExchangeTimestamp > 0 {
+			now = time.Unix(0, tick.ExchangeTimestamp*int64(time.Millisecond)).In(calendar.IST)
+		}
+
+		if today := now.Format("2006-01-02"); today != day {
+			if day != "" {
+				result.Equity = append(result.Equity, EquityPoint{lastTickTime, lastEquity})
+			}
+			day = today
+			broker.squaredOff = false
+		}
+
+		engine.OnTick(tick)
+		if b.squareOff && squaredOff != day && !now.Before(b.squareOffAt(now)) {
+			squaredOff = day
+			if err := squareOffIntraday(engine); err != nil {
+				return result, err
+			}
+			broker.squaredOff = true
+		}
+		strategy.OnTick(broker, tick)
+
+		lastEquity = engine.Equity()
+		lastTickTime = now
+		if lastEquity > peak {
+			peak = lastEquity
+		}
+		if drawdown := peak - lastEquity; drawdown > result.Summary.MaxDrawdown {
+			result.Summary.MaxDrawdown = drawdown
+			result.Summary.MaxDrawdownPercent = drawdown / peak
+		}
+	}
+	if day != "" {
+		result.Equity = append(result.Equity, EquityPoint{lastTickTime, lastEquity})
+	}
+
+	result.Orders, _ = engine.GetOrderBook()
+	result.Trades, _ = engine.GetTradeBook()
+	rms, _ := engine.GetRMS()
+
+	summary := &result.Summary
+	summary.InitialFunds = b.funds
+	summary.FinalEquity = lastEquity
+	summary.NetPnL = lastEquity - b.funds
+	summary.Charges, _ = strconv.ParseFloat(rms.UtilisedDebits, 64)
+	summary.RoundTrips, summary.Wins = roundTrips(result.Trades)
+	if summary.RoundTrips > 0 {
+		summary.WinRate = float64(summary.Wins) / float64(summary.RoundTrips)
+	}
+	summary.Sharpe = sharpe(b.funds, result.Equity)
+	return result, nil
+}
+
+func (b *Backtest) squareOffAt(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), b.squareOffHour, b.squareOffMinute, 0, 0, calendar.IST)
+}
+
+// sessionBroker rejects new intraday orders after the square-off.
+type sessionBroker struct {
+	*paper.Engine
+	squaredOff bool
+}
+
+func (s *sessionBroker) PlaceOrder(orderParams smartapigo.OrderParams) (smartapigo.OrderResponse, error) {
+	if s.squaredOff && orderParams.ProductType == smartapigo.ProductTypeIntraday {
+		return smartapigo.OrderResponse{}, ErrSquaredOff
+	}
+	return s.Engine.PlaceOrder(orderParams)
+}
+
+// squareOffIntraday cancels pending intraday orders and closes intraday positions at market.
+func squareOffIntraday(engine *paper.Engine) error {
+	_, err := smartapigo.CancelAllOrders(engine, func(order smartapigo.Order) bool {
+		return order.ProductType == smartapigo.ProductTypeIntraday
+	})
+	if err != nil {
+		return err
+	}
+	_, err = smartapigo.ExitAllPositions(engine, func(position smartapigo.Position) bool {
+		return position.ProductType == smartapigo.ProductTypeIntraday
+	}, nil)
+	return err
+}
+
+// roundTrips counts the round trips in the trades and how many of them made money.
+func roundTrips(trades smartapigo.Trades) (count, wins int) {
+	type book struct {
+		net     int
+		average float64
+		pnl     float64
+	}
+	books := make(map[string]*book)
+	for _, trade := range trades {
+		quantity, _ := strconv.Atoi(trade.FillSize)
+		price, _ := strconv.ParseFloat(trade.FillPrice, 64)
+		if trade.TransactionType == smartapigo.TransactionTypeSell {
+			quantity = -quantity
+		}
+		key := trade.Exchange + ":" + trade.TradingSymbol + ":" + trade.ProductType
+		b, ok := books[key]
+		if !ok {
+			b = &book{}
+			books[key] = b
+		}
+
+		if b.net == 0 || (b.net > 0) == (quantity > 0) {
+			b.average = (b.average*float64(b.net) + price*float64(quantity)) / float64(b.net+quantity)
+			b.net += quantity
+			continue
+		}
+
+		closed := quantity
+		if abs(closed) > abs(b.net) {
+			closed = -b.net
+		}
+		b.pnl += float64(-closed) * (price - b.average)
+		b.net += closed
+		if b.net == 0 {
+			count++
+			if b.pnl > 0 {
+				wins++
+			}
+			b.pnl = 0
+			if remaining := quantity - closed; remaining != 0 {
+				b.net, b.average = remaining, price
+			}
+		}
+	}
+	return count, wins
+}
+
+// sharpe annualises the Sharpe ratio of the daily returns of the equity curve.
+func sharpe(funds float64, equity []EquityPoint) float64 {
+	if len(equity) < 2 {
+		return 0
+	}
+	returns := make([]float64, len(equity))
+	previous := funds
+	for i, point := range equity {
+		returns[i] = point.Equity/previous - 1
+		previous = point.Equity
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+	if variance == 0 {
+		return 0
+	}
+	return mean / math.Sqrt(variance) * math.Sqrt(tradingDaysPerYear)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,171 @@
+package backtest
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/paper"
+	"github.com/piyushpatil22/smartapigo/websocket"
+	"github.com/piyushpatil22/smartapigo/websocket/recorder"
+)
+
+const candlesCSV = `timestamp,open,high,low,close,volume
+2023-09-06 09:15,100,101,99.5,100.5,1000
+2023-09-06 09:20,100.5,102,100,101.5,1000
+2023-09-06 15:10,104,105,103.5,104.5,1000
+2023-09-06 15:15,105,105.5,104,104.5,1000
+2023-09-07T09:15:00+05:30,104,104.5,102,102.5,1000
+2023-09-07T09:20:00+05:30,102.5,103,101,101.5,1000
+2023-09-07T15:10:00+05:30,100,100.5,99,99.5,1000
+2023-09-07T15:15:00+05:30,99,99.5,98,98.5,1000
+`
+
+// buyEveryTick buys 10 shares at market on every tick.
+type buyEveryTick struct {
+	errors []error
+}
+
+func (s *buyEveryTick) OnTick(broker smartapigo.Broker, tick websocket.ParsedData) {
+	_, err := broker.PlaceOrder(smartapigo.OrderParams{
+		Variety:         smartapigo.VarietyNormal,
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: "BUY",
+		Exchange:        "NSE",
+		OrderType:       "MARKET",
+		ProductType:     smartapigo.ProductTypeIntraday,
+		Duration:        smartapigo.DurationDay,
+		Quantity:        "10",
+	})
+	if err != nil {
+		s.errors = append(s.errors, err)
+	}
+}
+
+func TestReadCandlesCSV(t *testing.T) {
+	candles, err := ReadCandlesCSV(strings.NewReader(candlesCSV))
+	if err != nil {
+		t.Fatalf("Error reading candles. %v", err)
+	}
+	if len(candles) != 8 || candles[1].High != 102 || candles[7].Volume != 1000 {
+		t.Errorf("Unexpected candles %+v", candles)
+	}
+	if !candles[0].Time.Equal(time.Date(2023, 9, 6, 9, 15, 0, 0, calendar.IST)) {
+		t.Errorf("Expected IST timestamp, got %v", candles[0].Time)
+	}
+
+	if _, err := ReadCandlesCSV(strings.NewReader("2023-09-06 09:15,abc,1,1,1,1\n")); err == nil {
+		t.Errorf("Expected an invalid price to be rejected")
+	}
+}
+
+func TestCandleFeed(t *testing.T) {
+	candles, _ := ReadCandlesCSV(strings.NewReader(candlesCSV))
+	feed := MergeFeeds(NewCandleFeed(websocket.NSE_CM, "3045", 5*time.Minute, candles[:2]))
+
+	var prices []float64
+	var volume int64
+	for {
+		tick, err := feed.Next()
+		if err == io.EOF {
+			break
+		}
+		prices = append(prices, tick.LastTradedPrice)
+		volume = tick.VolumeTradeForTheDay
+	}
+	expected := []float64{100, 99.5, 101, 100.5, 100.5, 100, 102, 101.5}
+	if len(prices) != len(expected) {
+		t.Fatalf("Expected prices %v, got %v", expected, prices)
+	}
+	for i := range expected {
+		if prices[i] != expected[i] {
+			t.Fatalf("Expected prices %v, got %v", expected, prices)
+		}
+	}
+	if volume != 2000 {
+		t.Errorf("Expected cumulative volume of 2000, got %d", volume)
+	}
+}
+
+func TestRun(t *testing.T) {
+	candles, _ := ReadCandlesCSV(strings.NewReader(candlesCSV))
+	strategy := &buyEveryTick{}
+
+	backtest := New(100000)
+	backtest.SetCharges(paper.Charges{PerOrder: 10})
+	result, err := backtest.Run(NewCandleFeed(websocket.NSE_CM, "3045", 5*time.Minute, candles), strategy)
+	if err != nil {
+		t.Fatalf("Error running backtest. %v", err)
+	}
+
+	// Each day every tick before 15:15 buys 10 shares, everything is sold at the open
+	// of the 15:15 candle and the four ticks of that candle are rejected.
+	if len(strategy.errors) != 8 {
+		t.Errorf("Expected the ticks after square-off to be rejected, got %v", strategy.errors)
+	}
+	for _, err := range strategy.errors {
+		if err != ErrSquaredOff {
+			t.Errorf("Expected ErrSquaredOff, got %v", err)
+		}
+	}
+
+	summary := result.Summary
+	if summary.RoundTrips != 2 || summary.Wins != 1 || summary.WinRate != 0.5 {
+		t.Errorf("Expected one winning and one losing round trip, got %+v", summary)
+	}
+	if len(result.Equity) != 2 {
+		t.Fatalf("Expected two daily equity points, got %+v", result.Equity)
+	}
+	if math.Abs(summary.NetPnL-(result.Equity[1].Equity-100000)) > 1e-6 || summary.Charges != float64(len(result.Trades))*10 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if summary.MaxDrawdown <= 0 || summary.Sharpe == 0 {
+		t.Errorf("Expected a drawdown and a Sharpe ratio, got %+v", summary)
+	}
+}
+
+func TestRecordingFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backtest")
+	if err != nil {
+		t.Fatalf("Error creating temp dir. %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := recorder.NewRecorder(dir, "ticks")
+	for i, price := range []float64{590.5, 591, 589.75} {
+		packet, _ := websocket.EncodeBinaryData(websocket.ParsedData{
+			SubscriptionMode:  websocket.LTP_MODE,
+			ExchangeType:      websocket.NSE_CM,
+			Token:             "3045",
+			ExchangeTimestamp: 1694000000000 + int64(i),
+			LastTradedPrice:   price,
+		})
+		r.Record(packet, time.Now())
+		r.Record([]byte(`{"errorCode":"E1002"}`), time.Now())
+	}
+	r.Close()
+	paths, _ := recorder.Files(dir, "ticks")
+
+	feed := NewRecordingFeed(paths...)
+	var prices []float64
+	for {
+		tick, err := feed.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading feed. %v", err)
+		}
+		prices = append(prices, tick.LastTradedPrice)
+	}
+	if len(prices) != 3 || prices[2] != 589.75 {
+		t.Errorf("Expected the three recorded ticks, got %v", prices)
+	}
+}
@@ -0,0 +1,225 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/websocket"
+	"github.com/piyushpatil22/smartapigo/websocket/recorder"
+)
+
+// Feed is a source of ticks in time order. Next returns io.EOF once the feed is exhausted.
+type Feed interface {
+	Next() (websocket.ParsedData, error)
+}
+
+// tickFeed replays recorded ticks.
+type tickFeed struct {
+	ticks []websocket.ParsedData
+	next  int
+}
+
+// NewTickFeed returns a feed replaying ticks, such as ones recorded from SocketClientV2.
+func NewTickFeed(ticks []websocket.ParsedData) Feed {
+	return &tickFeed{ticks: ticks}
+}
+
+func (f *tickFeed) Next() (websocket.ParsedData, error) {
+	if f.next >= len(f.ticks) {
+		return websocket.ParsedData{}, io.EOF
+	}
+	f.next++
+	return f.ticks[f.next-1], nil
+}
+
+// recordingFeed decodes the frames of recordings made with the recorder package.
+type recordingFeed struct {
+	paths  []string
+	reader *recorder.Reader
+}
+
+// NewRecordingFeed returns a feed of the ticks in recordings made with the recorder
+// package, read in the order given. Frames that are not ticks are skipped.
+func NewRecordingFeed(paths ...string) Feed {
+	return &recordingFeed{paths: paths}
+}
+
+func (f *recordingFeed) Next() (websocket.ParsedData, error) {
+	for {
+		if f.reader == nil {
+			if len(f.paths) == 0 {
+				return websocket.ParsedData{}, io.EOF
+			}
+			reader, err := recorder.OpenFile(f.paths[0])
+			if err != nil {
+				return websocket.ParsedData{}, err
+			}
+			f.reader, f.paths = reader, f.paths[1:]
+		}
+
+		frame, err := f.reader.Next()
+		if err == io.EOF {
+			f.reader.Close()
+			f.reader = nil
+			continue
+		}
+		if err != nil {
+			return websocket.ParsedData{}, err
+		}
+		if tick, err := websocket.ParseBinaryData(frame.Data); err == nil {
+			return tick, nil
+		}
+	}
+}
+
+// candleFeed turns each candle into four QUOTE ticks: the open, the high and the low
+// in the order the candle most likely traded them, and the close.
+type candleFeed struct {
+	exchangeType int
+	token        string
+	interval     time.Duration
+	candles      []smartapigo.Candle
+	pending      []websocket.ParsedData
+	day          string
+	volume       int64
+}
+
+// NewCandleFeed returns a feed of ticks derived from the candles of an instrument. The
+// ticks of a candle are spread over its interval so that the close is traded before
+// the next candle opens.
+func NewCandleFeed(exchangeType int, token string, interval time.Duration, candles []smartapigo.Candle) Feed {
+	return &candleFeed{exchangeType: exchangeType, token: token, interval: interval, candles: candles}
+}
+
+func (f *candleFeed) Next() (websocket.ParsedData, error) {
+	for len(f.pending) == 0 {
+		if len(f.candles) == 0 {
+			return websocket.ParsedData{}, io.EOF
+		}
+		f.expand(f.candles[0])
+		f.candles = f.candles[1:]
+	}
+	tick := f.pending[0]
+	f.pending = f.pending[1:]
+	return tick, nil
+}
+
+func (f *candleFeed) expand(candle smartapigo.Candle) {
+	if day := candle.Time.In(calendar.IST).Format("2006-01-02"); day != f.day {
+		f.day, f.volume = day, 0
+	}
+
+	prices := []float64{candle.Open, candle.High, candle.Low, candle.Close}
+	if candle.Close >= candle.Open {
+		prices[1], prices[2] = candle.Low, candle.High
+	}
+	offsets := []time.Duration{0, f.interval / 4, f.interval / 2, f.interval - time.Millisecond}
+
+	for i, price := range prices {
+		volume := candle.Volume / 4
+		if i == len(prices)-1 {
+			volume = candle.Volume - 3*volume
+		}
+		f.volume += volume
+		at := candle.Time.Add(offsets[i])
+		f.pending = append(f.pending, websocket.ParsedData{
+			SubscriptionMode:     websocket.QUOTE,
+			ExchangeType:         byte(f.exchangeType),
+			Token:                f.token,
+			ExchangeTimestamp:    at.UnixNano() / int64(time.Millisecond),
+			LastTradedPrice:      price,
+			LastTradedQuantity:   volume,
+			VolumeTradeForTheDay: f.volume,
+			OpenPriceOfTheDay:    candle.Open,
+			HighPriceOfTheDay:    candle.High,
+			LowPriceOfTheDay:     candle.Low,
+			ClosedPrice:          candle.Close,
+		})
+	}
+}
+
+// mergedFeed interleaves several feeds by exchange timestamp.
+type mergedFeed struct {
+	feeds []Feed
+	heads []*websocket.ParsedData
+}
+
+// MergeFeeds returns a feed interleaving the ticks of several feeds in time order.
+func MergeFeeds(feeds ...Feed) Feed {
+	return &mergedFeed{feeds: feeds, heads: make([]*websocket.ParsedData, len(feeds))}
+}
+
+func (f *mergedFeed) Next() (websocket.ParsedData, error) {
+	next := -1
+	for i, feed := range f.feeds {
+		if feed == nil {
+			continue
+		}
+		if f.heads[i] == nil {
+			tick, err := feed.Next()
+			if err == io.EOF {
+				f.feeds[i] = nil
+				continue
+			}
+			if err != nil {
+				return websocket.ParsedData{}, err
+			}
+			f.heads[i] = &tick
+		}
+		if next < 0 || f.heads[i].ExchangeTimestamp < f.heads[next].ExchangeTimestamp {
+			next = i
+		}
+	}
+	if next < 0 {
+		return websocket.ParsedData{}, io.EOF
+	}
+	tick := *f.heads[next]
+	f.heads[next] = nil
+	return tick, nil
+}
+
+// ReadCandlesCSV reads candles from CSV rows of timestamp, open, high, low, close and
+// volume. Timestamps are RFC 3339, or in CandleDateLayout in IST. A header row is skipped.
+func ReadCandlesCSV(r io.Reader) ([]smartapigo.Candle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+
+	var candles []smartapigo.Candle
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return candles, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "timestamp") {
+			continue
+		}
+
+		var candle smartapigo.Candle
+		candle.Time, err = time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			candle.Time, err = time.ParseInLocation(smartapigo.CandleDateLayout, record[0], calendar.IST)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp %q", line, record[0])
+		}
+		for i, v := range []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close} {
+			if *v, err = strconv.ParseFloat(record[i+1], 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid price %q", line, record[i+1])
+			}
+		}
+		if candle.Volume, err = strconv.ParseInt(record[5], 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid volume %q", line, record[5])
+		}
+		candles = append(candles, candle)
+	}
+}
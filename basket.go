@@ -0,0 +1,311 @@
+package smartapigo
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BasketFailurePolicy is what happens to the other legs of a basket when a leg fails.
+type BasketFailurePolicy int
+
+const (
+	// BasketLeaveAsIs leaves the legs placed so far untouched.
+	BasketLeaveAsIs BasketFailurePolicy = iota
+	// BasketCancelPending cancels the legs that are still open.
+	BasketCancelPending
+	// BasketSquareOff cancels the legs that are still open and squares off the
+	// quantity filled by the others with market orders.
+	BasketSquareOff
+)
+
+// Default number of legs of a basket placed per second.
+const DefaultBasketRateLimit = 10
+
+var (
+	ErrInvalidOrderParams = fmt.Errorf("invalid order params")
+	ErrInsufficientMargin = fmt.Errorf("insufficient margin")
+	ErrBasketAborted      = fmt.Errorf("basket aborted after a failed leg")
+)
+
+// Validate checks that order params are complete and consistent before they are sent.
+func (p OrderParams) Validate() error {
+	required := []struct{ name, value string }{
+		{"variety", p.Variety},
+		{"tradingsymbol", p.TradingSymbol},
+		{"symboltoken", p.SymbolToken},
+		{"exchange", p.Exchange},
+		{"ordertype", p.OrderType},
+		{"producttype", p.ProductType},
+		{"duration", p.Duration},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidOrderParams, field.name)
+		}
+	}
+	if p.TransactionType != TransactionTypeBuy && p.TransactionType != TransactionTypeSell {
+		return fmt.Errorf("%w: invalid transactiontype %q", ErrInvalidOrderParams, p.TransactionType)
+	}
+	if quantity, err := strconv.Atoi(p.Quantity); err != nil || quantity <= 0 {
+		return fmt.Errorf("%w: invalid quantity %q", ErrInvalidOrderParams, p.Quantity)
+	}
+	switch p.OrderType {
+	case OrderTypeLimit, OrderTypeStopLossLimit:
+		if price, err := strconv.ParseFloat(p.Price, 64); err != nil || price <= 0 {
+			return fmt.Errorf("%w: invalid price %q for %s order", ErrInvalidOrderParams, p.Price, p.OrderType)
+		}
+	}
+	switch p.OrderType {
+	case OrderTypeStopLossLimit, OrderTypeStopLossMarket:
+		if price, err := strconv.ParseFloat(p.TriggerPrice, 64); err != nil || price <= 0 {
+			return fmt.Errorf("%w: invalid triggerprice %q for %s order", ErrInvalidOrderParams, p.TriggerPrice, p.OrderType)
+		}
+	}
+	return nil
+}
+
+// Basket is a set of orders placed together, such as the legs of an option strategy.
+type Basket struct {
+	legs        []OrderParams
+	concurrent  bool
+	policy      BasketFailurePolicy
+	checkMargin bool
+	rateLimit   int
+	ratePeriod  time.Duration
+}
+
+// BasketLegResult is the outcome of a leg of a basket.
+type BasketLegResult struct {
+	Params  OrderParams
+	OrderID string
+	// Error placing the leg, ErrBasketAborted for legs not placed after a failure.
+	Err error
+	// Whether the leg was cancelled by the failure policy.
+	Cancelled bool
+	// Order squaring off the filled quantity of the leg.
+	SquareOffOrderID string
+	// Error cancelling or squaring off the leg.
+	PolicyErr error
+}
+
+// BasketReport is the outcome of every leg of a basket, in the order of the legs.
+type BasketReport struct {
+	Legs []BasketLegResult
+}
+
+// Failed reports whether any leg failed.
+func (r BasketReport) Failed() bool {
+	for _, leg := range r.Legs {
+		if leg.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// marginService is implemented by brokers able to compute the margin of orders.
+type marginService interface {
+	GetRMS() (RMS, error)
+	GetMarginRequired(marginParams MarginParams) (Margin, error)
+}
+
+// NewBasket creates a basket of legs placed sequentially, stopping at the first
+// failure, with the BasketLeaveAsIs policy.
+func NewBasket(legs ...OrderParams) *Basket {
+	return &Basket{
+		legs:       legs,
+		rateLimit:  DefaultBasketRateLimit,
+		ratePeriod: time.Second,
+	}
+}
+
+// SetConcurrent places the legs concurrently instead of one after another. All legs
+// are then placed even if one fails.
+func (b *Basket) SetConcurrent(concurrent bool) {
+	b.concurrent = concurrent
+}
+
+// SetFailurePolicy sets what happens to the other legs when a leg fails.
+func (b *Basket) SetFailurePolicy(policy BasketFailurePolicy) {
+	b.policy = policy
+}
+
+// SetCheckMargin checks the combined margin of the legs against the available
+// margin of GetRMS before placing any leg.
+func (b *Basket) SetCheckMargin(check bool) {
+	b.checkMargin = check
+}
+
+// SetRateLimit places at most count legs per period.
+func (b *Basket) SetRateLimit(count int, period time.Duration) {
+	b.rateLimit, b.ratePeriod = count, period
+}
+
+// PlaceBasket validates and places the legs of a basket.
+func (c *Client) PlaceBasket(basket *Basket) (BasketReport, error) {
+	return basket.Place(c)
+}
+
+// Place validates every leg, checks the margin if enabled and places the legs with
+// broker. If a leg fails, the failure policy is applied to the other legs as reported
+// by the order book, and the error of the first failed leg is returned.
+func (b *Basket) Place(broker Broker) (BasketReport, error) {
+	report := BasketReport{Legs: make([]BasketLegResult, len(b.legs))}
+	for i, leg := range b.legs {
+		report.Legs[i].Params = leg
+		if err := leg.Validate(); err != nil {
+			return report, fmt.Errorf("basket leg %d: %w", i, err)
+		}
+	}
+	if b.checkMargin {
+		if err := b.marginCheck(broker); err != nil {
+			return report, err
+		}
+	}
+
+	var interval time.Duration
+	if b.rateLimit > 0 {
+		interval = b.ratePeriod / time.Duration(b.rateLimit)
+	}
+	var wg sync.WaitGroup
+	next := time.Now()
+	for i := range b.legs {
+		if wait := time.Until(next); wait > 0 {
+			time.Sleep(wait)
+		}
+		next = next.Add(interval)
+
+		if b.concurrent {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b.placeLeg(broker, &report.Legs[i])
+			}(i)
+			continue
+		}
+		b.placeLeg(broker, &report.Legs[i])
+		if report.Legs[i].Err != nil {
+			for j := i + 1; j < len(b.legs); j++ {
+				report.Legs[j].Err = ErrBasketAborted
+			}
+			break
+		}
+	}
+	wg.Wait()
+
+	failed := -1
+	for i, leg := range report.Legs {
+		if leg.Err != nil && leg.Err != ErrBasketAborted {
+			failed = i
+			break
+		}
+	}
+	if failed < 0 {
+		return report, nil
+	}
+	if b.policy != BasketLeaveAsIs {
+		b.applyPolicy(broker, &report)
+	}
+	return report, fmt.Errorf("basket leg %d: %w", failed, report.Legs[failed].Err)
+}
+
+func (b *Basket) placeLeg(broker Broker, leg *BasketLegResult) {
+	response, err := broker.PlaceOrder(leg.Params)
+	leg.OrderID, leg.Err = response.OrderID, err
+}
+
+// marginCheck fails if the combined margin of the legs exceeds the available margin.
+func (b *Basket) marginCheck(broker Broker) error {
+	service, ok := broker.(marginService)
+	if !ok {
+		return fmt.Errorf("broker does not support margin checks")
+	}
+	var params MarginParams
+	for _, leg := range b.legs {
+		quantity, _ := strconv.Atoi(leg.Quantity)
+		price, _ := strconv.ParseFloat(leg.Price, 64)
+		params.Positions = append(params.Positions, MarginPosition{
+			Exchange:    leg.Exchange,
+			Quantity:    quantity,
+			Price:       price,
+			ProductType: leg.ProductType,
+			Token:       leg.SymbolToken,
+			TradeType:   leg.TransactionType,
+			OrderType:   leg.OrderType,
+		})
+	}
+	margin, err := service.GetMarginRequired(params)
+	if err != nil {
+		return err
+	}
+	rms, err := service.GetRMS()
+	if err != nil {
+		return err
+	}
+	available, _ := strconv.ParseFloat(rms.Net, 64)
+	if margin.TotalMarginRequired > available {
+		return fmt.Errorf("%w: %.2f required, %.2f available", ErrInsufficientMargin, margin.TotalMarginRequired, available)
+	}
+	return nil
+}
+
+// applyPolicy cancels the open legs and, for BasketSquareOff, squares off the filled ones.
+func (b *Basket) applyPolicy(broker Broker, report *BasketReport) {
+	orders, err := broker.GetOrderBook()
+	book := make(map[string]Order, len(orders))
+	for _, order := range orders {
+		book[order.OrderID] = order
+	}
+
+	for i := range report.Legs {
+		leg := &report.Legs[i]
+		if leg.OrderID == "" {
+			continue
+		}
+		if err != nil {
+			leg.PolicyErr = err
+			continue
+		}
+		order, ok := book[leg.OrderID]
+		if !ok {
+			leg.PolicyErr = fmt.Errorf("order %s not found in the order book", leg.OrderID)
+			continue
+		}
+		if order.IsOpen() {
+			if _, leg.PolicyErr = broker.CancelOrder(leg.Params.Variety, leg.OrderID); leg.PolicyErr != nil {
+				continue
+			}
+			leg.Cancelled = true
+		}
+
+		filled, _ := strconv.Atoi(order.FilledShares)
+		if b.policy != BasketSquareOff || filled <= 0 {
+			continue
+		}
+		// Built field by field so that the tag and bracket params of the entry are not
+		// carried over to the exit.
+		transactionType := TransactionTypeSell
+		if leg.Params.TransactionType == TransactionTypeSell {
+			transactionType = TransactionTypeBuy
+		}
+		squareOff := OrderParams{
+			Variety:         VarietyNormal,
+			TradingSymbol:   leg.Params.TradingSymbol,
+			SymbolToken:     leg.Params.SymbolToken,
+			TransactionType: transactionType,
+			Exchange:        leg.Params.Exchange,
+			OrderType:       OrderTypeMarket,
+			ProductType:     leg.Params.ProductType,
+			Duration:        DurationDay,
+			Price:           "0",
+			TriggerPrice:    "0",
+			SquareOff:       "0",
+			StopLoss:        "0",
+			Quantity:        strconv.Itoa(filled),
+		}
+		response, err := broker.PlaceOrder(squareOff)
+		leg.SquareOffOrderID, leg.PolicyErr = response.OrderID, err
+	}
+}
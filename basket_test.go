@@ -0,0 +1,133 @@
+package smartapigo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// basketBroker fills orders of symbols in filled, keeps others open and fails
+// orders of symbols in failing.
+type basketBroker struct {
+	filled    map[string]bool
+	failing   map[string]bool
+	margin    float64
+	orders    Orders
+	positions Positions
+	cancelled []string
+	mutex     sync.Mutex
+}
+
+func (b *basketBroker) PlaceOrder(orderParams OrderParams) (OrderResponse, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failing[orderParams.TradingSymbol] {
+		return OrderResponse{}, NewError("AB1009", "Order placement failed", nil)
+	}
+	order := Order{OrderID: fmt.Sprint(len(b.orders) + 1), Variety: orderParams.Variety, TradingSymbol: orderParams.TradingSymbol, TransactionType: orderParams.TransactionType, OrderType: orderParams.OrderType, Quantity: orderParams.Quantity, Status: "open", FilledShares: "0",
+		OrderTag: orderParams.OrderTag, DisclosedQuantity: orderParams.DisclosedQuantity, StopLoss: orderParams.StopLoss}
+	if b.filled[orderParams.TradingSymbol] {
+		order.Status, order.FilledShares = "complete", orderParams.Quantity
+	}
+	b.orders = append(b.orders, order)
+	return OrderResponse{OrderID: order.OrderID}, nil
+}
+
+func (b *basketBroker) ModifyOrder(modifyOrderParams ModifyOrderParams) (OrderResponse, error) {
+	return OrderResponse{}, nil
+}
+
+func (b *basketBroker) CancelOrder(variety string, orderid string) (OrderResponse, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.cancelled = append(b.cancelled, orderid)
+	return OrderResponse{OrderID: orderid}, nil
+}
+
+func (b *basketBroker) GetOrderBook() (Orders, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append(Orders(nil), b.orders...), nil
+}
+
+func (b *basketBroker) GetTradeBook() (Trades, error)    { return nil, nil }
+func (b *basketBroker) GetPositions() (Positions, error) { return b.positions, nil }
+func (b *basketBroker) GetRMS() (RMS, error)             { return RMS{Net: "100000"}, nil }
+func (b *basketBroker) GetMarginRequired(MarginParams) (Margin, error) {
+	return Margin{TotalMarginRequired: b.margin}, nil
+}
+
+func basketLeg(symbol, transactionType string) OrderParams {
+	return OrderParams{"NORMAL", symbol, "1", transactionType, NFO, "MARKET", "CARRYFORWARD", "DAY", "0", "0", "0", "0", "50", "0", "0", ""}
+}
+
+func TestOrderParamsValidate(t *testing.T) {
+	leg := basketLeg("NIFTY", "BUY")
+	if err := leg.Validate(); err != nil {
+		t.Errorf("Expected valid params, got %v", err)
+	}
+	leg.OrderType = "LIMIT"
+	if err := leg.Validate(); !errors.Is(err, ErrInvalidOrderParams) {
+		t.Errorf("Expected a limit order without price to be invalid, got %v", err)
+	}
+	leg = basketLeg("NIFTY", "HOLD")
+	if err := leg.Validate(); !errors.Is(err, ErrInvalidOrderParams) {
+		t.Errorf("Expected an invalid transaction type to be invalid, got %v", err)
+	}
+}
+
+func TestBasketSquareOff(t *testing.T) {
+	broker := &basketBroker{
+		filled:  map[string]bool{"CE": true},
+		failing: map[string]bool{"HEDGE": true},
+	}
+	entry := basketLeg("CE", "SELL")
+	entry.OrderTag, entry.DisclosedQuantity, entry.StopLoss = "entry", "10", "5"
+	basket := NewBasket(entry, basketLeg("PE", "SELL"), basketLeg("HEDGE", "BUY"), basketLeg("OTHER", "BUY"))
+	basket.SetFailurePolicy(BasketSquareOff)
+	basket.SetRateLimit(1000, 0)
+
+	report, err := basket.Place(broker)
+	var apiErr Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "AB1009" || !report.Failed() {
+		t.Fatalf("Expected the failure of the third leg, got %v", err)
+	}
+	legs := report.Legs
+	if legs[3].Err != ErrBasketAborted || legs[3].OrderID != "" {
+		t.Errorf("Expected the last leg not to be placed, got %+v", legs[3])
+	}
+	if !legs[1].Cancelled || legs[1].SquareOffOrderID != "" || len(broker.cancelled) != 1 {
+		t.Errorf("Expected the open leg to be cancelled, got %+v", legs[1])
+	}
+	if legs[0].Cancelled || legs[0].SquareOffOrderID == "" {
+		t.Fatalf("Expected the filled leg to be squared off, got %+v", legs[0])
+	}
+	squareOff := broker.orders[len(broker.orders)-1]
+	if squareOff.TradingSymbol != "CE" || squareOff.TransactionType != "BUY" || squareOff.Quantity != "50" || squareOff.OrderType != "MARKET" {
+		t.Errorf("Unexpected square off order %+v", squareOff)
+	}
+	if squareOff.OrderTag != "" || squareOff.DisclosedQuantity != "" || squareOff.StopLoss != "0" {
+		t.Errorf("Unexpected square off order %+v", squareOff)
+	}
+}
+
+func TestBasketConcurrentAndMargin(t *testing.T) {
+	broker := &basketBroker{failing: map[string]bool{"B": true}, margin: 150000}
+	basket := NewBasket(basketLeg("A", "BUY"), basketLeg("B", "BUY"), basketLeg("C", "BUY"))
+	basket.SetCheckMargin(true)
+	if _, err := basket.Place(broker); !errors.Is(err, ErrInsufficientMargin) || len(broker.orders) != 0 {
+		t.Fatalf("Expected the margin check to fail before placing, got %v", err)
+	}
+
+	broker.margin = 50000
+	basket.SetConcurrent(true)
+	basket.SetFailurePolicy(BasketCancelPending)
+	report, err := basket.Place(broker)
+	if err == nil || report.Legs[2].OrderID == "" || report.Legs[0].OrderID == "" {
+		t.Fatalf("Expected every leg to be attempted, got %+v. %v", report, err)
+	}
+	if len(broker.cancelled) != 2 || !report.Legs[0].Cancelled || !report.Legs[2].Cancelled {
+		t.Errorf("Expected both open legs to be cancelled, got %v", broker.cancelled)
+	}
+}
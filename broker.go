@@ -0,0 +1,51 @@
+package smartapigo
+
+// SessionService is the login and user profile API of Client.
+type SessionService interface {
+	GenerateSession(totp string) (UserSession, error)
+	RenewAccessToken(refreshToken string) (UserSessionTokens, error)
+	GetUserProfile() (UserProfile, error)
+	Logout() (bool, error)
+}
+
+// OrderService is the order placement and order book API of Client.
+type OrderService interface {
+	PlaceOrder(orderParams OrderParams) (OrderResponse, error)
+	ModifyOrder(modifyOrderParams ModifyOrderParams) (OrderResponse, error)
+	CancelOrder(variety string, orderid string) (OrderResponse, error)
+	GetOrderBook() (Orders, error)
+	GetTradeBook() (Trades, error)
+}
+
+// PortfolioService is the positions, holdings and funds API of Client.
+type PortfolioService interface {
+	GetPositions() (Positions, error)
+	GetHoldings() (Holdings, error)
+	ConvertPosition(convertPositionParams ConvertPositionParams) error
+	GetRMS() (RMS, error)
+	GetMarginRequired(marginParams MarginParams) (Margin, error)
+}
+
+// MarketDataService is the quote and instrument API of Client.
+type MarketDataService interface {
+	GetLTP(ltpParams LTPParams) (LTPResponse, error)
+	GetCandleData(candleParams CandleParams) ([]Candle, error)
+	SearchScrip(payload SearchScripPayload) ([]LTPParams, error)
+	FetchDailyInstrumentsList() ([]Instrument, error)
+}
+
+// Broker is the order and portfolio API of Client. Code written against it can run
+// unchanged against a live account or a simulated backend such as the paper package.
+type Broker interface {
+	OrderService
+	GetPositions() (Positions, error)
+	GetRMS() (RMS, error)
+}
+
+var (
+	_ SessionService    = (*Client)(nil)
+	_ OrderService      = (*Client)(nil)
+	_ PortfolioService  = (*Client)(nil)
+	_ MarketDataService = (*Client)(nil)
+	_ Broker            = (*Client)(nil)
+)
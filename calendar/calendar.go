@@ -0,0 +1,282 @@
+// Package calendar knows the trading sessions and holidays of the exchange segments.
+package calendar
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+)
+
+// SessionType is a trading session of a day.
+type SessionType string
+
+const (
+	PreOpen   SessionType = "pre-open"
+	Normal    SessionType = "normal"
+	PostClose SessionType = "post-close"
+	// Evening is the evening session of MCX.
+	Evening SessionType = "evening"
+
+	// Format of the dates of a holiday list.
+	DateFormat = "2006-01-02"
+
+	// Number of days searched for the next session.
+	maxSearchDays = 60
+)
+
+// Session is a trading session, from Start to End after midnight IST.
+type Session struct {
+	Type  SessionType
+	Start time.Duration
+	End   time.Duration
+}
+
+// Holiday is a day an exchange segment is closed. Sessions lists the sessions
+// closed, all of them if empty, such as the normal session of MCX on days its
+// evening session is open.
+type Holiday struct {
+	Exchange    string
+	Date        time.Time
+	Description string
+	Sessions    []SessionType
+}
+
+var (
+	// DEFAULT_SESSIONS are the sessions of the exchange segments on a trading day.
+	DEFAULT_SESSIONS = map[string][]Session{
+		smartapigo.NSE: equitySessions,
+		smartapigo.BSE: equitySessions,
+		smartapigo.NFO: {session(Normal, 9, 15, 15, 30)},
+		smartapigo.BFO: {session(Normal, 9, 15, 15, 30)},
+		smartapigo.CDS: {session(Normal, 9, 0, 17, 0)},
+		smartapigo.MCX: {session(Normal, 9, 0, 17, 0), session(Evening, 17, 0, 23, 30)},
+	}
+
+	equitySessions = []Session{
+		session(PreOpen, 9, 0, 9, 8),
+		session(Normal, 9, 15, 15, 30),
+		session(PostClose, 15, 40, 16, 0),
+	}
+
+	ErrInvalidHoliday = fmt.Errorf("invalid holiday")
+
+	// IST is Indian Standard Time, the timezone of the exchange sessions.
+	IST = time.FixedZone("IST", 5*60*60+30*60)
+)
+
+func session(sessionType SessionType, startHour, startMinute, endHour, endMinute int) Session {
+	return Session{
+		Type:  sessionType,
+		Start: time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute,
+		End:   time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute,
+	}
+}
+
+// InIST returns t in Indian Standard Time.
+func InIST(t time.Time) time.Time {
+	return t.In(IST)
+}
+
+// StartOfDay returns midnight IST of the day of t.
+func StartOfDay(t time.Time) time.Time {
+	t = InIST(t)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, IST)
+}
+
+// Date returns the IST time at hour and minute of a day.
+func Date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, IST)
+}
+
+// Calendar is the sessions and holidays of exchange segments, by the exchange names
+// of the REST API such as NSE or MCX.
+type Calendar struct {
+	sessions map[string][]Session
+	holidays map[string]map[string]Holiday
+	mutex    sync.RWMutex
+}
+
+// NewCalendar creates a calendar with DEFAULT_SESSIONS on weekdays and no holidays.
+func NewCalendar() *Calendar {
+	sessions := make(map[string][]Session, len(DEFAULT_SESSIONS))
+	for exchange, list := range DEFAULT_SESSIONS {
+		sessions[exchange] = append([]Session(nil), list...)
+	}
+	return &Calendar{
+		sessions: sessions,
+		holidays: make(map[string]map[string]Holiday),
+	}
+}
+
+// SetSessions replaces the sessions of an exchange segment.
+func (c *Calendar) SetSessions(exchange string, sessions ...Session) {
+	sessions = append([]Session(nil), sessions...)
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Start < sessions[j].Start })
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sessions[exchange] = sessions
+}
+
+// AddHoliday closes an exchange segment on the day of the holiday.
+func (c *Calendar) AddHoliday(holiday Holiday) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.holidays[holiday.Exchange] == nil {
+		c.holidays[holiday.Exchange] = make(map[string]Holiday)
+	}
+	c.holidays[holiday.Exchange][InIST(holiday.Date).Format(DateFormat)] = holiday
+}
+
+// LoadHolidays adds the holidays of a CSV list with lines of exchange, date as
+// YYYY-MM-DD, description and optionally the closed sessions separated by "|":
+//
+//	NSE,2024-01-26,Republic Day
+//	MCX,2024-01-26,Republic Day,normal
+//
+// Empty lines and lines starting with # are skipped.
+func (c *Calendar) LoadHolidays(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 2 {
+			return fmt.Errorf("%w: %q", ErrInvalidHoliday, strings.Join(record, ","))
+		}
+		date, err := time.ParseInLocation(DateFormat, record[1], IST)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidHoliday, err)
+		}
+		holiday := Holiday{Exchange: record[0], Date: date}
+		if len(record) > 2 {
+			holiday.Description = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			for _, sessionType := range strings.Split(record[3], "|") {
+				holiday.Sessions = append(holiday.Sessions, SessionType(sessionType))
+			}
+		}
+		c.AddHoliday(holiday)
+	}
+}
+
+// LoadHolidaysFile adds the holidays of a CSV file, see LoadHolidays.
+func (c *Calendar) LoadHolidaysFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.LoadHolidays(file)
+}
+
+// Holiday returns the holiday of an exchange segment on the day of t.
+func (c *Calendar) Holiday(exchange string, t time.Time) (Holiday, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	holiday, ok := c.holidays[exchange][InIST(t).Format(DateFormat)]
+	return holiday, ok
+}
+
+// Sessions returns the sessions of an exchange segment on the day of t, without
+// those closed for a holiday and none on weekends.
+func (c *Calendar) Sessions(exchange string, t time.Time) []Session {
+	t = InIST(t)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return nil
+	}
+	holiday, isHoliday := c.Holiday(exchange, t)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var sessions []Session
+	for _, s := range c.sessions[exchange] {
+		if isHoliday && holiday.closes(s.Type) {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func (h Holiday) closes(sessionType SessionType) bool {
+	if len(h.Sessions) == 0 {
+		return true
+	}
+	for _, closed := range h.Sessions {
+		if closed == sessionType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTradingDay reports whether an exchange segment has a session on the day of t.
+func (c *Calendar) IsTradingDay(exchange string, t time.Time) bool {
+	return len(c.Sessions(exchange, t)) > 0
+}
+
+// Session returns the session of an exchange segment in progress at t.
+func (c *Calendar) Session(exchange string, t time.Time) (Session, bool) {
+	offset := InIST(t).Sub(StartOfDay(t))
+	for _, s := range c.Sessions(exchange, t) {
+		if offset >= s.Start && offset < s.End {
+			return s, true
+		}
+	}
+	return Session{}, false
+}
+
+// IsMarketOpen reports whether an exchange segment is in its normal or evening
+// session at t, when orders are matched continuously.
+func (c *Calendar) IsMarketOpen(exchange string, t time.Time) bool {
+	s, ok := c.Session(exchange, t)
+	return ok && s.continuous()
+}
+
+func (s Session) continuous() bool {
+	return s.Type == Normal || s.Type == Evening
+}
+
+// NextSessionStart returns the first time after t the market of an exchange segment
+// opens, skipping evening sessions following on from a normal session, or the zero
+// time if it doesn't open in the coming weeks.
+func (c *Calendar) NextSessionStart(exchange string, t time.Time) time.Time {
+	day := StartOfDay(t)
+	for i := 0; i < maxSearchDays; i++ {
+		var openUntil time.Duration = -1
+		for _, s := range c.Sessions(exchange, day) {
+			if !s.continuous() {
+				continue
+			}
+			if start := day.Add(s.Start); s.Start != openUntil && start.After(t) {
+				return start
+			}
+			openUntil = s.End
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// MarketHours returns IsMarketOpen for an exchange segment, to be used with
+// SocketClientV2.SetMarketHours.
+func (c *Calendar) MarketHours(exchange string) func(t time.Time) bool {
+	return func(t time.Time) bool {
+		return c.IsMarketOpen(exchange, t)
+	}
+}
@@ -0,0 +1,90 @@
+package calendar
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+)
+
+const holidays = `# exchange,date,description,sessions
+NSE,2024-01-26,Republic Day
+NFO,2024-01-26,Republic Day
+MCX,2024-01-26,Republic Day,normal
+`
+
+func newCalendar(t *testing.T) *Calendar {
+	calendar := NewCalendar()
+	if err := calendar.LoadHolidays(strings.NewReader(holidays)); err != nil {
+		t.Fatalf("Error loading holidays. %v", err)
+	}
+	return calendar
+}
+
+func TestIsMarketOpen(t *testing.T) {
+	calendar := newCalendar(t)
+	tests := []struct {
+		exchange string
+		at       time.Time
+		open     bool
+	}{
+		{smartapigo.NSE, Date(2024, 1, 25, 9, 5), false},
+		{smartapigo.NSE, Date(2024, 1, 25, 9, 15), true},
+		{smartapigo.NSE, Date(2024, 1, 25, 15, 30), false},
+		{smartapigo.NSE, Date(2024, 1, 26, 11, 0), false},
+		{smartapigo.NSE, Date(2024, 1, 27, 11, 0), false},
+		{smartapigo.BSE, Date(2024, 1, 26, 11, 0), true},
+		{smartapigo.MCX, Date(2024, 1, 25, 22, 0), true},
+		{smartapigo.MCX, Date(2024, 1, 26, 11, 0), false},
+		{smartapigo.MCX, Date(2024, 1, 26, 18, 0), true},
+		// The same instant in UTC.
+		{smartapigo.NSE, Date(2024, 1, 25, 10, 0).UTC(), true},
+	}
+	for _, test := range tests {
+		if open := calendar.IsMarketOpen(test.exchange, test.at); open != test.open {
+			t.Errorf("%s at %v: expected open %v, got %v", test.exchange, test.at, test.open, open)
+		}
+	}
+
+	if s, ok := calendar.Session(smartapigo.NSE, Date(2024, 1, 25, 9, 3)); !ok || s.Type != PreOpen {
+		t.Errorf("Expected the pre-open session, got %+v", s)
+	}
+	if holiday, ok := calendar.Holiday(smartapigo.NSE, Date(2024, 1, 26, 0, 0)); !ok || holiday.Description != "Republic Day" {
+		t.Errorf("Expected Republic Day, got %+v", holiday)
+	}
+	if !calendar.MarketHours(smartapigo.NSE)(Date(2024, 1, 25, 12, 0)) {
+		t.Errorf("Expected market hours to follow the calendar")
+	}
+}
+
+func TestNextSessionStart(t *testing.T) {
+	calendar := newCalendar(t)
+	tests := []struct {
+		exchange string
+		after    time.Time
+		want     time.Time
+	}{
+		{smartapigo.NSE, Date(2024, 1, 25, 8, 0), Date(2024, 1, 25, 9, 15)},
+		// Past Thursday's session, Friday is a holiday.
+		{smartapigo.NSE, Date(2024, 1, 25, 10, 0), Date(2024, 1, 29, 9, 15)},
+		{smartapigo.MCX, Date(2024, 1, 25, 10, 0), Date(2024, 1, 26, 17, 0)},
+		{smartapigo.MCX, Date(2024, 1, 26, 18, 0), Date(2024, 1, 29, 9, 0)},
+	}
+	for _, test := range tests {
+		if start := calendar.NextSessionStart(test.exchange, test.after); !start.Equal(test.want) {
+			t.Errorf("%s after %v: expected %v, got %v", test.exchange, test.after, test.want, start)
+		}
+	}
+	if start := calendar.NextSessionStart("XYZ", Date(2024, 1, 25, 10, 0)); !start.IsZero() {
+		t.Errorf("Expected no session of an unknown exchange, got %v", start)
+	}
+}
+
+func TestLoadHolidaysInvalid(t *testing.T) {
+	calendar := NewCalendar()
+	if err := calendar.LoadHolidays(strings.NewReader("NSE,26-01-2024,Republic Day\n")); !errors.Is(err, ErrInvalidHoliday) {
+		t.Errorf("Expected ErrInvalidHoliday, got %v", err)
+	}
+}
@@ -0,0 +1,399 @@
+// Package candles builds OHLCV bars in real time from SmartStream ticks.
+package candles
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+const (
+	// Default number of completed bars kept per token and interval.
+	DEFAULT_HISTORY_SIZE = 500
+	// Default time a bar keeps accepting late ticks after it ends.
+	DEFAULT_LATENESS = 2 * time.Second
+)
+
+var (
+	// Start of the trading session per exchange type, in minutes after midnight IST.
+	// Bars are aligned to it, so 15 minute bars of NSE_CM start at 09:15, 09:30 and so on.
+	DEFAULT_SESSION_START = map[int]int{
+		websocket.NSE_CM: 9*60 + 15,
+		websocket.NSE_FO: 9*60 + 15,
+		websocket.BSE_CM: 9*60 + 15,
+		websocket.BSE_FO: 9*60 + 15,
+		websocket.MCX_FO: 9 * 60,
+		websocket.NCX_FO: 9 * 60,
+		websocket.CDE_FO: 9 * 60,
+	}
+)
+
+// Bar is an OHLCV candle of a token.
+type Bar struct {
+	ExchangeType int
+	Token        string
+	Interval     time.Duration
+	Start        time.Time
+	Open         float64
+	High         float64
+	Low          float64
+	Close        float64
+	Volume       int64
+	// Number of ticks aggregated, zero for bars seeded from historical candles.
+	Ticks int
+}
+
+// End returns the time the bar ends.
+func (b Bar) End() time.Time {
+	return b.Start.Add(b.Interval)
+}
+
+// Builder aggregates ticks into bars of every configured interval. A bar is completed
+// once a tick of its token arrives past the end of the bar plus the allowed lateness,
+// or when Flush is called past that time.
+type Builder struct {
+	intervals    []time.Duration
+	lateness     time.Duration
+	historySize  int
+	sessionStart map[int]int
+	clock        func() time.Time
+	tokens       map[tokenKey]*tokenState
+	onBar        func(bar Bar)
+	onLateTick   func(tick websocket.ParsedData, interval time.Duration)
+	mutex        sync.Mutex
+}
+
+type tokenKey struct {
+	exchangeType int
+	token        string
+}
+
+// tokenState is the volume tracking and bar series of a token.
+type tokenState struct {
+	volume    int64
+	volumeDay string
+	watermark time.Time
+	series    map[time.Duration]*series
+}
+
+// series holds the bars of a token for one interval.
+type series struct {
+	open          []*openBar
+	history       []Bar
+	lastCompleted time.Time
+}
+
+// openBar is a bar still accepting ticks.
+type openBar struct {
+	Bar
+	first time.Time
+	last  time.Time
+}
+
+// NewBuilder creates a builder of bars of the given intervals, such as time.Minute
+// and 5 * time.Minute. Intervals of a day or more build one bar per session.
+func NewBuilder(intervals ...time.Duration) *Builder {
+	sessionStart := make(map[int]int, len(DEFAULT_SESSION_START))
+	for exchangeType, start := range DEFAULT_SESSION_START {
+		sessionStart[exchangeType] = start
+	}
+	return &Builder{
+		intervals:    intervals,
+		lateness:     DEFAULT_LATENESS,
+		historySize:  DEFAULT_HISTORY_SIZE,
+		sessionStart: sessionStart,
+		clock:        time.Now,
+		tokens:       make(map[tokenKey]*tokenState),
+	}
+}
+
+// SetLateness sets how long after its end a bar keeps accepting out of order ticks.
+func (b *Builder) SetLateness(lateness time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lateness = lateness
+}
+
+// SetHistorySize sets the number of completed bars kept per token and interval.
+func (b *Builder) SetHistorySize(size int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.historySize = size
+}
+
+// SetSessionStart sets the IST time bars of an exchange type are aligned to.
+func (b *Builder) SetSessionStart(exchangeType, hour, minute int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sessionStart[exchangeType] = hour*60 + minute
+}
+
+// SetClock sets the clock used to time ticks without an exchange timestamp.
+func (b *Builder) SetClock(clock func() time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.clock = clock
+}
+
+// OnBar callback, called with every completed bar in time order per token and interval.
+func (b *Builder) OnBar(f func(bar Bar)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.onBar = f
+}
+
+// OnLateTick callback, called when a tick is dropped because the bar of the given
+// interval it belongs to was already completed, or it precedes the session start.
+func (b *Builder) OnLateTick(f func(tick websocket.ParsedData, interval time.Duration)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.onLateTick = f
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (b *Builder) OnMessage(message []byte) {
+	tick, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	b.OnTick(tick)
+}
+
+// OnTick adds a tick to the bars of its token. Per bar volume is derived from the
+// change of VolumeTradeForTheDay since the previous tick of the token.
+func (b *Builder) OnTick(tick websocket.ParsedData) {
+	if tick.LastTradedPrice <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	t := b.clock()
+	if tick.ExchangeTimestamp > 0 {
+		t = time.Unix(0, tick.ExchangeTimestamp*int64(time.Millisecond))
+	}
+	t = t.In(calendar.IST)
+	key := tokenKey{int(tick.ExchangeType), tick.Token}
+	state := b.state(key)
+	volume := state.volumeDelta(tick.VolumeTradeForTheDay, t)
+
+	var late []time.Duration
+	for _, interval := range b.intervals {
+		s := state.series[interval]
+		start, ok := b.align(key.exchangeType, interval, t)
+		if !ok || (!s.lastCompleted.IsZero() && !start.After(s.lastCompleted)) {
+			late = append(late, interval)
+			continue
+		}
+		s.add(key, interval, start, t, tick.LastTradedPrice, volume)
+	}
+	if t.After(state.watermark) {
+		state.watermark = t
+	}
+	completed := b.complete(state, state.watermark)
+	onBar, onLateTick := b.onBar, b.onLateTick
+	b.mutex.Unlock()
+
+	if onLateTick != nil {
+		for _, interval := range late {
+			onLateTick(tick, interval)
+		}
+	}
+	if onBar != nil {
+		for _, bar := range completed {
+			onBar(bar)
+		}
+	}
+}
+
+// Flush completes every bar that ended, including the allowed lateness, by now. Call
+// it periodically so bars of quiet tokens complete without waiting for their next tick.
+func (b *Builder) Flush(now time.Time) {
+	b.mutex.Lock()
+	var completed []Bar
+	for _, state := range b.tokens {
+		completed = append(completed, b.complete(state, now)...)
+	}
+	onBar := b.onBar
+	b.mutex.Unlock()
+
+	sort.SliceStable(completed, func(i, j int) bool { return completed[i].End().Before(completed[j].End()) })
+	if onBar != nil {
+		for _, bar := range completed {
+			onBar(bar)
+		}
+	}
+}
+
+// Seed adds historical candles, such as ones from GetCandleData, to the completed
+// bars of a token so indicators have warm up data. Ticks for bars up to the last
+// candle are then treated as late.
+func (b *Builder) Seed(exchangeType int, token string, interval time.Duration, candles []smartapigo.Candle) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	key := tokenKey{exchangeType, token}
+	s, ok := b.state(key).series[interval]
+	if !ok {
+		return
+	}
+	for _, candle := range candles {
+		s.history = append(s.history, Bar{
+			ExchangeType: exchangeType,
+			Token:        token,
+			Interval:     interval,
+			Start:        candle.Time.In(calendar.IST),
+			Open:         candle.Open,
+			High:         candle.High,
+			Low:          candle.Low,
+			Close:        candle.Close,
+			Volume:       candle.Volume,
+		})
+	}
+	sort.SliceStable(s.history, func(i, j int) bool { return s.history[i].Start.Before(s.history[j].Start) })
+	if n := len(s.history); n > 0 && s.history[n-1].Start.After(s.lastCompleted) {
+		s.lastCompleted = s.history[n-1].Start
+	}
+	s.trim(b.historySize)
+}
+
+// Bars returns the completed bars of a token, oldest first.
+func (b *Builder) Bars(exchangeType int, token string, interval time.Duration) []Bar {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, ok := b.tokens[tokenKey{exchangeType, token}]
+	if !ok || state.series[interval] == nil {
+		return nil
+	}
+	return append([]Bar(nil), state.series[interval].history...)
+}
+
+// Current returns the latest bar of a token still accepting ticks.
+func (b *Builder) Current(exchangeType int, token string, interval time.Duration) (Bar, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, ok := b.tokens[tokenKey{exchangeType, token}]
+	if !ok || state.series[interval] == nil || len(state.series[interval].open) == 0 {
+		return Bar{}, false
+	}
+	open := state.series[interval].open
+	return open[len(open)-1].Bar, true
+}
+
+// state returns the state of a token, creating it if needed. Must be called with the mutex held.
+func (b *Builder) state(key tokenKey) *tokenState {
+	state, ok := b.tokens[key]
+	if !ok {
+		state = &tokenState{series: make(map[time.Duration]*series, len(b.intervals))}
+		for _, interval := range b.intervals {
+			state.series[interval] = &series{}
+		}
+		b.tokens[key] = state
+	}
+	return state
+}
+
+// align returns the start of the bar of the interval containing t, and false for
+// times before the session start.
+func (b *Builder) align(exchangeType int, interval time.Duration, t time.Time) (time.Time, bool) {
+	minutes, ok := b.sessionStart[exchangeType]
+	if !ok {
+		minutes = DEFAULT_SESSION_START[websocket.NSE_CM]
+	}
+	session := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, calendar.IST).Add(time.Duration(minutes) * time.Minute)
+	if t.Before(session) {
+		return time.Time{}, false
+	}
+	if interval >= 24*time.Hour {
+		return session, true
+	}
+	return session.Add(t.Sub(session) / interval * interval), true
+}
+
+// complete moves bars that ended before watermark minus the lateness to the history.
+// Must be called with the mutex held.
+func (b *Builder) complete(state *tokenState, watermark time.Time) []Bar {
+	var completed []Bar
+	for _, interval := range b.intervals {
+		s := state.series[interval]
+		for len(s.open) > 0 && !s.open[0].End().Add(b.lateness).After(watermark) {
+			bar := s.open[0].Bar
+			s.open = s.open[1:]
+			s.history = append(s.history, bar)
+			s.lastCompleted = bar.Start
+			completed = append(completed, bar)
+		}
+		s.trim(b.historySize)
+	}
+	return completed
+}
+
+// volumeDelta returns the volume traded since the previous tick of the token.
+func (state *tokenState) volumeDelta(volume int64, t time.Time) int64 {
+	if volume <= 0 {
+		return 0
+	}
+	day := t.Format("2006-01-02")
+	var delta int64
+	switch {
+	case state.volumeDay == "":
+		// The volume traded before the first tick seen is unknown.
+	case day != state.volumeDay:
+		delta = volume
+	case volume > state.volume:
+		delta = volume - state.volume
+	default:
+		// Out of order tick carrying an older cumulative volume.
+		return 0
+	}
+	state.volume, state.volumeDay = volume, day
+	return delta
+}
+
+// add updates the open bar starting at start with a tick, creating it if needed.
+func (s *series) add(key tokenKey, interval time.Duration, start, t time.Time, price float64, volume int64) {
+	i := sort.Search(len(s.open), func(i int) bool { return !s.open[i].Start.Before(start) })
+	if i == len(s.open) || !s.open[i].Start.Equal(start) {
+		bar := &openBar{
+			Bar: Bar{
+				ExchangeType: key.exchangeType,
+				Token:        key.token,
+				Interval:     interval,
+				Start:        start,
+				Open:         price,
+				High:         price,
+				Low:          price,
+				Close:        price,
+			},
+			first: t,
+			last:  t,
+		}
+		s.open = append(s.open, nil)
+		copy(s.open[i+1:], s.open[i:])
+		s.open[i] = bar
+	}
+
+	bar := s.open[i]
+	if price > bar.High {
+		bar.High = price
+	}
+	if price < bar.Low {
+		bar.Low = price
+	}
+	if t.Before(bar.first) {
+		bar.first, bar.Open = t, price
+	}
+	if !t.Before(bar.last) {
+		bar.last, bar.Close = t, price
+	}
+	bar.Volume += volume
+	bar.Ticks++
+}
+
+func (s *series) trim(size int) {
+	if size > 0 && len(s.history) > size {
+		s.history = append([]Bar(nil), s.history[len(s.history)-size:]...)
+	}
+}
@@ -0,0 +1,118 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func at(hour, minute, second int) time.Time {
+	return time.Date(2023, 9, 6, hour, minute, second, 0, calendar.IST)
+}
+
+func tick(t time.Time, price float64, volume int64) websocket.ParsedData {
+	return websocket.ParsedData{
+		SubscriptionMode:     websocket.QUOTE,
+		ExchangeType:         websocket.NSE_CM,
+		Token:                "3045",
+		ExchangeTimestamp:    t.UnixNano() / int64(time.Millisecond),
+		LastTradedPrice:      price,
+		VolumeTradeForTheDay: volume,
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	builder := NewBuilder(time.Minute, 15*time.Minute)
+	builder.SetLateness(time.Second)
+
+	var bars []Bar
+	builder.OnBar(func(bar Bar) { bars = append(bars, bar) })
+	var late int
+	builder.OnLateTick(func(tick websocket.ParsedData, interval time.Duration) { late++ })
+
+	builder.OnTick(tick(at(9, 14, 0), 99, 0))
+	builder.OnTick(tick(at(9, 15, 1), 100, 1000))
+	builder.OnTick(tick(at(9, 15, 30), 102, 1500))
+	builder.OnTick(tick(at(9, 15, 59), 101, 1800))
+	builder.OnTick(tick(at(9, 15, 20), 98, 1200))
+	builder.OnTick(tick(at(9, 16, 0), 103, 2000))
+	// Still within the lateness of the 09:15 bar.
+	builder.OnTick(tick(at(9, 15, 10), 97, 1900))
+	builder.OnTick(tick(at(9, 16, 2), 104, 2100))
+	// The 09:15 minute bar is complete now.
+	builder.OnTick(tick(at(9, 15, 40), 90, 2050))
+
+	if late != 3 {
+		t.Errorf("Expected the pre-open tick for both intervals and the tick after completion to be late, got %d", late)
+	}
+	if len(bars) != 1 {
+		t.Fatalf("Expected one completed bar, got %+v", bars)
+	}
+	bar := bars[0]
+	if !bar.Start.Equal(at(9, 15, 0)) || bar.Interval != time.Minute {
+		t.Errorf("Unexpected bar start %v", bar.Start)
+	}
+	if bar.Open != 100 || bar.High != 102 || bar.Low != 97 || bar.Close != 101 || bar.Ticks != 5 {
+		t.Errorf("Unexpected bar %+v", bar)
+	}
+	// The volume before the first tick is unknown, then 500 + 300 are traded.
+	if bar.Volume != 800 {
+		t.Errorf("Expected volume 800, got %d", bar.Volume)
+	}
+
+	current, ok := builder.Current(websocket.NSE_CM, "3045", 15*time.Minute)
+	if !ok || !current.Start.Equal(at(9, 15, 0)) || current.High != 104 || current.Low != 90 {
+		t.Errorf("Unexpected 15 minute bar %+v", current)
+	}
+
+	builder.Flush(at(9, 30, 2))
+	if len(bars) != 3 || bars[1].Interval != time.Minute || bars[2].Interval != 15*time.Minute {
+		t.Fatalf("Expected flush to complete the 09:16 and 09:15 bars, got %+v", bars)
+	}
+	if bars[2].Volume != 1100 {
+		t.Errorf("Expected 15 minute volume of 1100, got %d", bars[2].Volume)
+	}
+}
+
+func TestSessionAlignment(t *testing.T) {
+	builder := NewBuilder(15 * time.Minute)
+	builder.OnTick(tick(at(10, 1, 0), 100, 0))
+	if bar, _ := builder.Current(websocket.NSE_CM, "3045", 15*time.Minute); !bar.Start.Equal(at(10, 0, 0)) {
+		t.Errorf("Expected NSE bar to start at 10:00, got %v", bar.Start)
+	}
+
+	mcx := tick(at(10, 1, 0), 100, 0)
+	mcx.ExchangeType = websocket.MCX_FO
+	builder.SetSessionStart(websocket.MCX_FO, 9, 5)
+	builder.OnTick(mcx)
+	if bar, _ := builder.Current(websocket.MCX_FO, "3045", 15*time.Minute); !bar.Start.Equal(at(9, 50, 0)) {
+		t.Errorf("Expected MCX bar to start at 09:50, got %v", bar.Start)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	builder := NewBuilder(time.Minute)
+	builder.SetHistorySize(3)
+	var candles []smartapigo.Candle
+	for i := 0; i < 5; i++ {
+		candles = append(candles, smartapigo.Candle{Time: at(9, 15+i, 0), Open: 100, High: 101, Low: 99, Close: 100, Volume: 10})
+	}
+	builder.Seed(websocket.NSE_CM, "3045", time.Minute, candles)
+
+	late := 0
+	builder.OnLateTick(func(tick websocket.ParsedData, interval time.Duration) { late++ })
+	builder.OnTick(tick(at(9, 19, 30), 100, 0))
+	builder.OnTick(tick(at(9, 20, 30), 100, 0))
+	builder.Flush(at(9, 22, 0))
+
+	bars := builder.Bars(websocket.NSE_CM, "3045", time.Minute)
+	if late != 1 || len(bars) != 3 {
+		t.Fatalf("Expected one late tick and three bars, got %d and %+v", late, bars)
+	}
+	if !bars[0].Start.Equal(at(9, 18, 0)) || !bars[2].Start.Equal(at(9, 20, 0)) || bars[2].Ticks != 1 {
+		t.Errorf("Unexpected history %+v", bars)
+	}
+}
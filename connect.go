@@ -6,6 +6,8 @@ import (
 	_ "fmt"
 	"net/http"
 	"time"
+
+	"github.com/piyushpatil22/smartapigo/metrics"
 )
 
 // Client represents interface for Kite Connect client.
@@ -16,7 +18,15 @@ type Client struct {
 	debug       bool
 	baseURI     string
 	apiKey      string
+	localIP     string
+	publicIP    string
+	macAddress  string
 	httpClient  HTTPClient
+
+	freezeQuantities map[string]int
+	journal          Journal
+	middlewares      []registeredMiddleware
+	metrics          metrics.Metrics
 }
 
 const (
@@ -25,8 +35,8 @@ const (
 	baseURI        string        = "https://apiconnect.angelbroking.com/"
 )
 
-// New creates a new Smart API client.
-func New(clientCode string, password string, apiKey string) *Client {
+// New creates a new Smart API client configured with options.
+func New(clientCode string, password string, apiKey string, options ...Option) *Client {
 	client := &Client{
 		clientCode: clientCode,
 		password:   password,
@@ -40,13 +50,19 @@ func New(clientCode string, password string, apiKey string) *Client {
 		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
 	})
 
+	for _, option := range options {
+		option(client)
+	}
 	return client
 }
 
 // SetHTTPClient overrides default http handler with a custom one.
 // This can be used to set custom timeouts and transport.
+// Registered middlewares and metrics are kept.
 func (c *Client) SetHTTPClient(h *http.Client) {
 	c.httpClient = NewHTTPClient(h, nil, c.debug)
+	c.httpClient.GetClient().middlewares = append([]registeredMiddleware(nil), c.middlewares...)
+	c.httpClient.GetClient().metrics = c.metrics
 }
 
 // SetDebug sets debug mode to enable HTTP logs.
@@ -66,6 +82,14 @@ func (c *Client) SetTimeout(timeout time.Duration) {
 	hClient.Timeout = timeout
 }
 
+// SetMachineInfo sets the local IP, public IP and MAC address sent with every request
+// instead of detecting them, which requires a lookup over the internet.
+func (c *Client) SetMachineInfo(localIP, publicIP, macAddress string) {
+	c.localIP = localIP
+	c.publicIP = publicIP
+	c.macAddress = macAddress
+}
+
 // SetAccessToken sets the access token to the Kite Connect instance.
 func (c *Client) SetAccessToken(accessToken string) {
 	c.accessToken = accessToken
@@ -81,10 +105,13 @@ func (c *Client) doEnvelope(method, uri string, params map[string]interface{}, h
 		headers = map[string][]string{}
 	}
 
-	localIp, publicIp, mac, err := getIpAndMac()
-
-	if err != nil {
-		return err
+	localIp, publicIp, mac := c.localIP, c.publicIP, c.macAddress
+	if localIp == "" || publicIp == "" || mac == "" {
+		var err error
+		localIp, publicIp, mac, err = getIpAndMac()
+		if err != nil {
+			return err
+		}
 	}
 
 	// Add Kite Connect version to header
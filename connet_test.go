@@ -3,6 +3,7 @@ package smartapigo
 import (
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"path"
 	"reflect"
@@ -127,6 +128,8 @@ var MockResponders = [][]string{
 	[]string{http.MethodPost, URIUserProfile, "profile.json"},
 	[]string{http.MethodPost, URILogout, "logout.json"},
 	[]string{http.MethodPost, URIConvertPosition, "position_conversion.json"},
+	[]string{http.MethodPost, URICandleData, "candles.json"},
+	[]string{http.MethodPost, URIMargin, "margin.json"},
 
 }
 
@@ -145,6 +148,7 @@ func (ts *TestSuite) SetupAPITestSuit() {
 	password := "test@444"
 	apiKey := "test_key"
 	ts.TestConnect = New(clientcode,password,apiKey)
+	ts.TestConnect.SetMachineInfo("192.168.1.2", "203.0.113.10", "00:00:5e:00:53:01")
 	httpmock.ActivateNonDefault(ts.TestConnect.httpClient.GetClient().client)
 
 	for _, v := range MockResponders {
@@ -215,3 +219,24 @@ func TestAPIMethods(t *testing.T) {
 	RunAPITests(t, s)
 }
 
+
+// newMockServer starts a server answering with the mock order response, unless
+// handle, when set, reports that it wrote the response itself. It returns a
+// client with the given options pointed at the server.
+func newMockServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request) bool, options ...Option) (*Client, *httptest.Server) {
+	response, err := ioutil.ReadFile(path.Join(mockBaseDir, "order_response.json"))
+	if err != nil {
+		t.Fatalf("Error reading mock response. %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil && handle(w, r) {
+			return
+		}
+		w.Write(response)
+	}))
+
+	client := New("test", "test@444", "test_key", options...)
+	client.SetBaseURI(server.URL + "/")
+	client.SetMachineInfo("192.168.1.2", "203.0.113.10", "00:00:5e:00:53:01")
+	return client, server
+}
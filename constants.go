@@ -3,9 +3,56 @@ package smartapigo
 import "fmt"
 
 const (
-	NSE = "NSE"
-	NFO = "NFO"
-	BSE = "BSE"
+	NSE   = "NSE"
+	NFO   = "NFO"
+	BSE   = "BSE"
+	BFO   = "BFO"
+	MCX   = "MCX"
+	CDS   = "CDS"
+	NCDEX = "NCDEX"
+)
+
+// Order varieties.
+const (
+	VarietyNormal   = "NORMAL"
+	VarietyStopLoss = "STOPLOSS"
+	VarietyAMO      = "AMO"
+	VarietyRobo     = "ROBO"
+)
+
+// Order types.
+const (
+	OrderTypeMarket         = "MARKET"
+	OrderTypeLimit          = "LIMIT"
+	OrderTypeStopLossLimit  = "STOPLOSS_LIMIT"
+	OrderTypeStopLossMarket = "STOPLOSS_MARKET"
+)
+
+// Product types.
+const (
+	ProductTypeDelivery     = "DELIVERY"
+	ProductTypeCarryForward = "CARRYFORWARD"
+	ProductTypeMargin       = "MARGIN"
+	ProductTypeIntraday     = "INTRADAY"
+	ProductTypeBracket      = "BO"
+)
+
+// Order statuses reported in the order book.
+const (
+	OrderStatusOpen           = "open"
+	OrderStatusComplete       = "complete"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusRejected       = "rejected"
+	OrderStatusTriggerPending = "trigger pending"
+)
+
+// Transaction types and order durations.
+const (
+	TransactionTypeBuy  = "BUY"
+	TransactionTypeSell = "SELL"
+
+	DurationDay = "DAY"
+	DurationIOC = "IOC"
 )
 
 var (
@@ -0,0 +1,162 @@
+package smartapigo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NetQuantity returns the net quantity of a position, negative when short.
+func (p Position) NetQuantity() int {
+	quantity, _ := strconv.Atoi(p.NetQty)
+	return quantity
+}
+
+// ExitOrders returns the market orders closing a position, split so that no order
+// exceeds freezeQuantity rounded down to the lot size. A freezeQuantity of 0 closes
+// the position with a single order. It fails if the net quantity is not a multiple
+// of the lot size.
+func (p Position) ExitOrders(freezeQuantity int) ([]OrderParams, error) {
+	quantity := p.NetQuantity()
+	transactionType := TransactionTypeSell
+	if quantity < 0 {
+		quantity, transactionType = -quantity, TransactionTypeBuy
+	}
+	if quantity == 0 {
+		return nil, nil
+	}
+	lotSize, _ := strconv.Atoi(p.LotSize)
+	if lotSize <= 0 {
+		lotSize = 1
+	}
+	if quantity%lotSize != 0 {
+		return nil, fmt.Errorf("%w: net quantity %d of %s is not a multiple of the lot size %d", ErrInvalidOrderParams, quantity, p.Tradingsymbol, lotSize)
+	}
+	slice := quantity
+	if freezeQuantity > 0 {
+		slice = freezeQuantity / lotSize * lotSize
+		if slice == 0 {
+			return nil, fmt.Errorf("%w: freeze quantity %d of %s is below the lot size %d", ErrInvalidOrderParams, freezeQuantity, p.Tradingsymbol, lotSize)
+		}
+	}
+
+	var orders []OrderParams
+	for quantity > 0 {
+		if slice > quantity {
+			slice = quantity
+		}
+		orders = append(orders, OrderParams{
+			Variety:         VarietyNormal,
+			TradingSymbol:   p.Tradingsymbol,
+			SymbolToken:     p.SymbolToken,
+			TransactionType: transactionType,
+			Exchange:        p.Exchange,
+			OrderType:       OrderTypeMarket,
+			ProductType:     p.ProductType,
+			Duration:        DurationDay,
+			Price:           "0",
+			TriggerPrice:    "0",
+			SquareOff:       "0",
+			StopLoss:        "0",
+			Quantity:        strconv.Itoa(slice),
+		})
+		quantity -= slice
+	}
+	return orders, nil
+}
+
+// ExitPosition closes a position with the orders of Position.ExitOrders.
+func ExitPosition(orders OrderService, position Position, freezeQuantity int) ([]OrderResponse, error) {
+	exits, err := position.ExitOrders(freezeQuantity)
+	if err != nil {
+		return nil, err
+	}
+	var responses []OrderResponse
+	for _, exit := range exits {
+		response, err := orders.PlaceOrder(exit)
+		if err != nil {
+			return responses, fmt.Errorf("exiting %s: %w", position.Tradingsymbol, err)
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// ExitAllPositions closes the open positions of GetPositions matching filter, or all
+// of them if filter is nil. freezeQuantities are the freeze quantities by symbol name.
+// A failure doesn't stop the other positions from being closed, the first one is
+// returned.
+func ExitAllPositions(broker Broker, filter func(position Position) bool, freezeQuantities map[string]int) ([]OrderResponse, error) {
+	positions, err := broker.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	var responses []OrderResponse
+	var firstErr error
+	for _, position := range positions {
+		if position.NetQuantity() == 0 || (filter != nil && !filter(position)) {
+			continue
+		}
+		exited, err := ExitPosition(broker, position, freezeQuantities[position.SymbolName])
+		responses = append(responses, exited...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return responses, firstErr
+}
+
+// CancelAllOrders cancels the open orders of the order book matching filter, or all
+// of them if filter is nil. A failure doesn't stop the other orders from being
+// cancelled, the first one is returned.
+func CancelAllOrders(orders OrderService, filter func(order Order) bool) ([]OrderResponse, error) {
+	book, err := orders.GetOrderBook()
+	if err != nil {
+		return nil, err
+	}
+	var responses []OrderResponse
+	var firstErr error
+	for _, order := range book {
+		if !order.IsOpen() || (filter != nil && !filter(order)) {
+			continue
+		}
+		variety := order.Variety
+		if variety == "" {
+			variety = VarietyNormal
+		}
+		response, err := orders.CancelOrder(variety, order.OrderID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("cancelling order %s: %w", order.OrderID, err)
+			}
+			continue
+		}
+		responses = append(responses, response)
+	}
+	return responses, firstErr
+}
+
+// SetFreezeQuantity sets the largest quantity of an order of an underlying, such as
+// NIFTY, beyond which ExitPosition and ExitAllPositions split their orders.
+func (c *Client) SetFreezeQuantity(symbolName string, quantity int) {
+	if c.freezeQuantities == nil {
+		c.freezeQuantities = make(map[string]int)
+	}
+	c.freezeQuantities[symbolName] = quantity
+}
+
+// ExitPosition closes a position, see the ExitPosition function.
+func (c *Client) ExitPosition(position Position) ([]OrderResponse, error) {
+	return ExitPosition(c, position, c.freezeQuantities[position.SymbolName])
+}
+
+// ExitAllPositions closes the open positions matching filter, see the
+// ExitAllPositions function.
+func (c *Client) ExitAllPositions(filter func(position Position) bool) ([]OrderResponse, error) {
+	return ExitAllPositions(c, filter, c.freezeQuantities)
+}
+
+// CancelAllOrders cancels the open orders matching filter, see the CancelAllOrders
+// function.
+func (c *Client) CancelAllOrders(filter func(order Order) bool) ([]OrderResponse, error) {
+	return CancelAllOrders(c, filter)
+}
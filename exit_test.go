@@ -0,0 +1,62 @@
+package smartapigo
+
+import (
+	"errors"
+	"testing"
+)
+
+func position(symbolName, tradingSymbol, productType, netQuantity, lotSize string) Position {
+	return Position{Exchange: NFO, SymbolToken: "1", SymbolName: symbolName, Tradingsymbol: tradingSymbol, ProductType: productType, NetQty: netQuantity, LotSize: lotSize}
+}
+
+func TestExitOrders(t *testing.T) {
+	exits, err := position("NIFTY", "NIFTY24MAR22000CE", ProductTypeCarryForward, "-3700", "50").ExitOrders(1820)
+	if err != nil || len(exits) != 3 {
+		t.Fatalf("Expected 3 orders, got %+v. %v", exits, err)
+	}
+	for i, quantity := range []string{"1800", "1800", "100"} {
+		if exit := exits[i]; exit.Quantity != quantity || exit.TransactionType != TransactionTypeBuy || exit.ProductType != ProductTypeCarryForward || exit.Validate() != nil {
+			t.Errorf("Unexpected exit %d %+v", i, exit)
+		}
+	}
+
+	if exits, err := position("SBIN", "SBIN-EQ", ProductTypeIntraday, "7", "1").ExitOrders(0); err != nil || len(exits) != 1 || exits[0].TransactionType != TransactionTypeSell {
+		t.Errorf("Expected a single sell, got %+v. %v", exits, err)
+	}
+	if exits, err := position("SBIN", "SBIN-EQ", ProductTypeIntraday, "0", "1").ExitOrders(0); err != nil || exits != nil {
+		t.Errorf("Expected no exit of a flat position, got %+v. %v", exits, err)
+	}
+	if _, err := position("NIFTY", "NIFTY24MAR22000CE", ProductTypeCarryForward, "75", "50").ExitOrders(0); !errors.Is(err, ErrInvalidOrderParams) {
+		t.Errorf("Expected an odd lot to be rejected, got %v", err)
+	}
+}
+
+func TestExitAllPositions(t *testing.T) {
+	broker := &basketBroker{positions: Positions{
+		position("NIFTY", "NIFTY24MAR22000CE", ProductTypeIntraday, "100", "50"),
+		position("NIFTY", "NIFTY24MAR22000PE", ProductTypeIntraday, "0", "50"),
+		position("BANKNIFTY", "BANKNIFTY24MAR46000CE", ProductTypeIntraday, "-45", "15"),
+		position("SBIN", "SBIN-EQ", ProductTypeDelivery, "10", "1"),
+	}}
+	intraday := func(position Position) bool { return position.ProductType == ProductTypeIntraday }
+	responses, err := ExitAllPositions(broker, intraday, map[string]int{"NIFTY": 50})
+	if err != nil || len(responses) != 3 {
+		t.Fatalf("Expected 3 exit orders, got %+v. %v", responses, err)
+	}
+	if broker.orders[2].TradingSymbol != "BANKNIFTY24MAR46000CE" || broker.orders[2].TransactionType != TransactionTypeBuy || broker.orders[2].Quantity != "45" {
+		t.Errorf("Unexpected exit %+v", broker.orders[2])
+	}
+}
+
+func TestCancelAllOrders(t *testing.T) {
+	broker := &basketBroker{orders: Orders{
+		{OrderID: "1", Status: "open", ProductType: ProductTypeIntraday},
+		{OrderID: "2", Status: "complete", ProductType: ProductTypeIntraday},
+		{OrderID: "3", Status: "trigger pending", ProductType: ProductTypeIntraday},
+		{OrderID: "4", Status: "open", ProductType: ProductTypeDelivery},
+	}}
+	intraday := func(order Order) bool { return order.ProductType == ProductTypeIntraday }
+	if _, err := CancelAllOrders(broker, intraday); err != nil || len(broker.cancelled) != 2 || broker.cancelled[1] != "3" {
+		t.Errorf("Expected the open intraday orders to be cancelled, got %v. %v", broker.cancelled, err)
+	}
+}
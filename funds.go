@@ -26,3 +26,42 @@ func (c *Client) GetRMS() (RMS, error) {
 	err := c.doEnvelope(http.MethodGet, URIRMS, nil, nil, &rms, true)
 	return rms, err
 }
+
+// MarginPosition is a position to compute the margin of.
+type MarginPosition struct {
+	Exchange    string  `json:"exchange"`
+	Quantity    int     `json:"qty"`
+	Price       float64 `json:"price"`
+	ProductType string  `json:"productType"`
+	Token       string  `json:"token"`
+	TradeType   string  `json:"tradeType"`
+	OrderType   string  `json:"orderType"`
+}
+
+// MarginParams represents parameters for computing the combined margin of positions.
+type MarginParams struct {
+	Positions []MarginPosition `json:"positions"`
+}
+
+// MarginComponents is the breakdown of a margin requirement.
+type MarginComponents struct {
+	NetPremium     float64 `json:"netPremium"`
+	SpanMargin     float64 `json:"spanMargin"`
+	MarginBenefit  float64 `json:"marginBenefit"`
+	DeliveryMargin float64 `json:"deliveryMargin"`
+}
+
+// Margin represents the margin required by a set of positions.
+type Margin struct {
+	TotalMarginRequired float64          `json:"totalMarginRequired"`
+	MarginComponents    MarginComponents `json:"marginComponents"`
+}
+
+// GetMarginRequired gets the combined margin required by positions, taking hedges
+// between them into account.
+func (c *Client) GetMarginRequired(marginParams MarginParams) (Margin, error) {
+	var margin Margin
+	params := structToMap(marginParams, "json")
+	err := c.doEnvelope(http.MethodPost, URIMargin, params, nil, &margin, true)
+	return margin, err
+}
@@ -16,3 +16,19 @@ func (ts *TestSuite) TestGetRMS(t *testing.T) {
 	}
 
 }
+
+func (ts *TestSuite) TestGetMarginRequired(t *testing.T) {
+	t.Parallel()
+	params := MarginParams{Positions: []MarginPosition{
+		{Exchange: NFO, Quantity: 50, Price: 0, ProductType: "INTRADAY", Token: "67300", TradeType: "BUY", OrderType: "MARKET"},
+		{Exchange: NFO, Quantity: 50, Price: 0, ProductType: "INTRADAY", Token: "67308", TradeType: "SELL", OrderType: "MARKET"},
+	}}
+	margin, err := ts.TestConnect.GetMarginRequired(params)
+	if err != nil {
+		t.Errorf("Error while fetching margin. %v", err)
+	}
+
+	if margin.TotalMarginRequired != 29612.35 || margin.MarginComponents.NetPremium != 5060 {
+		t.Errorf("Error while parsing margin. %+v", margin)
+	}
+}
@@ -0,0 +1,77 @@
+package smartapigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Candle intervals supported by GetCandleData.
+const (
+	IntervalOneMinute     = "ONE_MINUTE"
+	IntervalThreeMinute   = "THREE_MINUTE"
+	IntervalFiveMinute    = "FIVE_MINUTE"
+	IntervalTenMinute     = "TEN_MINUTE"
+	IntervalFifteenMinute = "FIFTEEN_MINUTE"
+	IntervalThirtyMinute  = "THIRTY_MINUTE"
+	IntervalOneHour       = "ONE_HOUR"
+	IntervalOneDay        = "ONE_DAY"
+
+	// Layout of CandleParams.FromDate and CandleParams.ToDate.
+	CandleDateLayout = "2006-01-02 15:04"
+)
+
+// CandleParams represents parameters for getting historical candles.
+type CandleParams struct {
+	Exchange    string `json:"exchange"`
+	SymbolToken string `json:"symboltoken"`
+	Interval    string `json:"interval"`
+	FromDate    string `json:"fromdate"`
+	ToDate      string `json:"todate"`
+}
+
+// Candle represents an OHLCV candle.
+type Candle struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+}
+
+// UnmarshalJSON decodes a candle from the [timestamp, open, high, low, close, volume]
+// array returned by the API.
+func (c *Candle) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 6 {
+		return fmt.Errorf("invalid candle %s: expected 6 fields", data)
+	}
+	var timestamp string
+	if err := json.Unmarshal(fields[0], &timestamp); err != nil {
+		return err
+	}
+	t, err := time.Parse("2006-01-02T15:04:05Z07:00", timestamp)
+	if err != nil {
+		return err
+	}
+	c.Time = t
+	for i, v := range []interface{}{&c.Open, &c.High, &c.Low, &c.Close, &c.Volume} {
+		if err := json.Unmarshal(fields[i+1], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCandleData gets historical candles of an instrument.
+func (c *Client) GetCandleData(candleParams CandleParams) ([]Candle, error) {
+	var candles []Candle
+	params := structToMap(candleParams, "json")
+	err := c.doEnvelope(http.MethodPost, URICandleData, params, nil, &candles, true)
+	return candles, err
+}
@@ -0,0 +1,28 @@
+package smartapigo
+
+import (
+	"testing"
+)
+
+func (ts *TestSuite) TestGetCandleData(t *testing.T) {
+	t.Parallel()
+	params := CandleParams{
+		Exchange:    "NSE",
+		SymbolToken: "3045",
+		Interval:    IntervalFiveMinute,
+		FromDate:    "2023-09-06 11:15",
+		ToDate:      "2023-09-06 11:25",
+	}
+	candles, err := ts.TestConnect.GetCandleData(params)
+	if err != nil {
+		t.Errorf("Error while fetching candle data. %v", err)
+	}
+
+	if len(candles) != 2 || candles[0].High != 592 || candles[1].Volume != 98000 {
+		t.Errorf("Error while parsing candle data. %+v", candles)
+	}
+
+	if candles[0].Time.Format(CandleDateLayout) != "2023-09-06 11:15" {
+		t.Errorf("Error while parsing candle timestamp. %v", candles[0].Time)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/piyushpatil22/smartapigo/metrics"
 )
 
 // HTTPClient represents an HTTP client.
@@ -20,9 +22,11 @@ type HTTPClient interface {
 
 // httpClient is the default implementation of HTTPClient.
 type httpClient struct {
-	client *http.Client
-	hLog   *log.Logger
-	debug  bool
+	client      *http.Client
+	hLog        *log.Logger
+	debug       bool
+	middlewares []registeredMiddleware
+	metrics     metrics.Metrics
 }
 
 // HTTPResponse encompasses byte body  + the response of an HTTP request.
@@ -104,22 +108,26 @@ func (h *httpClient) Do(method, rURL string, params map[string]interface{}, head
 	//	req.URL.RawQuery = params.Encode()
 	//}
 
-	r, err := h.client.Do(req)
+	start := time.Now()
+	r, err := h.roundTrip(req)
 	if err != nil {
 		h.hLog.Printf("Request failed: %v", err)
+		h.observe(req, resp, start, err)
 		return resp, err
 	}
 
 	defer r.Body.Close()
+	resp.Response = r
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.hLog.Printf("Unable to read response: %v", err)
+		h.observe(req, resp, start, err)
 		return resp, err
 	}
 
-	resp.Response = r
 	resp.Body = body
+	h.observe(req, resp, start, nil)
 	if h.debug {
 		h.hLog.Printf("%s %s -- %d %v", method, req.URL.RequestURI(), resp.Response.StatusCode, req.Header)
 	}
@@ -142,6 +150,7 @@ func (h *httpClient) DoEnvelope(method, url string, params map[string]interface{
 			return err
 		}
 
+		h.observeAPIError(resp, e.ErrorCode)
 		return NewError(e.ErrorCode, e.Message, e.Data)
 	}
 
@@ -155,6 +164,7 @@ func (h *httpClient) DoEnvelope(method, url string, params map[string]interface{
 	}
 
 	if !envl.Status {
+		h.observeAPIError(resp, envl.ErrorCode)
 		return NewError(envl.ErrorCode, envl.Message, envl.Data)
 	}
 
@@ -0,0 +1,124 @@
+package smartapigo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// Default number of times an order is re-sent after an ambiguous failure.
+	DefaultIdempotentRetries = 2
+	// Default wait before looking up the order book after an ambiguous failure.
+	DefaultIdempotentLookupDelay = time.Second
+)
+
+// ErrOrderStatusUnknown is returned when placing an order failed ambiguously and the
+// order book could not be checked, so the order may or may not have been placed.
+var ErrOrderStatusUnknown = fmt.Errorf("order status unknown")
+
+// IdempotentOrders places orders so that retries never duplicate them. Every order is
+// given a unique tag, and when placing it fails without a response from the API, such
+// as on a timeout, the order book is searched for the tag before the order is re-sent.
+// Other methods are passed through to the wrapped OrderService.
+type IdempotentOrders struct {
+	OrderService
+	retries     int
+	lookupDelay time.Duration
+	newTag      func() string
+}
+
+// NewIdempotentOrders wraps orders, usually a Client, with idempotent placement.
+func NewIdempotentOrders(orders OrderService) *IdempotentOrders {
+	return &IdempotentOrders{
+		OrderService: orders,
+		retries:      DefaultIdempotentRetries,
+		lookupDelay:  DefaultIdempotentLookupDelay,
+		newTag:       NewOrderTag,
+	}
+}
+
+// SetRetries sets how many times an order not found in the order book is re-sent.
+func (o *IdempotentOrders) SetRetries(retries int) {
+	o.retries = retries
+}
+
+// SetLookupDelay sets the wait before looking up the order book, giving the order
+// time to appear in it.
+func (o *IdempotentOrders) SetLookupDelay(delay time.Duration) {
+	o.lookupDelay = delay
+}
+
+// SetTagGenerator sets the function generating the tag of orders placed without one.
+func (o *IdempotentOrders) SetTagGenerator(newTag func() string) {
+	o.newTag = newTag
+}
+
+// NewOrderTag returns a random order tag of 16 hexadecimal characters.
+func NewOrderTag() string {
+	tag := make([]byte, 8)
+	if _, err := rand.Read(tag); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(tag)
+}
+
+// PlaceOrder places an order tagged with OrderTag, or a generated tag if it is empty.
+// After an ambiguous failure, the existing order with the tag is returned if it is in
+// the order book, otherwise the order is re-sent with the same tag.
+func (o *IdempotentOrders) PlaceOrder(orderParams OrderParams) (OrderResponse, error) {
+	if orderParams.OrderTag == "" {
+		orderParams.OrderTag = o.newTag()
+	}
+	for attempt := 0; ; attempt++ {
+		response, err := o.OrderService.PlaceOrder(orderParams)
+		if err == nil || !IsAmbiguousError(err) {
+			return response, err
+		}
+
+		time.Sleep(o.lookupDelay)
+		order, found, lookupErr := o.findTag(orderParams.OrderTag)
+		if lookupErr != nil {
+			return response, fmt.Errorf("%w: tag %s: %v (order book: %v)", ErrOrderStatusUnknown, orderParams.OrderTag, err, lookupErr)
+		}
+		if found {
+			return OrderResponse{Script: order.TradingSymbol, OrderID: order.OrderID, UniqueOrderID: order.UniqueOrderID}, nil
+		}
+		if attempt >= o.retries {
+			return response, err
+		}
+	}
+}
+
+func (o *IdempotentOrders) findTag(tag string) (Order, bool, error) {
+	orders, err := o.OrderService.GetOrderBook()
+	if err != nil {
+		return Order{}, false, err
+	}
+	for _, order := range orders {
+		if order.OrderTag == tag {
+			return order, true, nil
+		}
+	}
+	return Order{}, false, nil
+}
+
+// IsAmbiguousError reports whether a request failed in transport without a response
+// from the API, such as on a network error or timeout, so that it may have been
+// processed. API errors and orders rejected before they were sent are not ambiguous.
+func IsAmbiguousError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// Also matches the *url.Error of failed HTTP requests.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
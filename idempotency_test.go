@@ -0,0 +1,97 @@
+package smartapigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+var errTimeout = &net.OpError{Op: "read", Net: "tcp", Err: fmt.Errorf("i/o timeout")}
+
+// flakyOrders places the first lose orders but loses their response, and fails the
+// next drop orders before they are placed.
+type flakyOrders struct {
+	basketBroker
+	lose, drop int
+	calls      int
+}
+
+func (f *flakyOrders) PlaceOrder(orderParams OrderParams) (OrderResponse, error) {
+	f.calls++
+	if f.drop > 0 && f.lose == 0 {
+		f.drop--
+		return OrderResponse{}, errTimeout
+	}
+	f.orders = append(f.orders, Order{OrderID: fmt.Sprint(len(f.orders) + 1), TradingSymbol: orderParams.TradingSymbol, OrderTag: orderParams.OrderTag, Status: "open"})
+	if f.lose > 0 {
+		f.lose--
+		return OrderResponse{}, errTimeout
+	}
+	return OrderResponse{OrderID: f.orders[len(f.orders)-1].OrderID}, nil
+}
+
+func TestIdempotentOrders(t *testing.T) {
+	params := OrderParams{TradingSymbol: "SBIN-EQ", Quantity: "1"}
+	tests := []struct {
+		name      string
+		orders    *flakyOrders
+		tag       string
+		wantCalls int
+		wantErr   bool
+	}{
+		{"placed", &flakyOrders{}, "", 1, false},
+		{"response lost", &flakyOrders{lose: 1}, "", 1, false},
+		{"request lost", &flakyOrders{drop: 1}, "mytag", 2, false},
+		{"retries exhausted", &flakyOrders{drop: 3}, "", 3, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orders := NewIdempotentOrders(test.orders)
+			orders.SetLookupDelay(0)
+			orders.SetTagGenerator(func() string { return "generated" })
+			params.OrderTag = test.tag
+			response, err := orders.PlaceOrder(params)
+			if (err != nil) != test.wantErr || test.orders.calls != test.wantCalls {
+				t.Fatalf("Expected %d calls and error %v, got %d calls. %v", test.wantCalls, test.wantErr, test.orders.calls, err)
+			}
+			if test.wantErr {
+				return
+			}
+			if len(test.orders.orders) != 1 || response.OrderID != "1" {
+				t.Errorf("Expected a single order, got %+v", test.orders.orders)
+			}
+			wantTag := test.tag
+			if wantTag == "" {
+				wantTag = "generated"
+			}
+			if tag := test.orders.orders[0].OrderTag; tag != wantTag {
+				t.Errorf("Expected tag %q, got %q", wantTag, tag)
+			}
+		})
+	}
+}
+
+func TestIdempotentOrdersDefinitiveError(t *testing.T) {
+	broker := &basketBroker{failing: map[string]bool{"SBIN-EQ": true}}
+	orders := NewIdempotentOrders(broker)
+	orders.SetLookupDelay(0)
+	_, err := orders.PlaceOrder(OrderParams{TradingSymbol: "SBIN-EQ"})
+	var apiErr Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "AB1009" {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+	if IsAmbiguousError(err) || !IsAmbiguousError(errTimeout) {
+		t.Errorf("Expected only network errors to be ambiguous")
+	}
+	invalid := fmt.Errorf("%w: quantity", ErrInvalidOrderParams)
+	if IsAmbiguousError(invalid) || IsAmbiguousError(&json.SyntaxError{}) || !IsAmbiguousError(&url.Error{Op: "Post", Err: errTimeout}) || !IsAmbiguousError(context.DeadlineExceeded) {
+		t.Errorf("Expected only transport errors to be ambiguous")
+	}
+	if tag := NewOrderTag(); len(tag) != 16 || tag == NewOrderTag() {
+		t.Errorf("Expected unique 16 character tags, got %q", tag)
+	}
+}
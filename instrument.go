@@ -0,0 +1,71 @@
+package smartapigo
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo/metrics"
+)
+
+// Measurements of the REST API.
+const (
+	MetricRequestDuration = "smartapi_http_request_duration_seconds"
+	MetricResponses       = "smartapi_http_responses_total"
+	MetricTransportErrors = "smartapi_http_transport_errors_total"
+	MetricAPIErrors       = "smartapi_http_api_errors_total"
+	MetricRateLimited     = "smartapi_http_rate_limited_total"
+)
+
+// Body of the responses of requests beyond the rate limit of the API.
+var rateLimitMessage = []byte("exceeding access rate")
+
+// WithMetrics records measurements of the requests, see Client.SetMetrics.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(c *Client) {
+		c.SetMetrics(m)
+	}
+}
+
+// SetMetrics records the latency, status and API error code of every request by
+// endpoint to m, along with the requests failing before a response and those rejected
+// by the rate limit of the API. The client doesn't wait out the rate limit itself, so
+// rejections are counted instead of waits. A nil m stops recording.
+func (c *Client) SetMetrics(m metrics.Metrics) {
+	if m != nil {
+		metrics.Describe(m, MetricRequestDuration, "Latency of REST API requests by endpoint.")
+		metrics.Describe(m, MetricResponses, "REST API responses by endpoint and HTTP status.")
+		metrics.Describe(m, MetricTransportErrors, "REST API requests failed without a response by endpoint.")
+		metrics.Describe(m, MetricAPIErrors, "REST API error responses by endpoint and error code.")
+		metrics.Describe(m, MetricRateLimited, "REST API requests rejected by the rate limit by endpoint.")
+	}
+	c.metrics = m
+	c.httpClient.GetClient().metrics = m
+}
+
+// observe records a request and its response or error.
+func (h *httpClient) observe(req *http.Request, resp HTTPResponse, start time.Time, err error) {
+	if h.metrics == nil {
+		return
+	}
+	endpoint := RequestEndpoint(req)
+	h.metrics.Observe(MetricRequestDuration, metrics.Labels{"endpoint": endpoint, "method": req.Method}, time.Since(start).Seconds())
+	if resp.Response == nil {
+		h.metrics.Add(MetricTransportErrors, metrics.Labels{"endpoint": endpoint}, 1)
+		return
+	}
+	status := resp.Response.StatusCode
+	h.metrics.Add(MetricResponses, metrics.Labels{"endpoint": endpoint, "status": strconv.Itoa(status)}, 1)
+	if status == http.StatusTooManyRequests || (status == http.StatusForbidden && bytes.Contains(resp.Body, rateLimitMessage)) {
+		h.metrics.Add(MetricRateLimited, metrics.Labels{"endpoint": endpoint}, 1)
+	}
+}
+
+// observeAPIError records an error response of the API.
+func (h *httpClient) observeAPIError(resp HTTPResponse, code string) {
+	if h.metrics == nil || resp.Response == nil || resp.Response.Request == nil {
+		return
+	}
+	h.metrics.Add(MetricAPIErrors, metrics.Labels{"endpoint": RequestEndpoint(resp.Response.Request), "errorcode": code}, 1)
+}
@@ -0,0 +1,69 @@
+package smartapigo
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/piyushpatil22/smartapigo/metrics"
+)
+
+func TestClientMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	client, server := newMockServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		switch RequestEndpoint(r) {
+		case URIPlaceOrder:
+			return false
+		case URICancelOrder:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":false,"message":"Invalid order","errorcode":"AB1004","data":null}`))
+		case URIGetTradeBook:
+			// The connection drops before the body is complete.
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("{"))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Access denied because of exceeding access rate"))
+		}
+		return true
+	}, WithMetrics(registry))
+	defer server.Close()
+
+	if _, err := client.PlaceOrder(OrderParams{}); err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if _, err := client.CancelOrder("NORMAL", "1"); err == nil {
+		t.Fatalf("Expected an API error cancelling the order")
+	}
+	if _, err := client.GetOrderBook(); err == nil {
+		t.Fatalf("Expected an error beyond the rate limit")
+	}
+	if _, err := client.GetTradeBook(); err == nil {
+		t.Fatalf("Expected an error reading the response")
+	}
+	client.SetBaseURI("http://127.0.0.1:0/")
+	if _, err := client.GetPositions(); err == nil {
+		t.Fatalf("Expected a transport error")
+	}
+
+	var buffer strings.Builder
+	registry.WriteTo(&buffer)
+	output := buffer.String()
+	for _, line := range []string{
+		"# HELP " + MetricRequestDuration + " ",
+		MetricRequestDuration + `_count{endpoint="` + URIPlaceOrder + `",method="POST"} 1`,
+		MetricResponses + `{endpoint="` + URIPlaceOrder + `",status="200"} 1`,
+		MetricResponses + `{endpoint="` + URICancelOrder + `",status="400"} 1`,
+		MetricAPIErrors + `{endpoint="` + URICancelOrder + `",errorcode="AB1004"} 1`,
+		MetricRateLimited + `{endpoint="` + URIGetOrderBook + `"} 1`,
+		MetricTransportErrors + `{endpoint="` + URIGetPositions + `"} 1`,
+		MetricResponses + `{endpoint="` + URIGetTradeBook + `",status="200"} 1`,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in\n%s", line, output)
+		}
+	}
+	if strings.Contains(output, MetricTransportErrors+`{endpoint="`+URIGetTradeBook+`"}`) {
+		t.Errorf("Expected the truncated response not to count as a transport error in\n%s", output)
+	}
+}
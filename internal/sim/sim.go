@@ -0,0 +1,521 @@
+// Package sim simulates a trading account for the paper trading engine and the mock
+// REST server. Orders are matched against quotes, and fills update the trade book,
+// positions and funds. An Account is not safe for concurrent use.
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+)
+
+// TimeFormat is the format of order update times.
+const TimeFormat = "02-Jan-2006 15:04:05"
+
+var (
+	ErrInvalidQuantity        = fmt.Errorf("invalid quantity")
+	ErrInvalidTransactionType = fmt.Errorf("invalid transaction type")
+	ErrInvalidOrderType       = fmt.Errorf("invalid order type")
+	ErrInvalidPrice           = fmt.Errorf("invalid price")
+	ErrOrderNotPending        = fmt.Errorf("order not found or not pending")
+)
+
+// Quote is the latest market data of an instrument.
+type Quote struct {
+	LTP float64
+	// Best bid and ask, 0 if unknown.
+	Bid float64
+	Ask float64
+	// Time fills are reported at.
+	Time time.Time
+}
+
+// Charges are the costs deducted from funds for every executed order.
+type Charges struct {
+	PerOrder float64
+	Rate     float64
+}
+
+// Order is an order along with the fields needed to match it.
+type Order struct {
+	smartapigo.Order
+	limit   float64
+	trigger float64
+	size    int
+}
+
+// Limit returns the limit price of the order, 0 if none.
+func (o *Order) Limit() float64 {
+	return o.limit
+}
+
+// Size returns the quantity of the order.
+func (o *Order) Size() int {
+	return o.size
+}
+
+// Pending reports whether the order is open or waiting for its trigger.
+func (o *Order) Pending() bool {
+	return o.Status == smartapigo.OrderStatusOpen || o.Status == smartapigo.OrderStatusTriggerPending
+}
+
+// Reject marks the order rejected with the reason.
+func (o *Order) Reject(reason string) {
+	o.Status, o.OrderStatus = smartapigo.OrderStatusRejected, smartapigo.OrderStatusRejected
+	o.Text = reason
+}
+
+// IsMarket reports whether the order fills at the market price once triggered.
+func (o *Order) IsMarket() bool {
+	return o.OrderType == smartapigo.OrderTypeMarket || o.OrderType == smartapigo.OrderTypeStopLossMarket
+}
+
+// NewOrder validates params and creates an open order, or a trigger pending one for
+// stop-loss order types. The caller sets the order ID.
+func NewOrder(params smartapigo.OrderParams, now time.Time) (*Order, error) {
+	size, err := strconv.Atoi(params.Quantity)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("%w %q", ErrInvalidQuantity, params.Quantity)
+	}
+	if params.TransactionType != smartapigo.TransactionTypeBuy && params.TransactionType != smartapigo.TransactionTypeSell {
+		return nil, fmt.Errorf("%w %q", ErrInvalidTransactionType, params.TransactionType)
+	}
+	limit, err := parsePrice(params.Price)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidPrice, params.Price)
+	}
+	trigger, err := parsePrice(params.TriggerPrice)
+	if err != nil {
+		return nil, fmt.Errorf("%w: trigger price %q", ErrInvalidPrice, params.TriggerPrice)
+	}
+	status := smartapigo.OrderStatusOpen
+	switch params.OrderType {
+	case smartapigo.OrderTypeMarket:
+	case smartapigo.OrderTypeLimit:
+		if limit <= 0 {
+			return nil, fmt.Errorf("%w: LIMIT orders need a price", ErrInvalidPrice)
+		}
+	case smartapigo.OrderTypeStopLossLimit, smartapigo.OrderTypeStopLossMarket:
+		if trigger <= 0 || (params.OrderType == smartapigo.OrderTypeStopLossLimit && limit <= 0) {
+			return nil, fmt.Errorf("%w: %s orders need a trigger price", ErrInvalidPrice, params.OrderType)
+		}
+		status = smartapigo.OrderStatusTriggerPending
+	default:
+		return nil, fmt.Errorf("%w %q", ErrInvalidOrderType, params.OrderType)
+	}
+
+	return &Order{
+		Order: smartapigo.Order{
+			Variety:           params.Variety,
+			OrderType:         params.OrderType,
+			ProductType:       params.ProductType,
+			Duration:          params.Duration,
+			Price:             params.Price,
+			TriggerPrice:      params.TriggerPrice,
+			Quantity:          params.Quantity,
+			SquareOff:         params.SquareOff,
+			StopLoss:          params.StopLoss,
+			TrailingStopLoss:  params.TrailingStopLoss,
+			DisclosedQuantity: params.DisclosedQuantity,
+			OrderTag:          params.OrderTag,
+			TradingSymbol:     params.TradingSymbol,
+			TransactionType:   params.TransactionType,
+			Exchange:          params.Exchange,
+			SymbolToken:       params.SymbolToken,
+			LotSize:           "1",
+			AveragePrice:      "0",
+			FilledShares:      "0",
+			UnfilledShares:    params.Quantity,
+			Status:            status,
+			OrderStatus:       status,
+			UpdateTime:        now.Format(TimeFormat),
+		},
+		limit:   limit,
+		trigger: trigger,
+		size:    size,
+	}, nil
+}
+
+type instrumentKey struct {
+	exchange string
+	token    string
+}
+
+type positionKey struct {
+	instrumentKey
+	productType string
+}
+
+// position accumulates the fills of an instrument and product type.
+type position struct {
+	exchange      string
+	token         string
+	tradingSymbol string
+	productType   string
+	buyQuantity   int
+	sellQuantity  int
+	buyAmount     float64
+	sellAmount    float64
+	// Value of the short quantity, blocked as margin until it is covered.
+	blocked float64
+}
+
+// Account is the order book, trade book, positions and funds of a simulated account.
+type Account struct {
+	// Cash available, reduced by buys, margin blocked by short sells and charges.
+	Cash float64
+	// Charges deducted for every fill and their total so far.
+	Charges      Charges
+	TotalCharges float64
+	// Slippage applied against market fills as a fraction of the price.
+	Slippage float64
+
+	quote        func(exchange, token string) (Quote, bool)
+	orders       []*Order
+	trades       smartapigo.Trades
+	positions    map[positionKey]*position
+	positionKeys []positionKey
+	nextOrderID  int
+	nextFillID   int
+}
+
+// NewAccount creates an account with cash, matching orders against the quotes
+// returned by quote.
+func NewAccount(cash float64, quote func(exchange, token string) (Quote, bool)) *Account {
+	return &Account{
+		Cash:      cash,
+		quote:     quote,
+		positions: make(map[positionKey]*position),
+	}
+}
+
+// NextOrderID returns a sequence number for the next order ID, starting at 1.
+func (a *Account) NextOrderID() int {
+	a.nextOrderID++
+	return a.nextOrderID
+}
+
+// Add books an order and matches it right away.
+func (a *Account) Add(o *Order) {
+	a.orders = append(a.orders, o)
+	a.match(o)
+}
+
+// Find returns the order with the ID, nil if none.
+func (a *Account) Find(orderID string) *Order {
+	for _, o := range a.orders {
+		if o.OrderID == orderID {
+			return o
+		}
+	}
+	return nil
+}
+
+// Modify changes the order type, price, trigger price or quantity of a pending order
+// and matches it.
+func (a *Account) Modify(params smartapigo.ModifyOrderParams, now time.Time) (*Order, error) {
+	o := a.Find(params.OrderID)
+	if o == nil || !o.Pending() {
+		return nil, ErrOrderNotPending
+	}
+	if size, err := strconv.Atoi(params.Quantity); err == nil && size > 0 {
+		o.size = size
+		o.Quantity = params.Quantity
+		o.UnfilledShares = params.Quantity
+	}
+	if params.OrderType != "" {
+		o.OrderType = params.OrderType
+	}
+	if limit, err := strconv.ParseFloat(params.Price, 64); err == nil {
+		o.limit = limit
+		o.Price = params.Price
+	}
+	if trigger, err := strconv.ParseFloat(params.TriggerPrice, 64); err == nil {
+		o.trigger = trigger
+		o.TriggerPrice = params.TriggerPrice
+	}
+	o.UpdateTime = now.Format(TimeFormat)
+	a.match(o)
+	return o, nil
+}
+
+// Cancel cancels a pending order.
+func (a *Account) Cancel(orderID string, now time.Time) (*Order, error) {
+	o := a.Find(orderID)
+	if o == nil || !o.Pending() {
+		return nil, ErrOrderNotPending
+	}
+	o.Status, o.OrderStatus = smartapigo.OrderStatusCancelled, smartapigo.OrderStatusCancelled
+	o.CancelSize = o.Quantity
+	o.UpdateTime = now.Format(TimeFormat)
+	return o, nil
+}
+
+// Match matches the pending orders of an instrument against its quote and returns
+// the orders that changed.
+func (a *Account) Match(exchange, token string) []smartapigo.Order {
+	var updates []smartapigo.Order
+	for _, o := range a.orders {
+		if o.Exchange == exchange && o.SymbolToken == token && a.match(o) {
+			updates = append(updates, o.Order)
+		}
+	}
+	return updates
+}
+
+// Orders returns the order book.
+func (a *Account) Orders() smartapigo.Orders {
+	orders := make(smartapigo.Orders, 0, len(a.orders))
+	for _, o := range a.orders {
+		orders = append(orders, o.Order)
+	}
+	return orders
+}
+
+// Trades returns the trade book.
+func (a *Account) Trades() smartapigo.Trades {
+	return append(smartapigo.Trades{}, a.trades...)
+}
+
+// Covers reports whether the cash covers an order at the estimated price. Buys and
+// sells opening or increasing a short position need their value, quantity closing
+// a position needs nothing.
+func (a *Account) Covers(o *Order, price float64) bool {
+	net := a.net(o)
+	opened := o.size
+	if o.TransactionType == smartapigo.TransactionTypeBuy && net < 0 {
+		opened -= min(o.size, -net)
+	} else if o.TransactionType == smartapigo.TransactionTypeSell && net > 0 {
+		opened -= min(o.size, net)
+	}
+	return price*float64(opened) <= a.Cash
+}
+
+// net returns the net quantity of the position an order trades.
+func (a *Account) net(o *Order) int {
+	p, ok := a.positions[positionKey{instrumentKey{o.Exchange, o.SymbolToken}, o.ProductType}]
+	if !ok {
+		return 0
+	}
+	return p.buyQuantity - p.sellQuantity
+}
+
+// match triggers and fills a pending order if its quote allows and reports whether
+// the order changed.
+func (a *Account) match(o *Order) bool {
+	if !o.Pending() {
+		return false
+	}
+	q, ok := a.quote(o.Exchange, o.SymbolToken)
+	if !ok || q.LTP <= 0 {
+		return false
+	}
+	buy := o.TransactionType == smartapigo.TransactionTypeBuy
+
+	changed := false
+	if o.Status == smartapigo.OrderStatusTriggerPending {
+		if (buy && q.LTP < o.trigger) || (!buy && q.LTP > o.trigger) {
+			return false
+		}
+		o.Status, o.OrderStatus = smartapigo.OrderStatusOpen, smartapigo.OrderStatusOpen
+		changed = true
+	}
+
+	// Buy orders take the best ask and sell orders the best bid, falling back to the LTP.
+	reference := q.LTP
+	if buy && q.Ask > 0 {
+		reference = q.Ask
+	} else if !buy && q.Bid > 0 {
+		reference = q.Bid
+	}
+
+	if o.IsMarket() {
+		if buy {
+			reference *= 1 + a.Slippage
+		} else {
+			reference *= 1 - a.Slippage
+		}
+	} else if (buy && reference > o.limit) || (!buy && reference < o.limit) {
+		return changed
+	}
+	a.fill(o, reference, q.Time)
+	return true
+}
+
+// fill executes an order at the price.
+func (a *Account) fill(o *Order, price float64, at time.Time) {
+	a.nextFillID++
+	value := price * float64(o.size)
+	charges := a.Charges.PerOrder + a.Charges.Rate*value
+
+	o.Status, o.OrderStatus = smartapigo.OrderStatusComplete, smartapigo.OrderStatusComplete
+	o.AveragePrice = FormatFloat(price)
+	o.FilledShares = o.Quantity
+	o.UnfilledShares = "0"
+	o.FillID = strconv.Itoa(a.nextFillID)
+	o.FillTime = at.Format("15:04:05")
+	o.UpdateTime = at.Format(TimeFormat)
+
+	a.trades = append(a.trades, smartapigo.Trade{
+		Exchange:        o.Exchange,
+		ProductType:     o.ProductType,
+		TradingSymbol:   o.TradingSymbol,
+		MarketLot:       "1",
+		Multiplier:      "1",
+		TradeValue:      FormatFloat(value),
+		TransactionType: o.TransactionType,
+		FillPrice:       FormatFloat(price),
+		FillSize:        o.Quantity,
+		OrderID:         o.OrderID,
+		FillID:          o.FillID,
+		FillTime:        o.FillTime,
+	})
+
+	key := positionKey{instrumentKey{o.Exchange, o.SymbolToken}, o.ProductType}
+	p, ok := a.positions[key]
+	if !ok {
+		p = &position{exchange: o.Exchange, token: o.SymbolToken, tradingSymbol: o.TradingSymbol, productType: o.ProductType}
+		a.positions[key] = p
+		a.positionKeys = append(a.positionKeys, key)
+	}
+	// Selling short blocks the value as margin, held along with the proceeds until a
+	// buy covers it and both are released.
+	net := p.buyQuantity - p.sellQuantity
+	if o.TransactionType == smartapigo.TransactionTypeBuy {
+		if net < 0 {
+			released := p.blocked * float64(min(o.size, -net)) / float64(-net)
+			p.blocked -= released
+			a.Cash += 2 * released
+		}
+		p.buyQuantity += o.size
+		p.buyAmount += value
+		a.Cash -= value
+	} else {
+		closed := 0
+		if net > 0 {
+			closed = min(o.size, net)
+		}
+		opened := price * float64(o.size-closed)
+		p.blocked += opened
+		p.sellQuantity += o.size
+		p.sellAmount += value
+		a.Cash += price*float64(closed) - opened
+	}
+	a.Cash -= charges
+	a.TotalCharges += charges
+}
+
+// Positions returns the positions the way GetPositions reports them.
+func (a *Account) Positions() smartapigo.Positions {
+	positions := make(smartapigo.Positions, 0, len(a.positions))
+	for _, key := range a.positionKeys {
+		p := a.positions[key]
+		positions = append(positions, smartapigo.Position{
+			Exchange:         p.exchange,
+			SymbolToken:      p.token,
+			ProductType:      p.productType,
+			Tradingsymbol:    p.tradingSymbol,
+			Multiplier:       "1",
+			BoardLotSize:     "1",
+			LotSize:          "1",
+			PriceNum:         "1",
+			PriceDen:         "1",
+			GenNum:           "1",
+			GenDen:           "1",
+			BuyQuantity:      strconv.Itoa(p.buyQuantity),
+			SellQuantity:     strconv.Itoa(p.sellQuantity),
+			BuyAmount:        FormatFloat(p.buyAmount),
+			SellAmount:       FormatFloat(p.sellAmount),
+			BuyAveragePrice:  FormatFloat(average(p.buyAmount, p.buyQuantity)),
+			SellAveragePrice: FormatFloat(average(p.sellAmount, p.sellQuantity)),
+			NetQty:           strconv.Itoa(p.buyQuantity - p.sellQuantity),
+			NetValue:         FormatFloat(p.sellAmount - p.buyAmount),
+			TotalBuyValue:    FormatFloat(p.buyAmount),
+			TotalSellValue:   FormatFloat(p.sellAmount),
+		})
+	}
+	return positions
+}
+
+// RMS reports the cash along with the realized and unrealized M2M of all positions.
+// Charges paid are reported as utilised debits.
+func (a *Account) RMS() smartapigo.RMS {
+	var realized, unrealized float64
+	for key, p := range a.positions {
+		closed := p.buyQuantity
+		if p.sellQuantity < closed {
+			closed = p.sellQuantity
+		}
+		realized += float64(closed) * (average(p.sellAmount, p.sellQuantity) - average(p.buyAmount, p.buyQuantity))
+
+		if net := p.buyQuantity - p.sellQuantity; net != 0 {
+			if q, ok := a.quote(key.exchange, key.token); ok {
+				unrealized += float64(net) * (q.LTP - p.openPrice())
+			}
+		}
+	}
+	return smartapigo.RMS{
+		Net:                  FormatFloat(a.Cash),
+		AvailableCash:        FormatFloat(a.Cash),
+		AvailableLimitMargin: FormatFloat(a.Cash),
+		M2MRealized:          FormatFloat(realized),
+		M2MUnrealized:        FormatFloat(unrealized),
+		UtilisedDebits:       FormatFloat(a.TotalCharges),
+	}
+}
+
+// Equity returns the cash plus the open positions marked to their last price, along
+// with the margin and proceeds held for short positions.
+func (a *Account) Equity() float64 {
+	equity := a.Cash
+	for key, p := range a.positions {
+		equity += 2 * p.blocked
+		net := p.buyQuantity - p.sellQuantity
+		if net == 0 {
+			continue
+		}
+		price := p.openPrice()
+		if q, ok := a.quote(key.exchange, key.token); ok && q.LTP > 0 {
+			price = q.LTP
+		}
+		equity += float64(net) * price
+	}
+	return equity
+}
+
+// openPrice returns the average price of the open side of the position.
+func (p *position) openPrice() float64 {
+	if p.buyQuantity < p.sellQuantity {
+		return average(p.sellAmount, p.sellQuantity)
+	}
+	return average(p.buyAmount, p.buyQuantity)
+}
+
+// parsePrice parses an optional price param.
+func parsePrice(price string) (float64, error) {
+	if price == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(price, 64)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func average(amount float64, quantity int) float64 {
+	if quantity == 0 {
+		return 0
+	}
+	return amount / float64(quantity)
+}
+
+// FormatFloat formats amounts and prices with two decimals.
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
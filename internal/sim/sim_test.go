@@ -0,0 +1,110 @@
+package sim
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+)
+
+func params(transactionType, orderType, price, triggerPrice string) smartapigo.OrderParams {
+	return smartapigo.OrderParams{
+		Variety:         smartapigo.VarietyNormal,
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: transactionType,
+		Exchange:        smartapigo.NSE,
+		OrderType:       orderType,
+		ProductType:     smartapigo.ProductTypeIntraday,
+		Duration:        smartapigo.DurationDay,
+		Price:           price,
+		TriggerPrice:    triggerPrice,
+		Quantity:        "10",
+	}
+}
+
+func TestAccount(t *testing.T) {
+	quote := Quote{LTP: 500, Bid: 499, Ask: 501}
+	account := NewAccount(100000, func(exchange, token string) (Quote, bool) {
+		return quote, exchange == smartapigo.NSE && token == "3045"
+	})
+	account.Slippage = 0.001
+	account.Charges = Charges{PerOrder: 20}
+
+	if _, err := NewOrder(params("HOLD", smartapigo.OrderTypeMarket, "", ""), time.Now()); !errors.Is(err, ErrInvalidTransactionType) {
+		t.Errorf("Expected ErrInvalidTransactionType, got %v", err)
+	}
+	if _, err := NewOrder(params("BUY", smartapigo.OrderTypeStopLossLimit, "505", ""), time.Now()); !errors.Is(err, ErrInvalidPrice) {
+		t.Errorf("Expected ErrInvalidPrice, got %v", err)
+	}
+
+	// Market buys fill at the ask plus slippage.
+	buy, err := NewOrder(params("BUY", smartapigo.OrderTypeMarket, "", ""), time.Now())
+	if err != nil {
+		t.Fatalf("Error creating order. %v", err)
+	}
+	buy.OrderID = "1"
+	account.Add(buy)
+	if buy.Status != smartapigo.OrderStatusComplete || buy.AveragePrice != "501.50" {
+		t.Errorf("Expected a fill at 501.50, got %+v", buy.Order)
+	}
+
+	// Stop-loss sells wait for the trigger.
+	stop, _ := NewOrder(params("SELL", smartapigo.OrderTypeStopLossLimit, "494", "495"), time.Now())
+	stop.OrderID = "2"
+	account.Add(stop)
+	if stop.Status != smartapigo.OrderStatusTriggerPending || len(account.Match(smartapigo.NSE, "3045")) != 0 {
+		t.Errorf("Expected the stop-loss to wait for its trigger, got %+v", stop.Order)
+	}
+	quote = Quote{LTP: 495}
+	if updates := account.Match(smartapigo.NSE, "3045"); len(updates) != 1 || updates[0].AveragePrice != "495.00" {
+		t.Errorf("Expected the stop-loss to fill at 495, got %+v", updates)
+	}
+
+	rms := account.RMS()
+	if rms.M2MRealized != "-65.01" || rms.UtilisedDebits != "40.00" || rms.AvailableCash != "99894.99" {
+		t.Errorf("Unexpected RMS %+v", rms)
+	}
+	if _, err := account.Cancel("2", time.Now()); err != ErrOrderNotPending {
+		t.Errorf("Expected ErrOrderNotPending, got %v", err)
+	}
+}
+
+func TestShortSelling(t *testing.T) {
+	quote := Quote{LTP: 100}
+	account := NewAccount(10000, func(exchange, token string) (Quote, bool) {
+		return quote, true
+	})
+	order := func(transactionType, quantity string) *Order {
+		p := params(transactionType, smartapigo.OrderTypeMarket, "", "")
+		p.Quantity = quantity
+		o, err := NewOrder(p, time.Now())
+		if err != nil {
+			t.Fatalf("Error creating order. %v", err)
+		}
+		return o
+	}
+
+	// The short blocks its value, the proceeds are held until it is covered.
+	short := order("SELL", "50")
+	if !account.Covers(short, 100) {
+		t.Fatalf("Expected the cash to cover the short")
+	}
+	account.Add(short)
+	if account.Cash != 5000 || account.Equity() != 10000 {
+		t.Errorf("Expected 5000 cash and 10000 equity, got %v and %v", account.Cash, account.Equity())
+	}
+	if account.Covers(order("SELL", "60"), 100) {
+		t.Errorf("Expected the cash not to cover a larger short")
+	}
+	if !account.Covers(order("BUY", "50"), 1000) {
+		t.Errorf("Expected covering the short to need no cash")
+	}
+
+	quote = Quote{LTP: 90}
+	account.Add(order("BUY", "50"))
+	if account.Cash != 10500 || account.Equity() != 10500 {
+		t.Errorf("Expected the profit of 500 in cash, got %v cash and %v equity", account.Cash, account.Equity())
+	}
+}
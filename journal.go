@@ -0,0 +1,141 @@
+package smartapigo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Calls recorded in the journal.
+const (
+	JournalPlaceOrder  = "PlaceOrder"
+	JournalModifyOrder = "ModifyOrder"
+	JournalCancelOrder = "CancelOrder"
+	// Response is nil for ConvertPosition, which has none.
+	JournalConvertPosition = "ConvertPosition"
+)
+
+// Replacement of secrets in journal entries.
+const redacted = "[REDACTED]"
+
+// secretParams are the params never written to the journal, in lower case.
+var secretParams = map[string]bool{
+	"password":     true,
+	"totp":         true,
+	"refreshtoken": true,
+	"jwttoken":     true,
+	"accesstoken":  true,
+	"apikey":       true,
+}
+
+// JournalEntry is an order call and its outcome.
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+	Call string    `json:"call"`
+	// Params sent, with the values of secret params redacted.
+	Params   map[string]interface{} `json:"params"`
+	Response *OrderResponse         `json:"response,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	// Error code of API errors.
+	ErrorCode string `json:"errorcode,omitempty"`
+	// Latency of the call, in nanoseconds in JSON.
+	Latency time.Duration `json:"latency"`
+}
+
+// Journal is a sink of journal entries, such as a JSONL file or a database.
+type Journal interface {
+	Record(entry JournalEntry) error
+}
+
+// JSONLJournal writes journal entries to a writer as JSON lines.
+type JSONLJournal struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewJSONLJournal creates a journal writing to w.
+func NewJSONLJournal(w io.Writer) *JSONLJournal {
+	return &JSONLJournal{w: w}
+}
+
+// OpenJSONLJournal creates a journal appending to a file, created if needed.
+func OpenJSONLJournal(path string) (*JSONLJournal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLJournal(file), nil
+}
+
+// Record writes an entry on a line.
+func (j *JSONLJournal) Record(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_, err = j.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (j *JSONLJournal) Close() error {
+	if closer, ok := j.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SetJournal records every order placed, modified or cancelled and every position
+// converted with the client to journal. Failures to record are logged.
+func (c *Client) SetJournal(journal Journal) {
+	c.journal = journal
+}
+
+// record adds a call to the journal.
+func (c *Client) record(call string, start time.Time, params map[string]interface{}, response *OrderResponse, err error) {
+	if c.journal == nil {
+		return
+	}
+	entry := JournalEntry{
+		Time:    start,
+		Call:    call,
+		Params:  make(map[string]interface{}, len(params)),
+		Latency: time.Since(start),
+	}
+	// Params are redacted by key only, credentials such as a 4 digit MPIN would
+	// otherwise match tokens and prices.
+	for key, value := range params {
+		if secretParams[strings.ToLower(key)] {
+			value = redacted
+		}
+		entry.Params[key] = value
+	}
+	if err == nil {
+		entry.Response = response
+	} else {
+		entry.Error = c.redact(err.Error())
+		var apiErr Error
+		if errors.As(err, &apiErr) {
+			entry.ErrorCode = apiErr.Code
+		}
+	}
+	if err := c.journal.Record(entry); err != nil {
+		c.httpClient.GetClient().hLog.Printf("Error recording %s in the journal: %v", call, err)
+	}
+}
+
+// redact replaces the credentials of the client found in error text.
+func (c *Client) redact(s string) string {
+	for _, secret := range []string{c.password, c.apiKey, c.accessToken} {
+		if secret != "" {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
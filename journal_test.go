@@ -0,0 +1,66 @@
+package smartapigo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	client, server := newMockServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/"+URICancelOrder {
+			return false
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status": false, "message": "Invalid order id for key test_key", "errorcode": "AB1010"}`))
+		return true
+	})
+	defer server.Close()
+
+	// An MPIN matching the symbol token and part of the price.
+	client.password = "3045"
+	var buffer bytes.Buffer
+	client.SetJournal(NewJSONLJournal(&buffer))
+
+	params := OrderParams{"NORMAL", "SBIN-EQ", "3045", "BUY", "NSE", "LIMIT", "INTRADAY", "DAY", "13045", "0", "0", "0", "1", "0", "0", "tag"}
+	if _, err := client.PlaceOrder(params); err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if _, err := client.CancelOrder("NORMAL", "1"); err == nil {
+		t.Fatalf("Expected cancelling to fail")
+	}
+	if err := client.ConvertPosition(ConvertPositionParams{Exchange: "NSE", TradingSymbol: "SBIN-EQ", OldProductType: "INTRADAY", NewProductType: "DELIVERY", Quantity: 1, Type: "DAY"}); err != nil {
+		t.Fatalf("Error converting position. %v", err)
+	}
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Error decoding entry %s. %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	placed := entries[0]
+	if placed.Call != JournalPlaceOrder || placed.Params["tradingsymbol"] != "SBIN-EQ" || placed.Response == nil || placed.Response.OrderID != "201020000000080" || placed.Time.IsZero() || placed.Latency <= 0 {
+		t.Errorf("Unexpected entry %+v", placed)
+	}
+	if placed.Params["symboltoken"] != "3045" || placed.Params["price"] != "13045" {
+		t.Errorf("Expected params matching the password to be kept, got %v", placed.Params)
+	}
+	cancelled := entries[1]
+	if cancelled.Call != JournalCancelOrder || cancelled.ErrorCode != "AB1010" || cancelled.Error != "Invalid order id for key "+redacted || cancelled.Response != nil {
+		t.Errorf("Unexpected entry %+v", cancelled)
+	}
+	converted := entries[2]
+	if converted.Call != JournalConvertPosition || converted.Params["type"] != "DAY" || converted.Response != nil || converted.Error != "" {
+		t.Errorf("Unexpected entry %+v", converted)
+	}
+}
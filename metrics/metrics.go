@@ -0,0 +1,277 @@
+// Package metrics records measurements of the REST and websocket clients and exports
+// them in the Prometheus text format, without any external service.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_BUCKETS are the upper bounds of histogram buckets, in seconds for latencies.
+var DEFAULT_BUCKETS = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Labels are the dimensions of a measurement, such as the endpoint of a request.
+type Labels map[string]string
+
+// Metrics records measurements. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Add adds delta to a counter.
+	Add(name string, labels Labels, delta float64)
+	// Set sets a gauge.
+	Set(name string, labels Labels, value float64)
+	// Observe adds a value to a histogram.
+	Observe(name string, labels Labels, value float64)
+}
+
+// Describer is implemented by metrics accepting a description of their measurements.
+type Describer interface {
+	Describe(name, help string)
+}
+
+// Describe describes a measurement if m is a Describer.
+func Describe(m Metrics, name, help string) {
+	if describer, ok := m.(Describer); ok {
+		describer.Describe(name, help)
+	}
+}
+
+type kind int
+
+const (
+	counter kind = iota
+	gauge
+	histogram
+)
+
+func (k kind) String() string {
+	switch k {
+	case counter:
+		return "counter"
+	case gauge:
+		return "gauge"
+	}
+	return "histogram"
+}
+
+type family struct {
+	kind    kind
+	known   bool
+	help    string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labels string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+// Registry keeps measurements in memory and writes them in the Prometheus text
+// format. It is an http.Handler serving the measurements to a Prometheus scraper.
+type Registry struct {
+	families map[string]*family
+	mutex    sync.Mutex
+}
+
+var (
+	_ Metrics      = (*Registry)(nil)
+	_ Describer    = (*Registry)(nil)
+	_ http.Handler = (*Registry)(nil)
+)
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Describe sets the help text of a measurement.
+func (r *Registry) Describe(name, help string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.family(name).help = help
+}
+
+// SetBuckets sets the bucket upper bounds of a histogram, DEFAULT_BUCKETS by default.
+// It has no effect once the histogram is observed.
+func (r *Registry) SetBuckets(name string, buckets []float64) {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if f := r.family(name); len(f.series) == 0 {
+		f.buckets = buckets
+	}
+}
+
+// Add adds delta to a counter.
+func (r *Registry) Add(name string, labels Labels, delta float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.series(name, counter, labels); s != nil {
+		s.value += delta
+	}
+}
+
+// Set sets a gauge.
+func (r *Registry) Set(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.series(name, gauge, labels); s != nil {
+		s.value = value
+	}
+}
+
+// Observe adds a value to a histogram.
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.series(name, histogram, labels)
+	if s == nil {
+		return
+	}
+	buckets := r.families[name].buckets
+	if s.counts == nil {
+		s.counts = make([]uint64, len(buckets))
+	}
+	for i, bound := range buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+func (r *Registry) family(name string) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{buckets: DEFAULT_BUCKETS, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// series returns the series of a measurement, nil if the measurement is of another kind.
+func (r *Registry) series(name string, k kind, labels Labels) *series {
+	f := r.family(name)
+	if !f.known {
+		f.kind, f.known = k, true
+	} else if f.kind != k {
+		return nil
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteTo writes the measurements in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name, f := range r.families {
+		if f.known {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	counting := &countingWriter{w: w}
+	buffer := bufio.NewWriter(counting)
+	for _, name := range names {
+		f := r.families[name]
+		if f.help != "" {
+			fmt.Fprintf(buffer, "# HELP %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(f.help))
+		}
+		fmt.Fprintf(buffer, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogram {
+				fmt.Fprintf(buffer, "%s%s %s\n", name, braces(s.labels), formatValue(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, braces(join(s.labels, `le="`+formatValue(bound)+`"`)), s.counts[i])
+			}
+			fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, braces(join(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(buffer, "%s_sum%s %s\n", name, braces(s.labels), formatValue(s.value))
+			fmt.Fprintf(buffer, "%s_count%s %d\n", name, braces(s.labels), s.count)
+		}
+	}
+	err := buffer.Flush()
+	return counting.n, err
+}
+
+// ServeHTTP serves the measurements in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// formatLabels returns labels sorted by name as name="value" pairs.
+func formatLabels(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	escape := strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+escape.Replace(labels[name])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
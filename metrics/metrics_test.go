@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	registry := NewRegistry()
+	registry.Describe("requests_total", "Requests by endpoint.")
+	registry.SetBuckets("latency_seconds", []float64{1, 0.1})
+	registry.Add("requests_total", Labels{"endpoint": "b"}, 1)
+	registry.Add("requests_total", Labels{"endpoint": "a\"\n"}, 2)
+	registry.Add("requests_total", Labels{"endpoint": "b"}, 1)
+	registry.Set("state", nil, 1)
+	registry.Set("state", nil, 0.5)
+	registry.Observe("latency_seconds", Labels{"method": "POST"}, 0.05)
+	registry.Observe("latency_seconds", Labels{"method": "POST"}, 2)
+	registry.Set("requests_total", nil, 10)
+
+	var buffer strings.Builder
+	n, err := registry.WriteTo(&buffer)
+	if err != nil {
+		t.Fatalf("Error writing metrics. %v", err)
+	}
+	expected := `# TYPE latency_seconds histogram
+latency_seconds_bucket{method="POST",le="0.1"} 1
+latency_seconds_bucket{method="POST",le="1"} 1
+latency_seconds_bucket{method="POST",le="+Inf"} 2
+latency_seconds_sum{method="POST"} 2.05
+latency_seconds_count{method="POST"} 2
+# HELP requests_total Requests by endpoint.
+# TYPE requests_total counter
+requests_total{endpoint="a\"\n"} 2
+requests_total{endpoint="b"} 2
+# TYPE state gauge
+state 0.5
+`
+	if buffer.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, buffer.String())
+	}
+	if n != int64(buffer.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buffer.Len(), n)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add("ticks_total", Labels{"mode": "LTP"}, 3)
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, `ticks_total{mode="LTP"} 3`) {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
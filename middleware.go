@@ -0,0 +1,121 @@
+package smartapigo
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RoundTrip sends a request and returns its response, like http.RoundTripper.
+type RoundTrip func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the round trip of the requests of a client to observe or modify
+// requests and responses. A middleware reading the response body must replace it.
+type Middleware func(next RoundTrip) RoundTrip
+
+// Option configures a Client created with New.
+type Option func(c *Client)
+
+// registeredMiddleware is a middleware and the endpoints it applies to, all if none.
+type registeredMiddleware struct {
+	middleware Middleware
+	endpoints  []string
+}
+
+// WithMiddleware registers a middleware, see Client.Use.
+func WithMiddleware(middleware Middleware, endpoints ...string) Option {
+	return func(c *Client) {
+		c.Use(middleware, endpoints...)
+	}
+}
+
+// Use registers a middleware for the requests to endpoints, such as URIPlaceOrder, or
+// to all endpoints if none are given. Middlewares registered first are outermost.
+func (c *Client) Use(middleware Middleware, endpoints ...string) {
+	registered := registeredMiddleware{middleware: middleware, endpoints: endpoints}
+	c.middlewares = append(c.middlewares, registered)
+	c.httpClient.GetClient().middlewares = append(c.httpClient.GetClient().middlewares, registered)
+}
+
+// RequestEndpoint returns the endpoint of a request, its path without the leading
+// slash, such as URIPlaceOrder.
+func RequestEndpoint(req *http.Request) string {
+	return strings.TrimPrefix(req.URL.Path, "/")
+}
+
+// matches reports whether a middleware applies to a request.
+func (m registeredMiddleware) matches(req *http.Request) bool {
+	if len(m.endpoints) == 0 {
+		return true
+	}
+	for _, endpoint := range m.endpoints {
+		if strings.HasSuffix(req.URL.Path, "/"+strings.TrimPrefix(endpoint, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// roundTrip sends a request through the middlewares applying to it.
+func (h *httpClient) roundTrip(req *http.Request) (*http.Response, error) {
+	next := RoundTrip(h.client.Do)
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		if h.middlewares[i].matches(req) {
+			next = h.middlewares[i].middleware(next)
+		}
+	}
+	return next(req)
+}
+
+// LoggingMiddleware logs the method, endpoint, status and duration of every request
+// to logger, or to standard output if logger is nil. Headers and bodies, which carry
+// credentials, are not logged.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.New(os.Stdout, "smartapi: ", log.Ldate|log.Ltime)
+	}
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			if err != nil {
+				logger.Printf("%s %s failed after %v: %v", req.Method, RequestEndpoint(req), time.Since(start), err)
+				return resp, err
+			}
+			logger.Printf("%s %s %d in %v", req.Method, RequestEndpoint(req), resp.StatusCode, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// TimingMiddleware calls f with the endpoint, duration and status code of every
+// request, or its error. The status code is 0 on errors.
+func TimingMiddleware(f func(endpoint string, duration time.Duration, statusCode int, err error)) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			f(RequestEndpoint(req), time.Since(start), statusCode, err)
+			return resp, err
+		}
+	}
+}
+
+// HeaderMiddleware sets headers on every request, replacing the values set by the
+// client.
+func HeaderMiddleware(headers http.Header) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req *http.Request) (*http.Response, error) {
+			for key, values := range headers {
+				req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package smartapigo
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next RoundTrip) RoundTrip {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next(req)
+			}
+		}
+	}
+	var timed []string
+	var logs bytes.Buffer
+	var headers []string
+	recordHeader := func(w http.ResponseWriter, r *http.Request) bool {
+		headers = append(headers, r.Header.Get("X-SourceID"))
+		return false
+	}
+	client, server := newMockServer(t, recordHeader,
+		WithMiddleware(trace("outer")),
+		WithMiddleware(HeaderMiddleware(http.Header{"X-SourceID": {"API"}})),
+		WithMiddleware(TimingMiddleware(func(endpoint string, duration time.Duration, statusCode int, err error) {
+			if statusCode == http.StatusOK && duration > 0 && err == nil {
+				timed = append(timed, endpoint)
+			}
+		}), URICancelOrder),
+	)
+	defer server.Close()
+	client.SetHTTPClient(&http.Client{Timeout: time.Second})
+	client.Use(trace("inner"))
+	client.Use(LoggingMiddleware(log.New(&logs, "", 0)))
+
+	if _, err := client.PlaceOrder(OrderParams{}); err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if _, err := client.CancelOrder("NORMAL", "1"); err != nil {
+		t.Fatalf("Error cancelling order. %v", err)
+	}
+
+	if strings.Join(order, ",") != "outer,inner,outer,inner" {
+		t.Errorf("Expected middlewares in registration order, got %v", order)
+	}
+	if len(headers) != 2 || headers[0] != "API" {
+		t.Errorf("Expected the injected header, got %v", headers)
+	}
+	if len(timed) != 1 || timed[0] != URICancelOrder {
+		t.Errorf("Expected the cancel endpoint only to be timed, got %v", timed)
+	}
+	if line := strings.Split(logs.String(), "\n")[0]; !strings.HasPrefix(line, "POST "+URIPlaceOrder+" 200 in ") || strings.Contains(logs.String(), "test_key") {
+		t.Errorf("Unexpected log %q", logs.String())
+	}
+}
@@ -0,0 +1,263 @@
+// Package orderbook maintains the latest market depth of instruments from SmartStream
+// DEPTH and SNAP_QUOTE packets and computes values derived from it.
+package orderbook
+
+import (
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+// Level is a price level of one side of a book.
+type Level struct {
+	Price    float64
+	Quantity int64
+	Orders   int
+}
+
+// Book is the depth of an instrument, best levels first. Empty levels are omitted.
+type Book struct {
+	ExchangeType int
+	Token        string
+	// Mode of the packet the book was built from, websocket.DEPTH for 20 levels or
+	// websocket.SNAP_QUOTE for the best 5.
+	Mode      websocket.SubscriptionMode
+	Bids      []Level
+	Asks      []Level
+	UpdatedAt time.Time
+}
+
+// BestBid returns the highest bid.
+func (b Book) BestBid() (Level, bool) {
+	if len(b.Bids) == 0 {
+		return Level{}, false
+	}
+	return b.Bids[0], true
+}
+
+// BestAsk returns the lowest ask.
+func (b Book) BestAsk() (Level, bool) {
+	if len(b.Asks) == 0 {
+		return Level{}, false
+	}
+	return b.Asks[0], true
+}
+
+// Spread returns the best ask minus the best bid, zero if either side is empty.
+func (b Book) Spread() float64 {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0
+	}
+	return ask.Price - bid.Price
+}
+
+// MidPrice returns the average of the best bid and ask, zero if either side is empty.
+func (b Book) MidPrice() float64 {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0
+	}
+	return (bid.Price + ask.Price) / 2
+}
+
+// WeightedMidPrice returns the mid price weighted by the quantities at the top of the
+// book, which leans towards the ask when bids are heavier and the other way round.
+// It is zero if either side is empty.
+func (b Book) WeightedMidPrice() float64 {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0
+	}
+	total := bid.Quantity + ask.Quantity
+	if total == 0 {
+		return (bid.Price + ask.Price) / 2
+	}
+	return (bid.Price*float64(ask.Quantity) + ask.Price*float64(bid.Quantity)) / float64(total)
+}
+
+// BidDepth returns the total quantity of the best levels of bids. Levels of zero or
+// less sums the whole side.
+func (b Book) BidDepth(levels int) int64 {
+	return depth(b.Bids, levels)
+}
+
+// AskDepth returns the total quantity of the best levels of asks. Levels of zero or
+// less sums the whole side.
+func (b Book) AskDepth(levels int) int64 {
+	return depth(b.Asks, levels)
+}
+
+// Imbalance returns (bid depth - ask depth) / (bid depth + ask depth) over the best
+// levels, from -1 when there are only asks to 1 when there are only bids.
+func (b Book) Imbalance(levels int) float64 {
+	bids, asks := b.BidDepth(levels), b.AskDepth(levels)
+	if bids+asks == 0 {
+		return 0
+	}
+	return float64(bids-asks) / float64(bids+asks)
+}
+
+func depth(side []Level, levels int) int64 {
+	if levels <= 0 || levels > len(side) {
+		levels = len(side)
+	}
+	var total int64
+	for _, level := range side[:levels] {
+		total += level.Quantity
+	}
+	return total
+}
+
+// copy returns a book not sharing its levels with b.
+func (b Book) copy() Book {
+	b.Bids = append([]Level(nil), b.Bids...)
+	b.Asks = append([]Level(nil), b.Asks...)
+	return b
+}
+
+// Books keeps the latest book of every token it receives depth for. Once a DEPTH
+// packet was received for a token, the best 5 of its SNAP_QUOTE packets are ignored
+// so the 20 level book is not replaced by a shallower one.
+type Books struct {
+	clock    func() time.Time
+	books    map[tokenKey]*Book
+	onChange func(book Book)
+	mutex    sync.Mutex
+}
+
+type tokenKey struct {
+	exchangeType int
+	token        string
+}
+
+// NewBooks creates an empty set of books.
+func NewBooks() *Books {
+	return &Books{
+		clock: time.Now,
+		books: make(map[tokenKey]*Book),
+	}
+}
+
+// SetClock sets the clock used to time packets without a timestamp.
+func (b *Books) SetClock(clock func() time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.clock = clock
+}
+
+// OnChange callback, called with a copy of a book whenever its levels change.
+func (b *Books) OnChange(f func(book Book)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.onChange = f
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (b *Books) OnMessage(message []byte) {
+	tick, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	b.OnTick(tick)
+}
+
+// OnTick updates the book of a token from a DEPTH or SNAP_QUOTE packet. Packets of
+// other modes are ignored.
+func (b *Books) OnTick(tick websocket.ParsedData) {
+	var bids, asks []Level
+	var at int64
+	switch tick.SubscriptionMode {
+	case websocket.DEPTH:
+		for _, data := range tick.Depth20BuyData {
+			bids = appendLevel(bids, data.Price, int64(data.Quantity), int(data.NumOfOrders))
+		}
+		for _, data := range tick.Depth20SellData {
+			asks = appendLevel(asks, data.Price, int64(data.Quantity), int(data.NumOfOrders))
+		}
+		at = tick.PacketReceivedTime
+	case websocket.SNAP_QUOTE:
+		for _, data := range tick.Best5BuyData {
+			bids = appendLevel(bids, data.Price, data.Quantity, int(data.NoOfOrders))
+		}
+		for _, data := range tick.Best5SellData {
+			asks = appendLevel(asks, data.Price, data.Quantity, int(data.NoOfOrders))
+		}
+		at = tick.ExchangeTimestamp
+	default:
+		return
+	}
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
+	sort.SliceStable(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+
+	b.mutex.Lock()
+	updatedAt := b.clock()
+	if at > 0 {
+		updatedAt = time.Unix(0, at*int64(time.Millisecond))
+	}
+	key := tokenKey{int(tick.ExchangeType), tick.Token}
+	book, ok := b.books[key]
+	if !ok {
+		book = &Book{ExchangeType: key.exchangeType, Token: key.token}
+		b.books[key] = book
+	}
+	if book.Mode == websocket.DEPTH && tick.SubscriptionMode != websocket.DEPTH {
+		b.mutex.Unlock()
+		return
+	}
+	changed := !ok || book.Mode != tick.SubscriptionMode || !equalLevels(book.Bids, bids) || !equalLevels(book.Asks, asks)
+	book.Mode = tick.SubscriptionMode
+	book.Bids, book.Asks = bids, asks
+	book.UpdatedAt = updatedAt.In(calendar.IST)
+	snapshot := book.copy()
+	onChange := b.onChange
+	b.mutex.Unlock()
+
+	if changed && onChange != nil {
+		onChange(snapshot)
+	}
+}
+
+// Book returns a copy of the latest book of a token.
+func (b *Books) Book(exchangeType int, token string) (Book, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	book, ok := b.books[tokenKey{exchangeType, token}]
+	if !ok {
+		return Book{}, false
+	}
+	return book.copy(), true
+}
+
+// Remove drops the book of a token, for example after unsubscribing from its depth.
+func (b *Books) Remove(exchangeType int, token string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.books, tokenKey{exchangeType, token})
+}
+
+func appendLevel(levels []Level, price float64, quantity int64, orders int) []Level {
+	if price <= 0 || quantity <= 0 {
+		return levels
+	}
+	return append(levels, Level{Price: price, Quantity: quantity, Orders: orders})
+}
+
+func equalLevels(a, b []Level) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
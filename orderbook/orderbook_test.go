@@ -0,0 +1,95 @@
+package orderbook
+
+import (
+	"math"
+	"testing"
+
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func snapQuote(bids, asks [][2]float64) websocket.ParsedData {
+	tick := websocket.ParsedData{
+		SubscriptionMode:  websocket.SNAP_QUOTE,
+		ExchangeType:      websocket.NSE_CM,
+		Token:             "3045",
+		ExchangeTimestamp: 1693971900000,
+		LastTradedPrice:   100,
+	}
+	for _, level := range bids {
+		tick.Best5BuyData = append(tick.Best5BuyData, websocket.OrderData{Flag: 0, Price: level[0], Quantity: int64(level[1]), NoOfOrders: 1})
+	}
+	for _, level := range asks {
+		tick.Best5SellData = append(tick.Best5SellData, websocket.OrderData{Flag: 1, Price: level[0], Quantity: int64(level[1]), NoOfOrders: 1})
+	}
+	return tick
+}
+
+func TestBookMetrics(t *testing.T) {
+	books := NewBooks()
+	var changes []Book
+	books.OnChange(func(book Book) { changes = append(changes, book) })
+
+	tick := snapQuote([][2]float64{{99.9, 300}, {99.8, 200}, {99.7, 100}}, [][2]float64{{100.1, 100}, {100.2, 100}})
+	packet, err := websocket.EncodeBinaryData(tick)
+	if err != nil {
+		t.Fatalf("Error encoding packet. %v", err)
+	}
+	books.OnMessage(packet)
+	books.OnMessage(packet)
+	if len(changes) != 1 {
+		t.Fatalf("Expected one change notification, got %d", len(changes))
+	}
+
+	book, ok := books.Book(websocket.NSE_CM, "3045")
+	if !ok || len(book.Bids) != 3 || len(book.Asks) != 2 {
+		t.Fatalf("Unexpected book %+v", book)
+	}
+	if math.Abs(book.Spread()-0.2) > 1e-9 || math.Abs(book.MidPrice()-100) > 1e-9 {
+		t.Errorf("Unexpected spread %v or mid %v", book.Spread(), book.MidPrice())
+	}
+	// 300 bid against 100 ask leans the weighted mid towards the ask.
+	if math.Abs(book.WeightedMidPrice()-100.05) > 1e-9 {
+		t.Errorf("Unexpected weighted mid %v", book.WeightedMidPrice())
+	}
+	if book.BidDepth(2) != 500 || book.BidDepth(0) != 600 || book.AskDepth(10) != 200 {
+		t.Errorf("Unexpected depth %d %d %d", book.BidDepth(2), book.BidDepth(0), book.AskDepth(10))
+	}
+	if math.Abs(book.Imbalance(1)-0.5) > 1e-9 {
+		t.Errorf("Unexpected imbalance %v", book.Imbalance(1))
+	}
+
+	book.Bids[0].Quantity = 1
+	if again, _ := books.Book(websocket.NSE_CM, "3045"); again.Bids[0].Quantity != 300 {
+		t.Errorf("Expected books to return copies")
+	}
+}
+
+func TestDepthTakesPrecedence(t *testing.T) {
+	books := NewBooks()
+	changes := 0
+	books.OnChange(func(book Book) { changes++ })
+
+	depth := websocket.ParsedData{
+		SubscriptionMode: websocket.DEPTH,
+		ExchangeType:     websocket.NSE_CM,
+		Token:            "3045",
+	}
+	for i := 0; i < websocket.DEPTH_LEVELS; i++ {
+		depth.Depth20BuyData = append(depth.Depth20BuyData, websocket.DepthData{Price: 99.9 - float64(i)/10, Quantity: 10, NumOfOrders: 1})
+		depth.Depth20SellData = append(depth.Depth20SellData, websocket.DepthData{Price: 100.1 + float64(i)/10, Quantity: 10, NumOfOrders: 1})
+	}
+	depth.Depth20SellData[19] = websocket.DepthData{}
+	books.OnTick(depth)
+	books.OnTick(snapQuote([][2]float64{{99.9, 300}}, [][2]float64{{100.1, 100}}))
+
+	book, _ := books.Book(websocket.NSE_CM, "3045")
+	if changes != 1 || book.Mode != websocket.DEPTH || len(book.Bids) != 20 || len(book.Asks) != 19 {
+		t.Errorf("Expected the 20 level book without the empty level, got %d changes and %+v", changes, book)
+	}
+
+	books.Remove(websocket.NSE_CM, "3045")
+	books.OnTick(snapQuote([][2]float64{{99.9, 300}}, [][2]float64{{100.1, 100}}))
+	if book, _ := books.Book(websocket.NSE_CM, "3045"); book.Mode != websocket.SNAP_QUOTE || changes != 2 {
+		t.Errorf("Expected a best 5 book after removal, got %+v", book)
+	}
+}
@@ -2,6 +2,8 @@ package smartapigo
 
 import (
 	"net/http"
+	"strings"
+	"time"
 )
 
 // Order represents a individual order response.
@@ -18,6 +20,7 @@ type Order struct {
 	StopLoss                string `json:"stoploss"`
 	TrailingStopLoss        string `json:"trailingstoploss"`
 	TrailingSymbol          string `json:"trailingsymbol"`
+	TradingSymbol           string `json:"tradingsymbol"`
 	TransactionType         string `json:"transactiontype"`
 	Exchange                string `json:"exchange"`
 	SymbolToken             string `json:"symboltoken"`
@@ -39,25 +42,42 @@ type Order struct {
 	ExchangeOrderUpdateTime string `json:"exchorderupdatetime"`
 	FillID                  string `json:"fillid"`
 	FillTime                string `json:"filltime"`
+	ParentOrderID           string `json:"parentorderid"`
+	UniqueOrderID           string `json:"uniqueorderid"`
+	OrderTag                string `json:"ordertag"`
 }
 
 // Orders is a list of orders.
 type Orders []Order
 
+// IsOpen reports whether the order is still pending at the exchange, that is not
+// complete, cancelled or rejected.
+func (o Order) IsOpen() bool {
+	switch strings.ToLower(o.Status) {
+	case OrderStatusComplete, OrderStatusCancelled, OrderStatusRejected:
+		return false
+	}
+	return o.Status != ""
+}
+
 // OrderParams represents parameters for placing an order.
 type OrderParams struct {
-	Variety         string `json:"variety"`
-	TradingSymbol   string `json:"tradingsymbol"`
-	SymbolToken     string `json:"symboltoken"`
-	TransactionType string `json:"transactiontype"`
-	Exchange        string `json:"exchange"`
-	OrderType       string `json:"ordertype"`
-	ProductType     string `json:"producttype"`
-	Duration        string `json:"duration"`
-	Price           string `json:"price"`
-	SquareOff       string `json:"squareoff"`
-	StopLoss        string `json:"stoploss"`
-	Quantity        string `json:"quantity"`
+	Variety           string `json:"variety"`
+	TradingSymbol     string `json:"tradingsymbol"`
+	SymbolToken       string `json:"symboltoken"`
+	TransactionType   string `json:"transactiontype"`
+	Exchange          string `json:"exchange"`
+	OrderType         string `json:"ordertype"`
+	ProductType       string `json:"producttype"`
+	Duration          string `json:"duration"`
+	Price             string `json:"price"`
+	TriggerPrice      string `json:"triggerprice"`
+	SquareOff         string `json:"squareoff"`
+	StopLoss          string `json:"stoploss"`
+	Quantity          string `json:"quantity"`
+	TrailingStopLoss  string `json:"trailingstoploss"`
+	DisclosedQuantity string `json:"disclosedquantity"`
+	OrderTag          string `json:"ordertag"`
 }
 
 // OrderParams represents parameters for modifying an order.
@@ -68,6 +88,7 @@ type ModifyOrderParams struct {
 	ProductType   string `json:"producttype"`
 	Duration      string `json:"duration"`
 	Price         string `json:"price"`
+	TriggerPrice  string `json:"triggerprice"`
 	Quantity      string `json:"quantity"`
 	TradingSymbol string `json:"tradingsymbol"`
 	SymbolToken   string `json:"symboltoken"`
@@ -76,8 +97,9 @@ type ModifyOrderParams struct {
 
 // OrderResponse represents the order place success response.
 type OrderResponse struct {
-	Script  string `json:"script"`
-	OrderID string `json:"orderid"`
+	Script        string `json:"script"`
+	OrderID       string `json:"orderid"`
+	UniqueOrderID string `json:"uniqueorderid"`
 }
 
 // Trade represents an individual trade response.
@@ -178,7 +200,9 @@ func (c *Client) PlaceOrder(orderParams OrderParams) (OrderResponse, error) {
 
 	params = structToMap(orderParams, "json")
 
+	start := time.Now()
 	err = c.doEnvelope(http.MethodPost, URIPlaceOrder, params, nil, &orderResponse, true)
+	c.record(JournalPlaceOrder, start, params, &orderResponse, err)
 	return orderResponse, err
 }
 
@@ -192,7 +216,9 @@ func (c *Client) ModifyOrder(modifyOrderParams ModifyOrderParams) (OrderResponse
 
 	params = structToMap(modifyOrderParams, "json")
 
+	start := time.Now()
 	err = c.doEnvelope(http.MethodPost, URIModifyOrder, params, nil, &orderResponse, true)
+	c.record(JournalModifyOrder, start, params, &orderResponse, err)
 	return orderResponse, err
 }
 
@@ -207,7 +233,9 @@ func (c *Client) CancelOrder(variety string, orderid string) (OrderResponse, err
 	params["variety"] = variety
 	params["orderid"] = orderid
 
+	start := time.Now()
 	err = c.doEnvelope(http.MethodPost, URICancelOrder, params, nil, &orderResponse, true)
+	c.record(JournalCancelOrder, start, params, &orderResponse, err)
 	return orderResponse, err
 }
 
@@ -234,6 +262,8 @@ func (c *Client) ConvertPosition(convertPositionParams ConvertPositionParams) er
 
 	params = structToMap(convertPositionParams, "json")
 
+	start := time.Now()
 	err = c.doEnvelope(http.MethodPost, URIConvertPosition, params, nil, nil, true)
+	c.record(JournalConvertPosition, start, params, nil, err)
 	return err
 }
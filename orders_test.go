@@ -32,7 +32,7 @@ func (ts *TestSuite) TestGetTrades(t *testing.T) {
 
 func (ts *TestSuite) TestPlaceOrder(t *testing.T) {
 	t.Parallel()
-	params := OrderParams{"NORMAL", "SBIN-EQ", "3045", "BUY", "NSE", "LIMIT", "INTRADAY", "DAY", "19500", "0", "0", "1"}
+	params := OrderParams{"NORMAL", "SBIN-EQ", "3045", "BUY", "NSE", "LIMIT", "INTRADAY", "DAY", "19500", "0", "0", "0", "1", "0", "0", ""}
 	orderResponse, err := ts.TestConnect.PlaceOrder(params)
 	if err != nil {
 		t.Errorf("Error while placing order. %v", err)
@@ -44,7 +44,7 @@ func (ts *TestSuite) TestPlaceOrder(t *testing.T) {
 
 func (ts *TestSuite) TestModifyOrder(t *testing.T) {
 	t.Parallel()
-	params := ModifyOrderParams{"NORMAL", "test", "LIMIT", "INTRADAY", "DAY", "19400", "1","SBI-EQ","3045","NSE"}
+	params := ModifyOrderParams{"NORMAL", "test", "LIMIT", "INTRADAY", "DAY", "19400", "0", "1","SBI-EQ","3045","NSE"}
 	orderResponse, err := ts.TestConnect.ModifyOrder( params)
 	if err != nil {
 		t.Errorf("Error while updating order. %v", err)
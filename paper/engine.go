@@ -0,0 +1,255 @@
+// Package paper provides a paper trading backend that implements smartapigo.Broker.
+// Orders are filled against live ticks from websocket.SocketClientV2 using virtual
+// funds, so strategies can run against the market without real money.
+package paper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/internal/sim"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+var (
+	ErrOrderNotPending = sim.ErrOrderNotPending
+)
+
+var _ smartapigo.Broker = (*Engine)(nil)
+
+// Charges are the costs deducted from funds for every executed order.
+type Charges struct {
+	// Flat charge per executed order.
+	PerOrder float64
+	// Charge as a fraction of the traded value, e.g. 0.0003 for 3 basis points.
+	Rate float64
+}
+
+// Engine is a paper trading account. Feed it ticks with OnTick or OnMessage and
+// trade through the smartapigo.Broker methods.
+type Engine struct {
+	account       *sim.Account
+	clock         func() time.Time
+	quotes        map[instrumentKey]sim.Quote
+	onOrderUpdate func(order smartapigo.Order)
+	mutex         sync.Mutex
+}
+
+type instrumentKey struct {
+	exchangeType int
+	token        string
+}
+
+// exchanges maps exchange types back to the exchange segments of orders.
+var exchanges = make(map[int]string, len(websocket.EXCHANGE_TYPE_MAP))
+
+func init() {
+	for exchange, exchangeType := range websocket.EXCHANGE_TYPE_MAP {
+		exchanges[exchangeType] = exchange
+	}
+}
+
+// NewEngine creates a paper trading account with the given funds.
+func NewEngine(funds float64) *Engine {
+	e := &Engine{
+		clock:  time.Now,
+		quotes: make(map[instrumentKey]sim.Quote),
+	}
+	e.account = sim.NewAccount(funds, e.quote)
+	return e
+}
+
+// SetSlippage sets the slippage applied against MARKET and STOPLOSS_MARKET fills as a
+// fraction of the price, e.g. 0.0005 for 5 basis points.
+func (e *Engine) SetSlippage(slippage float64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.account.Slippage = slippage
+}
+
+// SetCharges sets the charges deducted for every executed order.
+func (e *Engine) SetCharges(charges Charges) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.account.Charges = sim.Charges(charges)
+}
+
+// SetClock sets the clock used to time orders placed between ticks. Fills are timed
+// with the exchange timestamp of the tick that filled them.
+func (e *Engine) SetClock(clock func() time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.clock = clock
+}
+
+// OnOrderUpdate registers a callback called whenever an order is placed, modified,
+// cancelled, rejected or filled.
+func (e *Engine) OnOrderUpdate(f func(order smartapigo.Order)) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.onOrderUpdate = f
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (e *Engine) OnMessage(message []byte) {
+	data, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	e.OnTick(data)
+}
+
+// OnTick updates the market price of an instrument and fills pending orders that
+// became marketable.
+func (e *Engine) OnTick(data websocket.ParsedData) {
+	e.mutex.Lock()
+	key := instrumentKey{int(data.ExchangeType), data.Token}
+	q := e.quotes[key]
+	if data.LastTradedPrice > 0 {
+		q.LTP = data.LastTradedPrice
+	}
+	q.Bid, q.Ask = 0, 0
+	for _, level := range data.Best5BuyData {
+		if level.Price > 0 && level.Price > q.Bid {
+			q.Bid = level.Price
+		}
+	}
+	for _, level := range data.Best5SellData {
+		if level.Price > 0 && (q.Ask == 0 || level.Price < q.Ask) {
+			q.Ask = level.Price
+		}
+	}
+	q.Time = e.clock()
+	if data.ExchangeTimestamp > 0 {
+		q.Time = time.Unix(0, data.ExchangeTimestamp*int64(time.Millisecond))
+	}
+	e.quotes[key] = q
+
+	updates := e.account.Match(exchanges[key.exchangeType], key.token)
+	e.mutex.Unlock()
+	e.notify(updates...)
+}
+
+// PlaceOrder places a paper order. MARKET orders fill at the last price, or on the
+// next tick if no price is known yet. Buys and short sells the funds cannot cover
+// are rejected.
+func (e *Engine) PlaceOrder(orderParams smartapigo.OrderParams) (smartapigo.OrderResponse, error) {
+	if _, ok := websocket.EXCHANGE_TYPE_MAP[orderParams.Exchange]; !ok {
+		return smartapigo.OrderResponse{}, fmt.Errorf("%w: exchange %q", smartapigo.ErrInvalidOrderParams, orderParams.Exchange)
+	}
+
+	e.mutex.Lock()
+	o, err := sim.NewOrder(orderParams, e.clock())
+	if err != nil {
+		e.mutex.Unlock()
+		return smartapigo.OrderResponse{}, fmt.Errorf("%w: %v", smartapigo.ErrInvalidOrderParams, err)
+	}
+	o.OrderID = fmt.Sprintf("PAPER%010d", e.account.NextOrderID())
+	estimate := o.Limit()
+	if q, ok := e.quote(o.Exchange, o.SymbolToken); ok && o.IsMarket() {
+		estimate = q.LTP * (1 + e.account.Slippage)
+		if o.TransactionType == smartapigo.TransactionTypeSell {
+			estimate = q.LTP * (1 - e.account.Slippage)
+		}
+	}
+	if !e.account.Covers(o, estimate) {
+		o.Reject("Insufficient funds")
+	}
+	e.account.Add(o)
+	response := smartapigo.OrderResponse{Script: o.TradingSymbol, OrderID: o.OrderID}
+	update := o.Order
+	e.mutex.Unlock()
+
+	e.notify(update)
+	return response, nil
+}
+
+// ModifyOrder changes the order type, price, trigger price or quantity of a pending order.
+func (e *Engine) ModifyOrder(modifyOrderParams smartapigo.ModifyOrderParams) (smartapigo.OrderResponse, error) {
+	e.mutex.Lock()
+	o, err := e.account.Modify(modifyOrderParams, e.clock())
+	if err != nil {
+		e.mutex.Unlock()
+		return smartapigo.OrderResponse{}, err
+	}
+	response := smartapigo.OrderResponse{Script: o.TradingSymbol, OrderID: o.OrderID}
+	update := o.Order
+	e.mutex.Unlock()
+
+	e.notify(update)
+	return response, nil
+}
+
+// CancelOrder cancels a pending order.
+func (e *Engine) CancelOrder(variety string, orderid string) (smartapigo.OrderResponse, error) {
+	e.mutex.Lock()
+	o, err := e.account.Cancel(orderid, e.clock())
+	if err != nil {
+		e.mutex.Unlock()
+		return smartapigo.OrderResponse{}, err
+	}
+	response := smartapigo.OrderResponse{Script: o.TradingSymbol, OrderID: o.OrderID}
+	update := o.Order
+	e.mutex.Unlock()
+
+	e.notify(update)
+	return response, nil
+}
+
+// GetOrderBook gets all paper orders.
+func (e *Engine) GetOrderBook() (smartapigo.Orders, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.account.Orders(), nil
+}
+
+// GetTradeBook gets all paper trades.
+func (e *Engine) GetTradeBook() (smartapigo.Trades, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.account.Trades(), nil
+}
+
+// GetPositions gets the paper positions.
+func (e *Engine) GetPositions() (smartapigo.Positions, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.account.Positions(), nil
+}
+
+// GetRMS reports the virtual funds along with the realized and unrealized M2M of all
+// positions. Charges paid are reported as utilised debits.
+func (e *Engine) GetRMS() (smartapigo.RMS, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.account.RMS(), nil
+}
+
+// Equity returns the value of the account, the available cash plus the open
+// positions marked to their last price.
+func (e *Engine) Equity() float64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.account.Equity()
+}
+
+// quote returns the latest quote of an instrument. Must be called with the mutex held.
+func (e *Engine) quote(exchange, token string) (sim.Quote, bool) {
+	q, ok := e.quotes[instrumentKey{websocket.EXCHANGE_TYPE_MAP[exchange], token}]
+	return q, ok
+}
+
+func (e *Engine) notify(updates ...smartapigo.Order) {
+	e.mutex.Lock()
+	onOrderUpdate := e.onOrderUpdate
+	e.mutex.Unlock()
+	if onOrderUpdate == nil {
+		return
+	}
+	for _, update := range updates {
+		onOrderUpdate(update)
+	}
+}
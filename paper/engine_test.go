@@ -0,0 +1,148 @@
+package paper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func tick(price float64) websocket.ParsedData {
+	return websocket.ParsedData{
+		SubscriptionMode:  websocket.LTP_MODE,
+		ExchangeType:      websocket.NSE_CM,
+		Token:             "3045",
+		ExchangeTimestamp: 1700000000000,
+		LastTradedPrice:   price,
+	}
+}
+
+func orderParams(transactionType, orderType, price, triggerPrice, quantity string) smartapigo.OrderParams {
+	return smartapigo.OrderParams{
+		Variety:         "NORMAL",
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: transactionType,
+		Exchange:        smartapigo.NSE,
+		OrderType:       orderType,
+		ProductType:     "INTRADAY",
+		Duration:        "DAY",
+		Price:           price,
+		TriggerPrice:    triggerPrice,
+		Quantity:        quantity,
+	}
+}
+
+func orderStatus(t *testing.T, engine *Engine, orderID string) smartapigo.Order {
+	orders, _ := engine.GetOrderBook()
+	for _, order := range orders {
+		if order.OrderID == orderID {
+			return order
+		}
+	}
+	t.Fatalf("Order %s not found", orderID)
+	return smartapigo.Order{}
+}
+
+func TestMarketOrder(t *testing.T) {
+	engine := NewEngine(100000)
+	engine.SetSlippage(0.001)
+	engine.SetCharges(Charges{PerOrder: 20})
+
+	var updates []smartapigo.Order
+	engine.OnOrderUpdate(func(order smartapigo.Order) {
+		updates = append(updates, order)
+	})
+
+	response, err := engine.PlaceOrder(orderParams("BUY", smartapigo.OrderTypeMarket, "0", "", "10"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if order := orderStatus(t, engine, response.OrderID); order.Status != smartapigo.OrderStatusOpen {
+		t.Errorf("Expected the order to wait for a price, got %+v", order)
+	}
+
+	packet, err := websocket.EncodeBinaryData(tick(500))
+	if err != nil {
+		t.Fatalf("Error encoding tick. %v", err)
+	}
+	engine.OnMessage(packet)
+	if order := orderStatus(t, engine, response.OrderID); order.Status != smartapigo.OrderStatusComplete || order.AveragePrice != "500.50" {
+		t.Errorf("Expected the order to fill at 500.50, got %+v", order)
+	}
+	if len(updates) != 2 || updates[1].Status != smartapigo.OrderStatusComplete {
+		t.Errorf("Expected placed and filled updates, got %+v", updates)
+	}
+
+	engine.OnTick(tick(510))
+	positions, _ := engine.GetPositions()
+	if len(positions) != 1 || positions[0].NetQty != "10" {
+		t.Fatalf("Unexpected positions %+v", positions)
+	}
+	rms, _ := engine.GetRMS()
+	if rms.AvailableCash != "94975.00" || rms.M2MUnrealized != "95.00" || rms.UtilisedDebits != "20.00" {
+		t.Errorf("Unexpected RMS %+v", rms)
+	}
+}
+
+func TestLimitAndStopLossOrders(t *testing.T) {
+	engine := NewEngine(100000)
+	engine.OnTick(tick(500))
+
+	limit, _ := engine.PlaceOrder(orderParams("SELL", smartapigo.OrderTypeLimit, "505", "", "5"))
+	stopLoss, _ := engine.PlaceOrder(orderParams("SELL", smartapigo.OrderTypeStopLossMarket, "", "495", "5"))
+	cancelled, _ := engine.PlaceOrder(orderParams("BUY", smartapigo.OrderTypeLimit, "490", "", "5"))
+	if order := orderStatus(t, engine, stopLoss.OrderID); order.Status != smartapigo.OrderStatusTriggerPending {
+		t.Errorf("Expected the stop loss to be pending, got %+v", order)
+	}
+
+	engine.OnTick(tick(506))
+	if order := orderStatus(t, engine, limit.OrderID); order.Status != smartapigo.OrderStatusComplete || order.AveragePrice != "506.00" {
+		t.Errorf("Expected the limit order to fill at 506, got %+v", order)
+	}
+	engine.OnTick(tick(494))
+	if order := orderStatus(t, engine, stopLoss.OrderID); order.Status != smartapigo.OrderStatusComplete || order.AveragePrice != "494.00" {
+		t.Errorf("Expected the stop loss to fill at 494, got %+v", order)
+	}
+
+	if _, err := engine.CancelOrder("NORMAL", cancelled.OrderID); err != nil {
+		t.Fatalf("Error cancelling order. %v", err)
+	}
+	if _, err := engine.CancelOrder("NORMAL", limit.OrderID); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("Expected ErrOrderNotPending, got %v", err)
+	}
+	engine.OnTick(tick(480))
+	if order := orderStatus(t, engine, cancelled.OrderID); order.Status != smartapigo.OrderStatusCancelled {
+		t.Errorf("Expected the order to stay cancelled, got %+v", order)
+	}
+}
+
+func TestOrderValidation(t *testing.T) {
+	engine := NewEngine(1000)
+	engine.OnTick(tick(500))
+
+	if _, err := engine.PlaceOrder(orderParams("BUY", smartapigo.OrderTypeStopLossLimit, "505", "", "1")); !errors.Is(err, smartapigo.ErrInvalidOrderParams) {
+		t.Errorf("Expected ErrInvalidOrderParams for a stop loss without trigger, got %v", err)
+	}
+	if _, err := engine.PlaceOrder(orderParams("BUY", smartapigo.OrderTypeMarket, "", "", "0")); !errors.Is(err, smartapigo.ErrInvalidOrderParams) {
+		t.Errorf("Expected ErrInvalidOrderParams for zero quantity, got %v", err)
+	}
+
+	response, err := engine.PlaceOrder(orderParams("BUY", smartapigo.OrderTypeMarket, "", "", "3"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if order := orderStatus(t, engine, response.OrderID); order.Status != smartapigo.OrderStatusRejected {
+		t.Errorf("Expected the order to be rejected for insufficient funds, got %+v", order)
+	}
+
+	// Short sells need funds as well.
+	response, err = engine.PlaceOrder(orderParams("SELL", smartapigo.OrderTypeMarket, "", "", "3"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	if order := orderStatus(t, engine, response.OrderID); order.Status != smartapigo.OrderStatusRejected || order.Text != "Insufficient funds" {
+		t.Errorf("Expected the short to be rejected for insufficient funds, got %+v", order)
+	}
+}
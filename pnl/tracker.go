@@ -0,0 +1,537 @@
+// Package pnl tracks positions and their profit and loss in real time. Positions are
+// seeded from the REST positions and trade book, marked to market on every tick and
+// periodically reconciled against the REST snapshot.
+package pnl
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+const (
+	// Strategy of fills of orders not assigned to any strategy.
+	UNASSIGNED = ""
+	// Default difference of amounts tolerated by reconciliation.
+	DEFAULT_TOLERANCE = 0.01
+)
+
+// PnL is a realized and unrealized profit and loss.
+type PnL struct {
+	Realized   float64
+	Unrealized float64
+}
+
+// Total returns the realized plus the unrealized profit and loss.
+func (p PnL) Total() float64 {
+	return p.Realized + p.Unrealized
+}
+
+// Position is a position of a strategy, or of the account when Strategy is empty,
+// marked to market.
+type Position struct {
+	Strategy         string
+	Exchange         string
+	TradingSymbol    string
+	SymbolToken      string
+	ProductType      string
+	Multiplier       float64
+	LotSize          int
+	BuyQuantity      int
+	SellQuantity     int
+	BuyAveragePrice  float64
+	SellAveragePrice float64
+	// Last traded price, zero until a tick of the instrument is received.
+	LastPrice float64
+	PnL
+}
+
+// NetQuantity returns the bought minus the sold quantity.
+func (p Position) NetQuantity() int {
+	return p.BuyQuantity - p.SellQuantity
+}
+
+// Lots returns the net quantity in lots.
+func (p Position) Lots() float64 {
+	if p.LotSize <= 0 {
+		return float64(p.NetQuantity())
+	}
+	return float64(p.NetQuantity()) / float64(p.LotSize)
+}
+
+// Discrepancy is a field of a position that differs between the tracker and the REST
+// positions. Fields are named after the JSON fields of smartapigo.Position.
+type Discrepancy struct {
+	Exchange      string
+	TradingSymbol string
+	ProductType   string
+	Field         string
+	Local         float64
+	Remote        float64
+}
+
+// Tracker computes the positions and profit and loss of an account per strategy.
+// Fills are attributed to the strategy their order is assigned to with Assign.
+//
+// Profit and loss is computed with the average price of the day's buys and sells,
+// scaled by the multiplier of the instrument, like the M2M of GetRMS.
+type Tracker struct {
+	broker        smartapigo.Broker
+	tolerance     float64
+	positions     map[positionKey]*position
+	positionKeys  []positionKey
+	fills         map[string]fill
+	fillIDs       []string
+	strategies    map[string]string
+	prices        map[instrumentKey]float64
+	onDiscrepancy func(discrepancies []Discrepancy)
+	onError       func(err error)
+	mutex         sync.Mutex
+}
+
+type positionKey struct {
+	exchange      string
+	tradingSymbol string
+	productType   string
+}
+
+type instrumentKey struct {
+	exchangeType int
+	token        string
+}
+
+// position is the instrument details and REST snapshot of a position.
+type position struct {
+	token      string
+	multiplier float64
+	lotSize    int
+	snapshot   totals
+}
+
+// fill is a trade of the trade book.
+type fill struct {
+	key      positionKey
+	orderID  string
+	buy      bool
+	quantity int
+	price    float64
+	// Whether the fill is included in the REST snapshot of its position.
+	inSnapshot bool
+}
+
+// totals are the bought and sold quantities and amounts of a position.
+type totals struct {
+	buyQuantity  int
+	sellQuantity int
+	buyAmount    float64
+	sellAmount   float64
+}
+
+// NewTracker creates a tracker of the account of broker, such as a Client or a
+// paper.Engine. Call Sync to seed it.
+func NewTracker(broker smartapigo.Broker) *Tracker {
+	return &Tracker{
+		broker:     broker,
+		tolerance:  DEFAULT_TOLERANCE,
+		positions:  make(map[positionKey]*position),
+		fills:      make(map[string]fill),
+		strategies: make(map[string]string),
+		prices:     make(map[instrumentKey]float64),
+	}
+}
+
+// SetTolerance sets the difference of amounts tolerated by Reconcile.
+func (t *Tracker) SetTolerance(tolerance float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tolerance = tolerance
+}
+
+// OnDiscrepancy callback, called by Run when reconciliation finds discrepancies.
+func (t *Tracker) OnDiscrepancy(f func(discrepancies []Discrepancy)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.onDiscrepancy = f
+}
+
+// OnError callback, called by Run when fetching the REST snapshot fails.
+func (t *Tracker) OnError(f func(err error)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.onError = f
+}
+
+// Assign attributes the fills of an order to a strategy. It can be called before or
+// after the fills are known.
+func (t *Tracker) Assign(orderID, strategy string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.strategies[orderID] = strategy
+}
+
+// Strategy returns the strategy an order is assigned to, UNASSIGNED if none.
+func (t *Tracker) Strategy(orderID string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.strategies[orderID]
+}
+
+// AddTrade adds a fill, such as one reported by an order update. Fills already known
+// by their fill ID are ignored.
+func (t *Tracker) AddTrade(trade smartapigo.Trade) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.addTrade(trade)
+}
+
+// Sync seeds the tracker from the trade book and the REST positions, which replace
+// the positions known so far.
+func (t *Tracker) Sync() error {
+	_, err := t.sync(false)
+	return err
+}
+
+// Reconcile fetches the trade book and the REST positions, reports the positions
+// that differ from the ones tracked and then adopts the REST positions. Fills made
+// between fetching the trade book and the positions may be reported as discrepancies.
+func (t *Tracker) Reconcile() ([]Discrepancy, error) {
+	return t.sync(true)
+}
+
+// Run reconciles every interval until ctx is done. Discrepancies and errors are
+// reported through OnDiscrepancy and OnError.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		discrepancies, err := t.Reconcile()
+		t.mutex.Lock()
+		onDiscrepancy, onError := t.onDiscrepancy, t.onError
+		t.mutex.Unlock()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		if len(discrepancies) > 0 && onDiscrepancy != nil {
+			onDiscrepancy(discrepancies)
+		}
+	}
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (t *Tracker) OnMessage(message []byte) {
+	tick, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	t.OnTick(tick)
+}
+
+// OnTick marks the positions of the tick's instrument to its last traded price.
+func (t *Tracker) OnTick(tick websocket.ParsedData) {
+	if tick.LastTradedPrice <= 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.prices[instrumentKey{int(tick.ExchangeType), tick.Token}] = tick.LastTradedPrice
+}
+
+// Positions returns the positions of the account across strategies.
+func (t *Tracker) Positions() []Position {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	positions := make([]Position, 0, len(t.positionKeys))
+	for _, key := range t.positionKeys {
+		positions = append(positions, t.mark(key, "", t.total(key)))
+	}
+	return positions
+}
+
+// StrategyPositions returns the positions of a strategy. Positions of the account not
+// explained by assigned fills belong to UNASSIGNED.
+func (t *Tracker) StrategyPositions(strategy string) []Position {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var positions []Position
+	for _, key := range t.positionKeys {
+		if totals, ok := t.strategyTotals(key)[strategy]; ok {
+			positions = append(positions, t.mark(key, strategy, totals))
+		}
+	}
+	return positions
+}
+
+// Total returns the profit and loss of the account.
+func (t *Tracker) Total() PnL {
+	var pnl PnL
+	for _, position := range t.Positions() {
+		pnl.Realized += position.Realized
+		pnl.Unrealized += position.Unrealized
+	}
+	return pnl
+}
+
+// Strategies returns the profit and loss of every strategy with a position.
+func (t *Tracker) Strategies() map[string]PnL {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	strategies := make(map[string]PnL)
+	for _, key := range t.positionKeys {
+		for strategy, totals := range t.strategyTotals(key) {
+			position := t.mark(key, strategy, totals)
+			pnl := strategies[strategy]
+			pnl.Realized += position.Realized
+			pnl.Unrealized += position.Unrealized
+			strategies[strategy] = pnl
+		}
+	}
+	return strategies
+}
+
+func (t *Tracker) sync(compare bool) ([]Discrepancy, error) {
+	trades, err := t.broker.GetTradeBook()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := t.broker.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, trade := range trades {
+		t.addTrade(trade)
+	}
+
+	var discrepancies []Discrepancy
+	seen := make(map[positionKey]bool, len(remote))
+	for _, p := range remote {
+		key := positionKey{p.Exchange, p.Tradingsymbol, p.ProductType}
+		snapshot := totals{
+			buyQuantity:  parseInt(p.BuyQuantity),
+			sellQuantity: parseInt(p.SellQuantity),
+			buyAmount:    parseFloat(p.BuyAmount),
+			sellAmount:   parseFloat(p.SellAmount),
+		}
+		if compare {
+			discrepancies = append(discrepancies, t.compare(key, t.total(key), snapshot)...)
+		}
+		seen[key] = true
+
+		position := t.position(key)
+		position.token = p.SymbolToken
+		position.multiplier = multiplier(p.Multiplier)
+		position.lotSize = parseInt(p.LotSize)
+		position.snapshot = snapshot
+	}
+	for _, key := range t.positionKeys {
+		if seen[key] {
+			continue
+		}
+		if compare {
+			discrepancies = append(discrepancies, t.compare(key, t.total(key), totals{})...)
+		}
+		t.positions[key].snapshot = totals{}
+	}
+	// The trade book was fetched first, so the snapshot includes every known fill.
+	for id, f := range t.fills {
+		f.inSnapshot = true
+		t.fills[id] = f
+	}
+	return discrepancies, nil
+}
+
+// addTrade adds a fill unless it is known. Must be called with the mutex held.
+func (t *Tracker) addTrade(trade smartapigo.Trade) {
+	id := trade.OrderID + "/" + trade.FillID
+	if _, ok := t.fills[id]; ok {
+		return
+	}
+	key := positionKey{trade.Exchange, trade.TradingSymbol, trade.ProductType}
+	position := t.position(key)
+	if position.multiplier == 0 {
+		position.multiplier = multiplier(trade.Multiplier)
+		position.lotSize = parseInt(trade.MarketLot)
+	}
+	t.fills[id] = fill{
+		key:      key,
+		orderID:  trade.OrderID,
+		buy:      trade.TransactionType == smartapigo.TransactionTypeBuy,
+		quantity: parseInt(trade.FillSize),
+		price:    parseFloat(trade.FillPrice),
+	}
+	t.fillIDs = append(t.fillIDs, id)
+}
+
+// position returns the position of key, creating it if needed. Must be called with the mutex held.
+func (t *Tracker) position(key positionKey) *position {
+	p, ok := t.positions[key]
+	if !ok {
+		p = &position{}
+		// Positions of the same instrument in other products share its token.
+		for other, q := range t.positions {
+			if other.exchange == key.exchange && other.tradingSymbol == key.tradingSymbol && q.token != "" {
+				p.token = q.token
+				break
+			}
+		}
+		t.positions[key] = p
+		t.positionKeys = append(t.positionKeys, key)
+	}
+	return p
+}
+
+// total returns the REST snapshot of a position plus the fills made since. Must be
+// called with the mutex held.
+func (t *Tracker) total(key positionKey) totals {
+	total := t.positions[key].snapshot
+	for _, id := range t.fillIDs {
+		if f := t.fills[id]; f.key == key && !f.inSnapshot {
+			total.add(f)
+		}
+	}
+	return total
+}
+
+// strategyTotals splits a position by strategy, UNASSIGNED holding whatever assigned
+// fills do not explain. Must be called with the mutex held.
+func (t *Tracker) strategyTotals(key positionKey) map[string]totals {
+	split := make(map[string]totals)
+	unassigned := t.total(key)
+	for _, id := range t.fillIDs {
+		f := t.fills[id]
+		strategy, ok := t.strategies[f.orderID]
+		if f.key != key || !ok || strategy == UNASSIGNED {
+			continue
+		}
+		totals := split[strategy]
+		totals.add(f)
+		split[strategy] = totals
+		unassigned.remove(f)
+	}
+	if !unassigned.empty() {
+		split[UNASSIGNED] = unassigned
+	}
+	return split
+}
+
+// mark computes the profit and loss of totals of a position. Must be called with the mutex held.
+func (t *Tracker) mark(key positionKey, strategy string, totals totals) Position {
+	p := t.positions[key]
+	mult := p.multiplier
+	if mult == 0 {
+		mult = 1
+	}
+	position := Position{
+		Strategy:         strategy,
+		Exchange:         key.exchange,
+		TradingSymbol:    key.tradingSymbol,
+		SymbolToken:      p.token,
+		ProductType:      key.productType,
+		Multiplier:       mult,
+		LotSize:          p.lotSize,
+		BuyQuantity:      totals.buyQuantity,
+		SellQuantity:     totals.sellQuantity,
+		BuyAveragePrice:  average(totals.buyAmount, totals.buyQuantity),
+		SellAveragePrice: average(totals.sellAmount, totals.sellQuantity),
+	}
+	if exchangeType, ok := websocket.EXCHANGE_TYPE_MAP[key.exchange]; ok {
+		position.LastPrice = t.prices[instrumentKey{exchangeType, p.token}]
+	}
+
+	closed := totals.buyQuantity
+	if totals.sellQuantity < closed {
+		closed = totals.sellQuantity
+	}
+	if closed > 0 {
+		position.Realized = float64(closed) * (position.SellAveragePrice - position.BuyAveragePrice) * mult
+	}
+	if net := position.NetQuantity(); net != 0 && position.LastPrice > 0 {
+		open := position.BuyAveragePrice
+		if net < 0 {
+			open = position.SellAveragePrice
+		}
+		position.Unrealized = float64(net) * (position.LastPrice - open) * mult
+	}
+	return position
+}
+
+// compare returns the fields of local and remote that differ. Must be called with the mutex held.
+func (t *Tracker) compare(key positionKey, local, remote totals) []Discrepancy {
+	var discrepancies []Discrepancy
+	check := func(field string, local, remote float64) {
+		if math.Abs(local-remote) > t.tolerance {
+			discrepancies = append(discrepancies, Discrepancy{
+				Exchange:      key.exchange,
+				TradingSymbol: key.tradingSymbol,
+				ProductType:   key.productType,
+				Field:         field,
+				Local:         local,
+				Remote:        remote,
+			})
+		}
+	}
+	check("buyquantity", float64(local.buyQuantity), float64(remote.buyQuantity))
+	check("sellquantity", float64(local.sellQuantity), float64(remote.sellQuantity))
+	check("buyamount", local.buyAmount, remote.buyAmount)
+	check("sellamount", local.sellAmount, remote.sellAmount)
+	return discrepancies
+}
+
+func (t *totals) add(f fill) {
+	if f.buy {
+		t.buyQuantity += f.quantity
+		t.buyAmount += float64(f.quantity) * f.price
+	} else {
+		t.sellQuantity += f.quantity
+		t.sellAmount += float64(f.quantity) * f.price
+	}
+}
+
+func (t totals) empty() bool {
+	return t.buyQuantity == 0 && t.sellQuantity == 0 && math.Abs(t.buyAmount) < 1e-9 && math.Abs(t.sellAmount) < 1e-9
+}
+
+func (t *totals) remove(f fill) {
+	f.quantity = -f.quantity
+	t.add(f)
+}
+
+func average(amount float64, quantity int) float64 {
+	if quantity == 0 {
+		return 0
+	}
+	return amount / float64(quantity)
+}
+
+// multiplier parses the multiplier of an instrument, which is -1 or empty for
+// instruments without one.
+func multiplier(s string) float64 {
+	if m := parseFloat(s); m > 0 {
+		return m
+	}
+	return 1
+}
+
+func parseInt(s string) int {
+	v, _ := strconv.ParseFloat(s, 64)
+	return int(v)
+}
+
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
@@ -0,0 +1,137 @@
+package pnl
+
+import (
+	"math"
+	"testing"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/paper"
+	"github.com/piyushpatil22/smartapigo/smartapitest"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func tick(exchangeType int, token string, price float64) websocket.ParsedData {
+	return websocket.ParsedData{
+		SubscriptionMode:  websocket.LTP_MODE,
+		ExchangeType:      byte(exchangeType),
+		Token:             token,
+		ExchangeTimestamp: 1700000000000,
+		LastTradedPrice:   price,
+	}
+}
+
+func marketOrder(t *testing.T, engine *paper.Engine, transactionType, quantity string) string {
+	response, err := engine.PlaceOrder(smartapigo.OrderParams{
+		Variety:         "NORMAL",
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: transactionType,
+		Exchange:        smartapigo.NSE,
+		OrderType:       smartapigo.OrderTypeMarket,
+		ProductType:     "INTRADAY",
+		Duration:        "DAY",
+		Quantity:        quantity,
+	})
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	return response.OrderID
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestStrategyPnL(t *testing.T) {
+	engine := paper.NewEngine(100000)
+	tracker := NewTracker(engine)
+	update := func(price float64) {
+		engine.OnTick(tick(websocket.NSE_CM, "3045", price))
+		tracker.OnTick(tick(websocket.NSE_CM, "3045", price))
+	}
+
+	update(100)
+	buy := marketOrder(t, engine, "BUY", "10")
+	if err := tracker.Sync(); err != nil {
+		t.Fatalf("Error syncing. %v", err)
+	}
+	tracker.Assign(buy, "momentum")
+	if strategy := tracker.Strategy(buy); strategy != "momentum" {
+		t.Errorf("Expected the order to be assigned, got %q", strategy)
+	}
+
+	update(110)
+	marketOrder(t, engine, "SELL", "4")
+	trades, _ := engine.GetTradeBook()
+	for _, trade := range trades {
+		tracker.AddTrade(trade)
+	}
+	update(120)
+
+	total := tracker.Total()
+	if !equal(total.Realized, 40) || !equal(total.Unrealized, 120) {
+		t.Errorf("Expected 40 realized and 120 unrealized, got %+v", total)
+	}
+	rms, _ := engine.GetRMS()
+	if rms.M2MRealized != "40.00" || rms.M2MUnrealized != "120.00" {
+		t.Errorf("Expected the M2M of the engine to match, got %s and %s", rms.M2MRealized, rms.M2MUnrealized)
+	}
+
+	strategies := tracker.Strategies()
+	if !equal(strategies["momentum"].Unrealized, 200) || !equal(strategies[UNASSIGNED].Unrealized, -40) {
+		t.Errorf("Unexpected strategy P&L %+v", strategies)
+	}
+	positions := tracker.StrategyPositions("momentum")
+	if len(positions) != 1 || positions[0].NetQuantity() != 10 || positions[0].SymbolToken != "3045" {
+		t.Errorf("Unexpected strategy positions %+v", positions)
+	}
+
+	discrepancies, err := tracker.Reconcile()
+	if err != nil || len(discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies, got %+v and %v", discrepancies, err)
+	}
+	if total := tracker.Total(); !equal(total.Total(), 160) {
+		t.Errorf("Expected reconciliation to keep the P&L, got %+v", total)
+	}
+}
+
+func TestMultiplierAndReconcile(t *testing.T) {
+	position := smartapigo.Position{
+		Exchange:      smartapigo.MCX,
+		SymbolToken:   "234230",
+		ProductType:   "CARRYFORWARD",
+		Tradingsymbol: "GOLDM23OCTFUT",
+		Multiplier:    "10",
+		LotSize:       "1",
+		BuyQuantity:   "2",
+		SellQuantity:  "0",
+		BuyAmount:     "120000",
+		SellAmount:    "0",
+	}
+	client := &smartapitest.FakeClient{}
+	client.GetPositionsFunc = func() (smartapigo.Positions, error) {
+		return smartapigo.Positions{position}, nil
+	}
+	tracker := NewTracker(client)
+	if err := tracker.Sync(); err != nil {
+		t.Fatalf("Error syncing. %v", err)
+	}
+	tracker.OnTick(tick(websocket.MCX_FO, "234230", 60100))
+
+	positions := tracker.Positions()
+	if len(positions) != 1 || !equal(positions[0].Unrealized, 2000) || positions[0].Lots() != 2 {
+		t.Fatalf("Expected 2 lots with 2000 unrealized, got %+v", positions)
+	}
+
+	position.BuyQuantity, position.BuyAmount = "3", "180100"
+	discrepancies, err := tracker.Reconcile()
+	if err != nil {
+		t.Fatalf("Error reconciling. %v", err)
+	}
+	if len(discrepancies) != 2 || discrepancies[0].Field != "buyquantity" || discrepancies[0].Local != 2 || discrepancies[0].Remote != 3 {
+		t.Errorf("Unexpected discrepancies %+v", discrepancies)
+	}
+	if positions := tracker.Positions(); positions[0].BuyQuantity != 3 {
+		t.Errorf("Expected the REST position to be adopted, got %+v", positions)
+	}
+}
@@ -0,0 +1,473 @@
+// Package risk checks orders against pre-trade limits before they reach the broker.
+package risk
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+// Default age of the RMS and order book snapshots used by the daily loss and open
+// order limits.
+const DEFAULT_REFRESH_INTERVAL = 5 * time.Second
+
+// Rule is a limit enforced by a Gate.
+type Rule string
+
+const (
+	RuleKillSwitch     Rule = "kill switch"
+	RuleSymbol         Rule = "allowed symbols"
+	RuleProduct        Rule = "allowed products"
+	RuleMaxQuantity    Rule = "max quantity"
+	RuleMaxOrderValue  Rule = "max order value"
+	RuleMaxOpenOrders  Rule = "max open orders"
+	RuleDailyLossLimit Rule = "daily loss limit"
+	RuleRateLimit      Rule = "order rate limit"
+)
+
+// RejectionError is the error of orders rejected by a Gate. Rejected orders are not
+// sent to the broker.
+type RejectionError struct {
+	Rule    Rule
+	Message string
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("risk: %s: %s", e.Rule, e.Message)
+}
+
+// Gate is a smartapigo.Broker enforcing limits on the orders placed and modified
+// through it. Limits are disabled until set.
+type Gate struct {
+	broker            smartapigo.Broker
+	maxOrderValue     float64
+	maxQuantity       int
+	symbolMaxQuantity map[string]int
+	maxOpenOrders     int
+	dailyLossLimit    float64
+	allowedSymbols    map[string]bool
+	allowedProducts   map[string]bool
+	rateLimit         int
+	ratePeriod        time.Duration
+	sent              []time.Time
+	refreshInterval   time.Duration
+	refreshedRMS      time.Time
+	refreshedOrders   time.Time
+	refreshing        *refreshCall
+	loss              float64
+	openOrders        int
+	prices            map[priceKey]float64
+	killed            bool
+	clock             func() time.Time
+	onReject          func(err *RejectionError)
+	mutex             sync.Mutex
+}
+
+type priceKey struct {
+	exchangeType int
+	token        string
+}
+
+var _ smartapigo.Broker = (*Gate)(nil)
+
+// NewGate creates a gate in front of broker, such as a Client.
+func NewGate(broker smartapigo.Broker) *Gate {
+	return &Gate{
+		broker:            broker,
+		symbolMaxQuantity: make(map[string]int),
+		refreshInterval:   DEFAULT_REFRESH_INTERVAL,
+		prices:            make(map[priceKey]float64),
+		clock:             time.Now,
+	}
+}
+
+// SetMaxOrderValue limits the price times quantity of an order. Market orders are
+// valued at their trigger price or at the last price received through OnTick, and
+// rejected when neither is known.
+func (g *Gate) SetMaxOrderValue(value float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.maxOrderValue = value
+}
+
+// SetMaxQuantity limits the quantity of an order of any symbol without its own limit.
+func (g *Gate) SetMaxQuantity(quantity int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.maxQuantity = quantity
+}
+
+// SetSymbolMaxQuantity limits the quantity of an order of a trading symbol.
+func (g *Gate) SetSymbolMaxQuantity(tradingSymbol string, quantity int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.symbolMaxQuantity[tradingSymbol] = quantity
+}
+
+// SetMaxOpenOrders limits the number of open orders when placing an order.
+func (g *Gate) SetMaxOpenOrders(orders int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.maxOpenOrders = orders
+}
+
+// SetDailyLossLimit rejects new orders once the realized plus unrealized M2M of
+// GetRMS is a loss of limit or more.
+func (g *Gate) SetDailyLossLimit(limit float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.dailyLossLimit = limit
+}
+
+// SetAllowedSymbols rejects orders of trading symbols not listed. No symbols allows all.
+func (g *Gate) SetAllowedSymbols(tradingSymbols ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.allowedSymbols = set(tradingSymbols)
+}
+
+// SetAllowedProducts rejects orders of product types not listed. No products allows all.
+func (g *Gate) SetAllowedProducts(productTypes ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.allowedProducts = set(productTypes)
+}
+
+// SetRateLimit rejects orders and modifications beyond count per period.
+func (g *Gate) SetRateLimit(count int, period time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.rateLimit, g.ratePeriod = count, period
+}
+
+// SetRefreshInterval sets how long the RMS and order book fetched for the daily loss
+// and open order limits are reused.
+func (g *Gate) SetRefreshInterval(interval time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.refreshInterval = interval
+}
+
+// SetClock sets the clock used by the rate limit and the refresh interval.
+func (g *Gate) SetClock(clock func() time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.clock = clock
+}
+
+// OnReject callback, called with every rejection.
+func (g *Gate) OnReject(f func(err *RejectionError)) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.onReject = f
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (g *Gate) OnMessage(message []byte) {
+	tick, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	g.OnTick(tick)
+}
+
+// OnTick records the last traded price used to value market orders.
+func (g *Gate) OnTick(tick websocket.ParsedData) {
+	if tick.LastTradedPrice <= 0 {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.prices[priceKey{int(tick.ExchangeType), tick.Token}] = tick.LastTradedPrice
+}
+
+// Kill engages the kill switch, rejecting every order and modification until Resume
+// is called, and cancels all open orders.
+func (g *Gate) Kill() error {
+	g.mutex.Lock()
+	g.killed = true
+	g.mutex.Unlock()
+
+	_, err := smartapigo.CancelAllOrders(g.broker, nil)
+	return err
+}
+
+// Resume disengages the kill switch.
+func (g *Gate) Resume() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.killed = false
+}
+
+// Killed reports whether the kill switch is engaged.
+func (g *Gate) Killed() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.killed
+}
+
+// PlaceOrder places an order if it passes every limit.
+func (g *Gate) PlaceOrder(orderParams smartapigo.OrderParams) (smartapigo.OrderResponse, error) {
+	err := g.check(order{
+		exchange:      orderParams.Exchange,
+		tradingSymbol: orderParams.TradingSymbol,
+		token:         orderParams.SymbolToken,
+		productType:   orderParams.ProductType,
+		quantity:      orderParams.Quantity,
+		price:         orderParams.Price,
+		triggerPrice:  orderParams.TriggerPrice,
+		new:           true,
+	})
+	if err != nil {
+		return smartapigo.OrderResponse{}, err
+	}
+	response, err := g.broker.PlaceOrder(orderParams)
+	if err == nil {
+		g.mutex.Lock()
+		g.openOrders++
+		g.mutex.Unlock()
+	}
+	return response, err
+}
+
+// ModifyOrder modifies an order if the modified order passes the symbol, product,
+// quantity, value and rate limits.
+func (g *Gate) ModifyOrder(modifyOrderParams smartapigo.ModifyOrderParams) (smartapigo.OrderResponse, error) {
+	err := g.check(order{
+		exchange:      modifyOrderParams.Exchange,
+		tradingSymbol: modifyOrderParams.TradingSymbol,
+		token:         modifyOrderParams.SymbolToken,
+		productType:   modifyOrderParams.ProductType,
+		quantity:      modifyOrderParams.Quantity,
+		price:         modifyOrderParams.Price,
+		triggerPrice:  modifyOrderParams.TriggerPrice,
+	})
+	if err != nil {
+		return smartapigo.OrderResponse{}, err
+	}
+	return g.broker.ModifyOrder(modifyOrderParams)
+}
+
+// CancelOrder cancels an order. Cancellations are never rejected.
+func (g *Gate) CancelOrder(variety string, orderid string) (smartapigo.OrderResponse, error) {
+	return g.broker.CancelOrder(variety, orderid)
+}
+
+// GetOrderBook gets the order book of the broker.
+func (g *Gate) GetOrderBook() (smartapigo.Orders, error) {
+	return g.broker.GetOrderBook()
+}
+
+// GetTradeBook gets the trade book of the broker.
+func (g *Gate) GetTradeBook() (smartapigo.Trades, error) {
+	return g.broker.GetTradeBook()
+}
+
+// GetPositions gets the positions of the broker.
+func (g *Gate) GetPositions() (smartapigo.Positions, error) {
+	return g.broker.GetPositions()
+}
+
+// GetRMS gets the funds and M2M of the broker.
+func (g *Gate) GetRMS() (smartapigo.RMS, error) {
+	return g.broker.GetRMS()
+}
+
+// order is the part of placed or modified orders checked by the gate.
+type order struct {
+	exchange      string
+	tradingSymbol string
+	token         string
+	productType   string
+	quantity      string
+	price         string
+	triggerPrice  string
+	new           bool
+}
+
+// check returns a RejectionError if o breaches a limit, and otherwise counts it
+// towards the rate limit. The RMS and order book are refreshed without the mutex held
+// so that ticks and other checks are not blocked by the requests.
+func (g *Gate) check(o order) error {
+	g.mutex.Lock()
+	now := g.clock()
+	err := g.checkOrderLocked(o)
+	due := false
+	if err == nil && o.new {
+		rmsDue, ordersDue := g.refreshDue(now)
+		due = rmsDue || ordersDue
+	}
+	g.mutex.Unlock()
+
+	if due {
+		err = g.refresh(now)
+	}
+
+	g.mutex.Lock()
+	if err == nil {
+		err = g.checkLocked(o, now)
+	}
+	onReject := g.onReject
+	g.mutex.Unlock()
+
+	if err != nil {
+		if rejection, ok := err.(*RejectionError); ok && onReject != nil {
+			onReject(rejection)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkLocked checks o against the limits. Must be called with the mutex held.
+func (g *Gate) checkLocked(o order, now time.Time) error {
+	if err := g.checkOrderLocked(o); err != nil {
+		return err
+	}
+	if o.new {
+		if g.dailyLossLimit > 0 && g.loss >= g.dailyLossLimit {
+			return reject(RuleDailyLossLimit, "loss %.2f reached the limit of %.2f", g.loss, g.dailyLossLimit)
+		}
+		if g.maxOpenOrders > 0 && g.openOrders >= g.maxOpenOrders {
+			return reject(RuleMaxOpenOrders, "%d orders are open", g.openOrders)
+		}
+	}
+
+	if g.rateLimit > 0 {
+		for len(g.sent) > 0 && !g.sent[0].After(now.Add(-g.ratePeriod)) {
+			g.sent = g.sent[1:]
+		}
+		if len(g.sent) >= g.rateLimit {
+			return reject(RuleRateLimit, "more than %d orders in %v", g.rateLimit, g.ratePeriod)
+		}
+		g.sent = append(g.sent, now)
+	}
+	return nil
+}
+
+// checkOrderLocked checks o against the limits not needing the account. Must be
+// called with the mutex held.
+func (g *Gate) checkOrderLocked(o order) error {
+	if g.killed {
+		return reject(RuleKillSwitch, "kill switch is engaged")
+	}
+	if g.allowedSymbols != nil && !g.allowedSymbols[o.tradingSymbol] {
+		return reject(RuleSymbol, "%s is not allowed", o.tradingSymbol)
+	}
+	if g.allowedProducts != nil && !g.allowedProducts[o.productType] {
+		return reject(RuleProduct, "product %s is not allowed", o.productType)
+	}
+
+	quantity, err := strconv.Atoi(o.quantity)
+	if err != nil || quantity <= 0 {
+		return reject(RuleMaxQuantity, "invalid quantity %q", o.quantity)
+	}
+	maxQuantity, ok := g.symbolMaxQuantity[o.tradingSymbol]
+	if !ok {
+		maxQuantity = g.maxQuantity
+	}
+	if maxQuantity > 0 && quantity > maxQuantity {
+		return reject(RuleMaxQuantity, "quantity %d of %s exceeds %d", quantity, o.tradingSymbol, maxQuantity)
+	}
+
+	if g.maxOrderValue > 0 {
+		price := parseFloat(o.price)
+		if price <= 0 {
+			price = parseFloat(o.triggerPrice)
+		}
+		if exchangeType, ok := websocket.EXCHANGE_TYPE_MAP[o.exchange]; ok && price <= 0 {
+			price = g.prices[priceKey{exchangeType, o.token}]
+		}
+		if price <= 0 {
+			return reject(RuleMaxOrderValue, "no price to value the order of %s", o.tradingSymbol)
+		}
+		if value := price * float64(quantity); value > g.maxOrderValue {
+			return reject(RuleMaxOrderValue, "value %.2f of %s exceeds %.2f", value, o.tradingSymbol, g.maxOrderValue)
+		}
+	}
+	return nil
+}
+
+// refreshDue reports whether the RMS or order book needed by the limits are older
+// than the refresh interval. Must be called with the mutex held.
+func (g *Gate) refreshDue(now time.Time) (rms bool, orders bool) {
+	rms = g.dailyLossLimit > 0 && now.Sub(g.refreshedRMS) >= g.refreshInterval
+	orders = g.maxOpenOrders > 0 && now.Sub(g.refreshedOrders) >= g.refreshInterval
+	return rms, orders
+}
+
+// refreshCall is a refresh in progress, shared by the checks waiting for it.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// refresh fetches the RMS and order book needed by the limits once they are older
+// than the refresh interval. Concurrent checks wait for a single refresh.
+func (g *Gate) refresh(now time.Time) error {
+	g.mutex.Lock()
+	if call := g.refreshing; call != nil {
+		g.mutex.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	g.refreshing = call
+	rmsDue, ordersDue := g.refreshDue(now)
+	g.mutex.Unlock()
+
+	var rms smartapigo.RMS
+	var orders smartapigo.Orders
+	var err error
+	if rmsDue {
+		rms, err = g.broker.GetRMS()
+	}
+	if err == nil && ordersDue {
+		orders, err = g.broker.GetOrderBook()
+	}
+
+	g.mutex.Lock()
+	if err == nil && rmsDue {
+		g.loss = -(parseFloat(rms.M2MRealized) + parseFloat(rms.M2MUnrealized))
+		g.refreshedRMS = now
+	}
+	if err == nil && ordersDue {
+		g.openOrders = 0
+		for _, order := range orders {
+			if order.IsOpen() {
+				g.openOrders++
+			}
+		}
+		g.refreshedOrders = now
+	}
+	call.err = err
+	g.refreshing = nil
+	g.mutex.Unlock()
+	close(call.done)
+	return err
+}
+
+func reject(rule Rule, format string, args ...interface{}) error {
+	return &RejectionError{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+func set(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
@@ -0,0 +1,223 @@
+package risk
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/smartapitest"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func orderParams(symbol, orderType, price, quantity string) smartapigo.OrderParams {
+	return smartapigo.OrderParams{
+		Variety:         "NORMAL",
+		TradingSymbol:   symbol,
+		SymbolToken:     "3045",
+		TransactionType: "BUY",
+		Exchange:        smartapigo.NSE,
+		OrderType:       orderType,
+		ProductType:     "INTRADAY",
+		Duration:        "DAY",
+		Price:           price,
+		Quantity:        quantity,
+	}
+}
+
+func rule(err error) Rule {
+	var rejection *RejectionError
+	if errors.As(err, &rejection) {
+		return rejection.Rule
+	}
+	return ""
+}
+
+func TestLimits(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	gate := NewGate(client)
+	gate.SetAllowedSymbols("SBIN-EQ")
+	gate.SetAllowedProducts("INTRADAY")
+	gate.SetMaxQuantity(100)
+	gate.SetSymbolMaxQuantity("SBIN-EQ", 50)
+	gate.SetMaxOrderValue(50000)
+	var rejections int
+	gate.OnReject(func(err *RejectionError) { rejections++ })
+
+	cases := []struct {
+		params smartapigo.OrderParams
+		rule   Rule
+	}{
+		{orderParams("INFY-EQ", "LIMIT", "1500", "1"), RuleSymbol},
+		{orderParams("SBIN-EQ", "LIMIT", "600", "500"), RuleMaxQuantity},
+		{orderParams("SBIN-EQ", "LIMIT", "1100", "50"), RuleMaxOrderValue},
+		{orderParams("SBIN-EQ", "MARKET", "0", "10"), RuleMaxOrderValue},
+	}
+	for _, c := range cases {
+		if _, err := gate.PlaceOrder(c.params); rule(err) != c.rule {
+			t.Errorf("Expected %s rejection, got %v", c.rule, err)
+		}
+	}
+	product := orderParams("SBIN-EQ", "LIMIT", "600", "1")
+	product.ProductType = "DELIVERY"
+	if _, err := gate.PlaceOrder(product); rule(err) != RuleProduct {
+		t.Errorf("Expected product rejection, got %v", err)
+	}
+	if len(client.PlaceOrderCalls) != 0 || rejections != 5 {
+		t.Fatalf("Expected 5 rejections without network calls, got %d and %d calls", rejections, len(client.PlaceOrderCalls))
+	}
+
+	// Market orders are valued at the last traded price.
+	gate.OnTick(websocket.ParsedData{SubscriptionMode: websocket.LTP_MODE, ExchangeType: websocket.NSE_CM, Token: "3045", LastTradedPrice: 600})
+	if _, err := gate.PlaceOrder(orderParams("SBIN-EQ", "MARKET", "0", "50")); err != nil {
+		t.Errorf("Expected the order to pass, got %v", err)
+	}
+	if len(client.PlaceOrderCalls) != 1 {
+		t.Errorf("Expected the order to be placed")
+	}
+}
+
+func TestAccountLimits(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	rms := smartapigo.RMS{M2MRealized: "-3000", M2MUnrealized: "1000"}
+	client.GetRMSFunc = func() (smartapigo.RMS, error) { return rms, nil }
+	client.GetOrderBookFunc = func() (smartapigo.Orders, error) {
+		return smartapigo.Orders{{OrderID: "1", Status: "open"}, {OrderID: "2", Status: "complete"}}, nil
+	}
+	now := time.Date(2023, 9, 6, 10, 0, 0, 0, time.UTC)
+	gate := NewGate(client)
+	gate.SetClock(func() time.Time { return now })
+	gate.SetMaxOpenOrders(3)
+	gate.SetDailyLossLimit(2500)
+	gate.SetRateLimit(10, time.Second)
+
+	params := orderParams("SBIN-EQ", "LIMIT", "600", "1")
+	for i := 0; i < 2; i++ {
+		if _, err := gate.PlaceOrder(params); err != nil {
+			t.Fatalf("Expected order %d to pass, got %v", i, err)
+		}
+	}
+	// One open order in the book and two placed since.
+	if _, err := gate.PlaceOrder(params); rule(err) != RuleMaxOpenOrders {
+		t.Errorf("Expected open orders rejection, got %v", err)
+	}
+
+	rms.M2MRealized = "-4000"
+	now = now.Add(DEFAULT_REFRESH_INTERVAL)
+	if _, err := gate.PlaceOrder(params); rule(err) != RuleDailyLossLimit {
+		t.Errorf("Expected daily loss rejection, got %v", err)
+	}
+
+	gate.SetDailyLossLimit(0)
+	gate.SetMaxOpenOrders(0)
+	gate.SetRateLimit(2, time.Second)
+	modify := smartapigo.ModifyOrderParams{OrderID: "1", TradingSymbol: "SBIN-EQ", Quantity: "1", Price: "600"}
+	for i := 0; i < 2; i++ {
+		if _, err := gate.ModifyOrder(modify); err != nil {
+			t.Errorf("Expected modification %d to pass, got %v", i, err)
+		}
+	}
+	if _, err := gate.ModifyOrder(modify); rule(err) != RuleRateLimit {
+		t.Errorf("Expected rate limit rejection, got %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := gate.ModifyOrder(modify); err != nil {
+		t.Errorf("Expected the rate limit to reset, got %v", err)
+	}
+}
+
+func TestSlowRefresh(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	client.GetRMSFunc = func() (smartapigo.RMS, error) {
+		started <- struct{}{}
+		<-release
+		return smartapigo.RMS{M2MRealized: "-100"}, nil
+	}
+	gate := NewGate(client)
+	gate.SetDailyLossLimit(2500)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	place := func() {
+		defer wg.Done()
+		_, err := gate.PlaceOrder(orderParams("SBIN-EQ", "LIMIT", "600", "1"))
+		errs <- err
+	}
+	wg.Add(1)
+	go place()
+	<-started
+
+	// Ticks are recorded while the RMS is being fetched.
+	ticked := make(chan struct{})
+	go func() {
+		gate.OnTick(websocket.ParsedData{SubscriptionMode: websocket.LTP_MODE, ExchangeType: websocket.NSE_CM, Token: "3045", LastTradedPrice: 600})
+		close(ticked)
+	}()
+	select {
+	case <-ticked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected OnTick not to wait for the refresh")
+	}
+
+	wg.Add(1)
+	go place()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected the orders to pass, got %v", err)
+		}
+	}
+	if client.GetRMSCalls != 1 {
+		t.Errorf("Expected concurrent refreshes to share one request, got %d", client.GetRMSCalls)
+	}
+}
+
+func TestKillSwitch(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	client.GetOrderBookFunc = func() (smartapigo.Orders, error) {
+		return smartapigo.Orders{
+			{OrderID: "1", Variety: "NORMAL", Status: "open"},
+			{OrderID: "2", Variety: "STOPLOSS", Status: "trigger pending"},
+			{OrderID: "3", Variety: "NORMAL", Status: "rejected"},
+			{OrderID: "4", Status: "open"},
+		}, nil
+	}
+	gate := NewGate(client)
+	if err := gate.Kill(); err != nil {
+		t.Fatalf("Error engaging kill switch. %v", err)
+	}
+	if len(client.CancelOrderCalls) != 3 || client.CancelOrderCalls[1].Variety != "STOPLOSS" || client.CancelOrderCalls[2].Variety != smartapigo.VarietyNormal {
+		t.Errorf("Expected all open orders to be cancelled, got %+v", client.CancelOrderCalls)
+	}
+	if _, err := gate.PlaceOrder(orderParams("SBIN-EQ", "LIMIT", "600", "1")); rule(err) != RuleKillSwitch || !gate.Killed() {
+		t.Errorf("Expected kill switch rejection, got %v", err)
+	}
+	gate.Resume()
+	if _, err := gate.PlaceOrder(orderParams("SBIN-EQ", "LIMIT", "600", "1")); err != nil {
+		t.Errorf("Expected orders after resuming, got %v", err)
+	}
+}
+
+func TestIdempotentRejection(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	gate := NewGate(client)
+	gate.SetMaxQuantity(10)
+	var rejections int
+	gate.OnReject(func(err *RejectionError) { rejections++ })
+	orders := smartapigo.NewIdempotentOrders(gate)
+	orders.SetLookupDelay(0)
+
+	// A rejection is final, it is neither looked up nor re-sent.
+	if _, err := orders.PlaceOrder(orderParams("SBIN-EQ", "LIMIT", "600", "50")); rule(err) != RuleMaxQuantity {
+		t.Errorf("Expected max quantity rejection, got %v", err)
+	}
+	if rejections != 1 || client.GetOrderBookCalls != 0 || len(client.PlaceOrderCalls) != 0 {
+		t.Errorf("Expected a single rejection without network calls, got %d rejections and %d order book calls", rejections, client.GetOrderBookCalls)
+	}
+}
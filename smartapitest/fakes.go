@@ -0,0 +1,295 @@
+package smartapitest
+
+import (
+	"sync"
+
+	SmartApi "github.com/piyushpatil22/smartapigo"
+)
+
+// The fakes below implement the service interfaces of smartapigo for unit tests.
+// Each method calls the matching Func field when set, and otherwise returns zero
+// values and a nil error. Arguments of every call are recorded in the Calls fields.
+
+var (
+	_ SmartApi.SessionService    = (*FakeSessionService)(nil)
+	_ SmartApi.OrderService      = (*FakeOrderService)(nil)
+	_ SmartApi.PortfolioService  = (*FakePortfolioService)(nil)
+	_ SmartApi.MarketDataService = (*FakeMarketDataService)(nil)
+	_ SmartApi.Broker            = (*FakeClient)(nil)
+)
+
+// FakeClient implements every service interface, and so also smartapigo.Broker.
+type FakeClient struct {
+	FakeSessionService
+	FakeOrderService
+	FakePortfolioService
+	FakeMarketDataService
+}
+
+// FakeSessionService is a fake smartapigo.SessionService.
+type FakeSessionService struct {
+	GenerateSessionFunc  func(totp string) (SmartApi.UserSession, error)
+	RenewAccessTokenFunc func(refreshToken string) (SmartApi.UserSessionTokens, error)
+	GetUserProfileFunc   func() (SmartApi.UserProfile, error)
+	LogoutFunc           func() (bool, error)
+
+	GenerateSessionCalls  []string
+	RenewAccessTokenCalls []string
+	GetUserProfileCalls   int
+	LogoutCalls           int
+
+	mutex sync.Mutex
+}
+
+func (f *FakeSessionService) GenerateSession(totp string) (SmartApi.UserSession, error) {
+	f.mutex.Lock()
+	f.GenerateSessionCalls = append(f.GenerateSessionCalls, totp)
+	fn := f.GenerateSessionFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.UserSession{}, nil
+	}
+	return fn(totp)
+}
+
+func (f *FakeSessionService) RenewAccessToken(refreshToken string) (SmartApi.UserSessionTokens, error) {
+	f.mutex.Lock()
+	f.RenewAccessTokenCalls = append(f.RenewAccessTokenCalls, refreshToken)
+	fn := f.RenewAccessTokenFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.UserSessionTokens{}, nil
+	}
+	return fn(refreshToken)
+}
+
+func (f *FakeSessionService) GetUserProfile() (SmartApi.UserProfile, error) {
+	f.mutex.Lock()
+	f.GetUserProfileCalls++
+	fn := f.GetUserProfileFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.UserProfile{}, nil
+	}
+	return fn()
+}
+
+func (f *FakeSessionService) Logout() (bool, error) {
+	f.mutex.Lock()
+	f.LogoutCalls++
+	fn := f.LogoutFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return true, nil
+	}
+	return fn()
+}
+
+// CancelOrderCall records the arguments of a CancelOrder call.
+type CancelOrderCall struct {
+	Variety string
+	OrderID string
+}
+
+// FakeOrderService is a fake smartapigo.OrderService.
+type FakeOrderService struct {
+	PlaceOrderFunc   func(orderParams SmartApi.OrderParams) (SmartApi.OrderResponse, error)
+	ModifyOrderFunc  func(modifyOrderParams SmartApi.ModifyOrderParams) (SmartApi.OrderResponse, error)
+	CancelOrderFunc  func(variety string, orderid string) (SmartApi.OrderResponse, error)
+	GetOrderBookFunc func() (SmartApi.Orders, error)
+	GetTradeBookFunc func() (SmartApi.Trades, error)
+
+	PlaceOrderCalls   []SmartApi.OrderParams
+	ModifyOrderCalls  []SmartApi.ModifyOrderParams
+	CancelOrderCalls  []CancelOrderCall
+	GetOrderBookCalls int
+	GetTradeBookCalls int
+
+	mutex sync.Mutex
+}
+
+func (f *FakeOrderService) PlaceOrder(orderParams SmartApi.OrderParams) (SmartApi.OrderResponse, error) {
+	f.mutex.Lock()
+	f.PlaceOrderCalls = append(f.PlaceOrderCalls, orderParams)
+	fn := f.PlaceOrderFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.OrderResponse{}, nil
+	}
+	return fn(orderParams)
+}
+
+func (f *FakeOrderService) ModifyOrder(modifyOrderParams SmartApi.ModifyOrderParams) (SmartApi.OrderResponse, error) {
+	f.mutex.Lock()
+	f.ModifyOrderCalls = append(f.ModifyOrderCalls, modifyOrderParams)
+	fn := f.ModifyOrderFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.OrderResponse{}, nil
+	}
+	return fn(modifyOrderParams)
+}
+
+func (f *FakeOrderService) CancelOrder(variety string, orderid string) (SmartApi.OrderResponse, error) {
+	f.mutex.Lock()
+	f.CancelOrderCalls = append(f.CancelOrderCalls, CancelOrderCall{variety, orderid})
+	fn := f.CancelOrderFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.OrderResponse{}, nil
+	}
+	return fn(variety, orderid)
+}
+
+func (f *FakeOrderService) GetOrderBook() (SmartApi.Orders, error) {
+	f.mutex.Lock()
+	f.GetOrderBookCalls++
+	fn := f.GetOrderBookFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.Orders{}, nil
+	}
+	return fn()
+}
+
+func (f *FakeOrderService) GetTradeBook() (SmartApi.Trades, error) {
+	f.mutex.Lock()
+	f.GetTradeBookCalls++
+	fn := f.GetTradeBookFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.Trades{}, nil
+	}
+	return fn()
+}
+
+// FakePortfolioService is a fake smartapigo.PortfolioService.
+type FakePortfolioService struct {
+	GetPositionsFunc      func() (SmartApi.Positions, error)
+	GetHoldingsFunc       func() (SmartApi.Holdings, error)
+	ConvertPositionFunc   func(convertPositionParams SmartApi.ConvertPositionParams) error
+	GetRMSFunc            func() (SmartApi.RMS, error)
+	GetMarginRequiredFunc func(marginParams SmartApi.MarginParams) (SmartApi.Margin, error)
+
+	GetPositionsCalls      int
+	GetHoldingsCalls       int
+	ConvertPositionCalls   []SmartApi.ConvertPositionParams
+	GetRMSCalls            int
+	GetMarginRequiredCalls []SmartApi.MarginParams
+
+	mutex sync.Mutex
+}
+
+func (f *FakePortfolioService) GetPositions() (SmartApi.Positions, error) {
+	f.mutex.Lock()
+	f.GetPositionsCalls++
+	fn := f.GetPositionsFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.Positions{}, nil
+	}
+	return fn()
+}
+
+func (f *FakePortfolioService) GetHoldings() (SmartApi.Holdings, error) {
+	f.mutex.Lock()
+	f.GetHoldingsCalls++
+	fn := f.GetHoldingsFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.Holdings{}, nil
+	}
+	return fn()
+}
+
+func (f *FakePortfolioService) ConvertPosition(convertPositionParams SmartApi.ConvertPositionParams) error {
+	f.mutex.Lock()
+	f.ConvertPositionCalls = append(f.ConvertPositionCalls, convertPositionParams)
+	fn := f.ConvertPositionFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return nil
+	}
+	return fn(convertPositionParams)
+}
+
+func (f *FakePortfolioService) GetRMS() (SmartApi.RMS, error) {
+	f.mutex.Lock()
+	f.GetRMSCalls++
+	fn := f.GetRMSFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.RMS{}, nil
+	}
+	return fn()
+}
+
+func (f *FakePortfolioService) GetMarginRequired(marginParams SmartApi.MarginParams) (SmartApi.Margin, error) {
+	f.mutex.Lock()
+	f.GetMarginRequiredCalls = append(f.GetMarginRequiredCalls, marginParams)
+	fn := f.GetMarginRequiredFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.Margin{}, nil
+	}
+	return fn(marginParams)
+}
+
+// FakeMarketDataService is a fake smartapigo.MarketDataService.
+type FakeMarketDataService struct {
+	GetLTPFunc                    func(ltpParams SmartApi.LTPParams) (SmartApi.LTPResponse, error)
+	GetCandleDataFunc             func(candleParams SmartApi.CandleParams) ([]SmartApi.Candle, error)
+	SearchScripFunc               func(payload SmartApi.SearchScripPayload) ([]SmartApi.LTPParams, error)
+	FetchDailyInstrumentsListFunc func() ([]SmartApi.Instrument, error)
+
+	GetLTPCalls                    []SmartApi.LTPParams
+	GetCandleDataCalls             []SmartApi.CandleParams
+	SearchScripCalls               []SmartApi.SearchScripPayload
+	FetchDailyInstrumentsListCalls int
+
+	mutex sync.Mutex
+}
+
+func (f *FakeMarketDataService) GetLTP(ltpParams SmartApi.LTPParams) (SmartApi.LTPResponse, error) {
+	f.mutex.Lock()
+	f.GetLTPCalls = append(f.GetLTPCalls, ltpParams)
+	fn := f.GetLTPFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return SmartApi.LTPResponse{}, nil
+	}
+	return fn(ltpParams)
+}
+
+func (f *FakeMarketDataService) GetCandleData(candleParams SmartApi.CandleParams) ([]SmartApi.Candle, error) {
+	f.mutex.Lock()
+	f.GetCandleDataCalls = append(f.GetCandleDataCalls, candleParams)
+	fn := f.GetCandleDataFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(candleParams)
+}
+
+func (f *FakeMarketDataService) SearchScrip(payload SmartApi.SearchScripPayload) ([]SmartApi.LTPParams, error) {
+	f.mutex.Lock()
+	f.SearchScripCalls = append(f.SearchScripCalls, payload)
+	fn := f.SearchScripFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(payload)
+}
+
+func (f *FakeMarketDataService) FetchDailyInstrumentsList() ([]SmartApi.Instrument, error) {
+	f.mutex.Lock()
+	f.FetchDailyInstrumentsListCalls++
+	fn := f.FetchDailyInstrumentsListFunc
+	f.mutex.Unlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn()
+}
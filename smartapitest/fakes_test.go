@@ -0,0 +1,50 @@
+package smartapitest
+
+import (
+	"testing"
+
+	SmartApi "github.com/piyushpatil22/smartapigo"
+)
+
+// exitAll is an example of strategy code written against the service interfaces.
+func exitAll(broker SmartApi.Broker) error {
+	orders, err := broker.GetOrderBook()
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if order.Status == SmartApi.OrderStatusOpen {
+			if _, err := broker.CancelOrder(order.Variety, order.OrderID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestFakeClient(t *testing.T) {
+	fake := &FakeClient{}
+	fake.GetOrderBookFunc = func() (SmartApi.Orders, error) {
+		return SmartApi.Orders{
+			{Variety: "NORMAL", OrderID: "1", Status: SmartApi.OrderStatusOpen},
+			{Variety: "NORMAL", OrderID: "2", Status: SmartApi.OrderStatusComplete},
+		}, nil
+	}
+
+	if err := exitAll(fake); err != nil {
+		t.Fatalf("Unexpected error. %v", err)
+	}
+	if fake.GetOrderBookCalls != 1 {
+		t.Errorf("Expected one order book call, got %d", fake.GetOrderBookCalls)
+	}
+	if len(fake.CancelOrderCalls) != 1 || fake.CancelOrderCalls[0] != (CancelOrderCall{"NORMAL", "1"}) {
+		t.Errorf("Expected only the open order to be cancelled, got %+v", fake.CancelOrderCalls)
+	}
+
+	fake.GetOrderBookFunc = func() (SmartApi.Orders, error) {
+		return nil, SmartApi.NewError("AB1004", "Something Went Wrong", nil)
+	}
+	if err := exitAll(fake); err == nil {
+		t.Errorf("Expected the order book error to be returned")
+	}
+}
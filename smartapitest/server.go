@@ -0,0 +1,344 @@
+// Package smartapitest provides an in-process fake of the SmartAPI REST endpoints
+// with in-memory state, so code built on smartapigo.Client can be tested offline by
+// pointing Client.SetBaseURI at Server.URL. For unit tests that do not need HTTP at
+// all, it also provides fakes of the smartapigo service interfaces.
+package smartapitest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	SmartApi "github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/internal/sim"
+)
+
+// Default cash available in RMS.
+const defaultAvailableCash = 1000000
+
+// Server is a fake SmartAPI server. Orders placed through it are matched against the
+// prices set with SetLTP and show up in the order book, trade book and positions.
+type Server struct {
+	// URL is the base URI of the server, usable with Client.SetBaseURI.
+	URL string
+
+	clientCode string
+	password   string
+	apiKey     string
+	httpServer *httptest.Server
+	session    SmartApi.UserSessionTokens
+	sessions   int
+	account    *sim.Account
+	holdings   SmartApi.Holdings
+	ltps       map[instrumentKey]SmartApi.LTPResponse
+	failures   map[string][]injectedError
+	latency    time.Duration
+	mutex      sync.Mutex
+}
+
+// injectedError is an error returned by the next call to an endpoint.
+type injectedError struct {
+	status    int
+	errorCode string
+	message   string
+}
+
+type instrumentKey struct {
+	exchange string
+	token    string
+}
+
+type envelope struct {
+	Status    bool        `json:"status"`
+	Message   string      `json:"message"`
+	ErrorCode string      `json:"errorcode"`
+	Data      interface{} `json:"data"`
+}
+
+// NewServer starts a server accepting the given credentials. The caller should call
+// Close when finished.
+func NewServer(clientCode, password, apiKey string) *Server {
+	s := &Server{
+		clientCode: clientCode,
+		password:   password,
+		apiKey:     apiKey,
+		ltps:       make(map[instrumentKey]SmartApi.LTPResponse),
+		failures:   make(map[string][]injectedError),
+	}
+	s.account = sim.NewAccount(defaultAvailableCash, s.quote)
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.httpServer.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// SetLTP sets the last traded price of an instrument and matches open orders against it.
+func (s *Server) SetLTP(exchange, tradingSymbol, symbolToken string, price float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := instrumentKey{exchange, symbolToken}
+	ltp, ok := s.ltps[key]
+	if !ok {
+		ltp = SmartApi.LTPResponse{Exchange: exchange, TradingSymbol: tradingSymbol, SymbolToken: symbolToken, Open: price, High: price, Low: price, Close: price}
+	}
+	ltp.Ltp = price
+	ltp.High = math.Max(ltp.High, price)
+	ltp.Low = math.Min(ltp.Low, price)
+	s.ltps[key] = ltp
+	s.account.Match(exchange, symbolToken)
+}
+
+// SetHoldings sets the holdings returned by GetHoldings.
+func (s *Server) SetHoldings(holdings SmartApi.Holdings) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.holdings = holdings
+}
+
+// SetAvailableCash sets the cash reported by GetRMS.
+func (s *Server) SetAvailableCash(cash float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.account.Cash = cash
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n calls to the endpoint, one of the smartapigo URI
+// constants, fail with the given HTTP status, error code and message.
+func (s *Server) FailNext(uri string, n int, status int, errorCode, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures[uri] = append(s.failures[uri], injectedError{status, errorCode, message})
+	}
+}
+
+// Session returns the tokens issued by the last login or renewal.
+func (s *Server) Session() SmartApi.UserSessionTokens {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.session
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	uri := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mutex.Lock()
+	latency := s.latency
+	var failure *injectedError
+	if pending := s.failures[uri]; len(pending) > 0 {
+		failure = &pending[0]
+		s.failures[uri] = pending[1:]
+	}
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if failure != nil {
+		writeError(w, failure.status, failure.errorCode, failure.message)
+		return
+	}
+
+	if r.Header.Get("X-PrivateKey") != s.apiKey {
+		writeError(w, http.StatusForbidden, "AG8004", "Invalid API Key")
+		return
+	}
+
+	var params map[string]interface{}
+	body := map[string]string{}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeError(w, http.StatusBadRequest, "AB4000", "Invalid request body")
+			return
+		}
+		for k, v := range params {
+			body[k] = fmt.Sprint(v)
+		}
+	}
+
+	if uri == SmartApi.URILogin {
+		s.login(w, body)
+		return
+	}
+
+	s.mutex.Lock()
+	authorized := s.session.AccessToken != "" && r.Header.Get("Authorization") == "Bearer "+s.session.AccessToken
+	s.mutex.Unlock()
+	if !authorized {
+		writeError(w, http.StatusUnauthorized, "AG8001", "Invalid Token")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch uri {
+	case SmartApi.URIUserSessionRenew:
+		if body["refreshToken"] != s.session.RefreshToken {
+			writeError(w, http.StatusOK, "AG8002", "Invalid Refresh Token")
+			return
+		}
+		s.newSession()
+		writeData(w, s.session)
+	case SmartApi.URIUserProfile:
+		writeData(w, SmartApi.UserProfile{ClientCode: s.clientCode, UserName: "Mock User", Broker: "ANGEL", Exchanges: []string{SmartApi.NSE, SmartApi.NFO, SmartApi.BSE}})
+	case SmartApi.URILogout:
+		s.session = SmartApi.UserSessionTokens{}
+		writeData(w, nil)
+	case SmartApi.URIPlaceOrder:
+		var req SmartApi.OrderParams
+		decodeParams(params, &req)
+		s.placeOrder(w, req)
+	case SmartApi.URIModifyOrder:
+		var req SmartApi.ModifyOrderParams
+		decodeParams(params, &req)
+		s.modifyOrder(w, req)
+	case SmartApi.URICancelOrder:
+		s.cancelOrder(w, body["orderid"])
+	case SmartApi.URIGetOrderBook:
+		writeData(w, s.account.Orders())
+	case SmartApi.URIGetTradeBook:
+		writeData(w, s.account.Trades())
+	case SmartApi.URIGetPositions:
+		writeData(w, s.account.Positions())
+	case SmartApi.URIGetHoldings:
+		writeData(w, s.holdings)
+	case SmartApi.URIRMS:
+		writeData(w, s.account.RMS())
+	case SmartApi.URIMargin:
+		var req SmartApi.MarginParams
+		decodeParams(params, &req)
+		writeData(w, s.margin(req))
+	case SmartApi.URILTP:
+		ltp, ok := s.ltps[instrumentKey{body["exchange"], body["symboltoken"]}]
+		if !ok {
+			writeError(w, http.StatusOK, "AB1018", "Invalid symbol token")
+			return
+		}
+		writeData(w, ltp)
+	default:
+		writeError(w, http.StatusNotFound, "AB4004", "Unknown endpoint "+uri)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, body map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if body["clientcode"] != s.clientCode || body["password"] != s.password || body["totp"] == "" {
+		writeError(w, http.StatusOK, "AB1007", "Invalid clientcode or password")
+		return
+	}
+	s.newSession()
+	writeData(w, SmartApi.UserSession{
+		UserProfile:       SmartApi.UserProfile{ClientCode: s.clientCode},
+		UserSessionTokens: s.session,
+	})
+}
+
+// newSession issues fresh tokens. Must be called with the mutex held.
+func (s *Server) newSession() {
+	s.sessions++
+	s.session = SmartApi.UserSessionTokens{
+		AccessToken:  fmt.Sprintf("mock-jwt-%d", s.sessions),
+		RefreshToken: fmt.Sprintf("mock-refresh-%d", s.sessions),
+		FeedToken:    fmt.Sprintf("mock-feed-%d", s.sessions),
+	}
+}
+
+// placeOrder validates and books an order, matching it right away. Must be called with the mutex held.
+func (s *Server) placeOrder(w http.ResponseWriter, req SmartApi.OrderParams) {
+	o, err := sim.NewOrder(req, time.Now())
+	switch {
+	case errors.Is(err, sim.ErrInvalidQuantity):
+		writeError(w, http.StatusOK, "AB4008", "Invalid quantity")
+		return
+	case errors.Is(err, sim.ErrInvalidTransactionType):
+		writeError(w, http.StatusOK, "AB4009", "Invalid transaction type")
+		return
+	case err != nil:
+		writeError(w, http.StatusOK, "AB4011", "Invalid order: "+err.Error())
+		return
+	}
+	o.OrderID = fmt.Sprintf("%015d", 201020000000000+s.account.NextOrderID())
+	if req.OrderType == SmartApi.OrderTypeMarket {
+		if _, ok := s.ltps[instrumentKey{req.Exchange, req.SymbolToken}]; !ok {
+			o.Reject("No market price available")
+		}
+	}
+	s.account.Add(o)
+	writeData(w, SmartApi.OrderResponse{Script: req.TradingSymbol, OrderID: o.OrderID})
+}
+
+// modifyOrder changes a pending order. Must be called with the mutex held.
+func (s *Server) modifyOrder(w http.ResponseWriter, req SmartApi.ModifyOrderParams) {
+	o, err := s.account.Modify(req, time.Now())
+	if err != nil {
+		writeError(w, http.StatusOK, "AB4010", "Order not found or not pending")
+		return
+	}
+	writeData(w, SmartApi.OrderResponse{Script: o.TradingSymbol, OrderID: o.OrderID})
+}
+
+// cancelOrder cancels a pending order. Must be called with the mutex held.
+func (s *Server) cancelOrder(w http.ResponseWriter, orderID string) {
+	o, err := s.account.Cancel(orderID, time.Now())
+	if err != nil {
+		writeError(w, http.StatusOK, "AB4010", "Order not found or not pending")
+		return
+	}
+	writeData(w, SmartApi.OrderResponse{Script: o.TradingSymbol, OrderID: o.OrderID})
+}
+
+// quote returns the last traded price of an instrument as a quote. Must be called
+// with the mutex held.
+func (s *Server) quote(exchange, token string) (sim.Quote, bool) {
+	ltp, ok := s.ltps[instrumentKey{exchange, token}]
+	return sim.Quote{LTP: ltp.Ltp, Time: time.Now()}, ok
+}
+
+// margin values every position at its price, or its LTP for market orders, without
+// any hedge benefit. Must be called with the mutex held.
+func (s *Server) margin(req SmartApi.MarginParams) SmartApi.Margin {
+	var total float64
+	for _, p := range req.Positions {
+		price := p.Price
+		if price <= 0 {
+			price = s.ltps[instrumentKey{p.Exchange, p.Token}].Ltp
+		}
+		total += price * float64(p.Quantity)
+	}
+	return SmartApi.Margin{TotalMarginRequired: total}
+}
+
+// decodeParams converts request params into the target struct.
+func decodeParams(params map[string]interface{}, v interface{}) {
+	data, _ := json.Marshal(params)
+	json.Unmarshal(data, v)
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelope{Status: true, Message: "SUCCESS", Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, errorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(envelope{Status: false, Message: message, ErrorCode: errorCode})
+}
@@ -0,0 +1,161 @@
+package smartapitest
+
+import (
+	"testing"
+
+	SmartApi "github.com/piyushpatil22/smartapigo"
+)
+
+func newTestClient(t *testing.T, server *Server) *SmartApi.Client {
+	client := SmartApi.New("client", "password", "key")
+	client.SetBaseURI(server.URL)
+	client.SetMachineInfo("192.168.1.2", "203.0.113.10", "00:00:5e:00:53:01")
+	if _, err := client.GenerateSession("123456"); err != nil {
+		t.Fatalf("Error generating session. %v", err)
+	}
+	return client
+}
+
+func orderParams(transactionType, orderType, price, quantity string) SmartApi.OrderParams {
+	return SmartApi.OrderParams{
+		Variety:         "NORMAL",
+		TradingSymbol:   "SBIN-EQ",
+		SymbolToken:     "3045",
+		TransactionType: transactionType,
+		Exchange:        "NSE",
+		OrderType:       orderType,
+		ProductType:     "INTRADAY",
+		Duration:        "DAY",
+		Price:           price,
+		SquareOff:       "0",
+		StopLoss:        "0",
+		Quantity:        quantity,
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	server := NewServer("client", "password", "key")
+	defer server.Close()
+
+	client := SmartApi.New("client", "wrong", "key")
+	client.SetBaseURI(server.URL)
+	client.SetMachineInfo("192.168.1.2", "203.0.113.10", "00:00:5e:00:53:01")
+	if _, err := client.GenerateSession("123456"); err == nil {
+		t.Errorf("Expected login with a wrong password to fail")
+	}
+	if _, err := client.GetOrderBook(); err == nil {
+		t.Errorf("Expected an unauthenticated request to fail")
+	}
+
+	client = newTestClient(t, server)
+	profile, err := client.GetUserProfile()
+	if err != nil || profile.ClientCode != "client" {
+		t.Errorf("Unexpected profile %+v. %v", profile, err)
+	}
+	tokens, err := client.RenewAccessToken(server.Session().RefreshToken)
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Error renewing session. %v", err)
+	}
+	if _, err := client.GetUserProfile(); err != nil {
+		t.Errorf("Expected the renewed token to be accepted. %v", err)
+	}
+	if _, err := client.Logout(); err != nil {
+		t.Errorf("Error logging out. %v", err)
+	}
+	if _, err := client.GetUserProfile(); err == nil {
+		t.Errorf("Expected requests after logout to fail")
+	}
+}
+
+func TestServerMarketOrder(t *testing.T) {
+	server := NewServer("client", "password", "key")
+	defer server.Close()
+	server.SetLTP("NSE", "SBIN-EQ", "3045", 590.5)
+	client := newTestClient(t, server)
+
+	response, err := client.PlaceOrder(orderParams("BUY", "MARKET", "0", "10"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+
+	orders, err := client.GetOrderBook()
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("Unexpected order book %+v. %v", orders, err)
+	}
+	if orders[0].OrderID != response.OrderID || orders[0].Status != SmartApi.OrderStatusComplete || orders[0].AveragePrice != "590.50" {
+		t.Errorf("Expected order to be filled at 590.50, got %+v", orders[0])
+	}
+
+	trades, err := client.GetTradeBook()
+	if err != nil || len(trades) != 1 || trades[0].FillSize != "10" {
+		t.Errorf("Unexpected trade book %+v. %v", trades, err)
+	}
+
+	server.SetLTP("NSE", "SBIN-EQ", "3045", 592.5)
+	positions, err := client.GetPositions()
+	if err != nil || len(positions) != 1 || positions[0].NetQty != "10" {
+		t.Fatalf("Unexpected positions %+v. %v", positions, err)
+	}
+	rms, err := client.GetRMS()
+	if err != nil || rms.M2MUnrealized != "20.00" {
+		t.Errorf("Expected unrealized M2M of 20.00, got %+v. %v", rms, err)
+	}
+
+	margin, err := client.GetMarginRequired(SmartApi.MarginParams{Positions: []SmartApi.MarginPosition{
+		{Exchange: "NSE", Token: "3045", Quantity: 10, ProductType: "INTRADAY", TradeType: "BUY", OrderType: "MARKET"},
+	}})
+	if err != nil || margin.TotalMarginRequired != 5925 {
+		t.Errorf("Expected margin of 5925, got %+v. %v", margin, err)
+	}
+}
+
+func TestServerLimitOrder(t *testing.T) {
+	server := NewServer("client", "password", "key")
+	defer server.Close()
+	server.SetLTP("NSE", "SBIN-EQ", "3045", 590.5)
+	client := newTestClient(t, server)
+
+	filled, err := client.PlaceOrder(orderParams("SELL", "LIMIT", "592", "5"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	cancelled, err := client.PlaceOrder(orderParams("SELL", "LIMIT", "600", "5"))
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+
+	server.SetLTP("NSE", "SBIN-EQ", "3045", 592.25)
+	if _, err := client.CancelOrder("NORMAL", cancelled.OrderID); err != nil {
+		t.Fatalf("Error cancelling order. %v", err)
+	}
+	if _, err := client.CancelOrder("NORMAL", filled.OrderID); err == nil {
+		t.Errorf("Expected cancelling a complete order to fail")
+	}
+
+	orders, err := client.GetOrderBook()
+	if err != nil || len(orders) != 2 {
+		t.Fatalf("Unexpected order book %+v. %v", orders, err)
+	}
+	if orders[0].Status != SmartApi.OrderStatusComplete || orders[0].AveragePrice != "592.25" {
+		t.Errorf("Expected the first order to fill at 592.25, got %+v", orders[0])
+	}
+	if orders[1].Status != SmartApi.OrderStatusCancelled {
+		t.Errorf("Expected the second order to be cancelled, got %+v", orders[1])
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	server := NewServer("client", "password", "key")
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	server.FailNext(SmartApi.URIGetOrderBook, 1, 500, "AB1004", "Something Went Wrong")
+	_, err := client.GetOrderBook()
+	apiErr, ok := err.(SmartApi.Error)
+	if !ok || apiErr.Code != "AB1004" {
+		t.Fatalf("Expected injected error AB1004, got %v", err)
+	}
+	if _, err := client.GetOrderBook(); err != nil {
+		t.Errorf("Expected only one call to fail. %v", err)
+	}
+}
@@ -0,0 +1,538 @@
+// Package squareoff closes intraday positions before the broker's auto square-off.
+package squareoff
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/pnl"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+// Default wait between placing the exit orders and verifying the positions are flat.
+const DEFAULT_VERIFY_DELAY = 5 * time.Second
+
+var (
+	// DEFAULT_TIMES are the square-off times of exchange segments, in IST, ahead of
+	// the broker's auto square-off.
+	DEFAULT_TIMES = map[string]time.Duration{
+		smartapigo.NSE: 15*time.Hour + 15*time.Minute,
+		smartapigo.BSE: 15*time.Hour + 15*time.Minute,
+		smartapigo.NFO: 15*time.Hour + 15*time.Minute,
+		smartapigo.BFO: 15*time.Hour + 15*time.Minute,
+		smartapigo.CDS: 16*time.Hour + 45*time.Minute,
+		smartapigo.MCX: 23*time.Hour + 15*time.Minute,
+	}
+
+	ErrNotFlat = fmt.Errorf("positions still open after square-off")
+)
+
+// Strategies attributes orders and positions to strategies. It is implemented by
+// pnl.Tracker.
+type Strategies interface {
+	Strategy(orderID string) string
+	StrategyPositions(strategy string) []pnl.Position
+}
+
+// CancelledOrder is an open order cancelled by a square-off.
+type CancelledOrder struct {
+	Order smartapigo.Order
+	Err   error
+}
+
+// Exit is an order closing a position. When the exit orders of a position can not
+// be built, Params only identifies the position and Err holds the reason.
+type Exit struct {
+	Params  smartapigo.OrderParams
+	OrderID string
+	Err     error
+}
+
+// OpenPosition is a position left open after a square-off.
+type OpenPosition struct {
+	Exchange      string
+	TradingSymbol string
+	ProductType   string
+	Quantity      int
+}
+
+// Report is the outcome of a square-off.
+type Report struct {
+	Time      time.Time
+	Exchanges []string
+	// Whether orders were only reported and not sent.
+	DryRun    bool
+	Cancelled []CancelledOrder
+	Exits     []Exit
+	// Positions still open after the exits, excluding those of excluded strategies.
+	// It is not verified in dry-run mode.
+	Open []OpenPosition
+	Flat bool
+}
+
+// Scheduler squares off the positions of a broker at the time of each exchange
+// segment. Open orders of the cancel product types are cancelled and the positions
+// of the square-off product types closed.
+type Scheduler struct {
+	broker           smartapigo.Broker
+	times            map[string]time.Duration
+	productTypes     map[string]bool
+	cancelTypes      map[string]bool
+	dryRun           bool
+	limitBuffer      float64
+	verifyDelay      time.Duration
+	strategies       Strategies
+	excluded         map[string]bool
+	freezeQuantities map[string]int
+	prices           map[priceKey]float64
+	calendar         *calendar.Calendar
+	clock            func() time.Time
+	onReport         func(report Report, err error)
+	mutex            sync.Mutex
+}
+
+type priceKey struct {
+	exchangeType int
+	token        string
+}
+
+type positionKey struct {
+	exchange      string
+	tradingSymbol string
+	productType   string
+}
+
+// NewScheduler creates a scheduler of the positions of broker, such as a Client, at
+// DEFAULT_TIMES. It cancels open INTRADAY orders and closes INTRADAY and MARGIN
+// positions with market orders.
+func NewScheduler(broker smartapigo.Broker) *Scheduler {
+	times := make(map[string]time.Duration, len(DEFAULT_TIMES))
+	for exchange, at := range DEFAULT_TIMES {
+		times[exchange] = at
+	}
+	return &Scheduler{
+		broker:           broker,
+		times:            times,
+		productTypes:     map[string]bool{smartapigo.ProductTypeIntraday: true, smartapigo.ProductTypeMargin: true},
+		cancelTypes:      map[string]bool{smartapigo.ProductTypeIntraday: true},
+		verifyDelay:      DEFAULT_VERIFY_DELAY,
+		excluded:         make(map[string]bool),
+		freezeQuantities: make(map[string]int),
+		prices:           make(map[priceKey]float64),
+		clock:            time.Now,
+	}
+}
+
+// SetTime sets the square-off time of an exchange segment, in IST.
+func (s *Scheduler) SetTime(exchange string, hour, minute int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.times[exchange] = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// Disable stops squaring off an exchange segment on schedule.
+func (s *Scheduler) Disable(exchange string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.times, exchange)
+}
+
+// SetProductTypes sets the product types of the positions closed.
+func (s *Scheduler) SetProductTypes(productTypes ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.productTypes = make(map[string]bool, len(productTypes))
+	for _, productType := range productTypes {
+		s.productTypes[productType] = true
+	}
+}
+
+// SetCancelProductTypes sets the product types of the open orders cancelled,
+// INTRADAY by default.
+func (s *Scheduler) SetCancelProductTypes(productTypes ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cancelTypes = make(map[string]bool, len(productTypes))
+	for _, productType := range productTypes {
+		s.cancelTypes[productType] = true
+	}
+}
+
+// SetDryRun reports the orders that would be cancelled and placed without sending them.
+func (s *Scheduler) SetDryRun(dryRun bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dryRun = dryRun
+}
+
+// SetLimitOrders closes positions with limit orders priced buffer, a fraction of the
+// price, beyond the last price received through OnTick. Positions without a known
+// price are closed at market. A buffer of 0 closes all positions at market.
+func (s *Scheduler) SetLimitOrders(buffer float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limitBuffer = buffer
+}
+
+// SetVerifyDelay sets the wait before checking that positions are flat.
+func (s *Scheduler) SetVerifyDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.verifyDelay = delay
+}
+
+// SetFreezeQuantity sets the largest quantity of an order of an underlying, such as
+// NIFTY, beyond which exits are split into several orders.
+func (s *Scheduler) SetFreezeQuantity(symbolName string, quantity int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.freezeQuantities[symbolName] = quantity
+}
+
+// SetStrategies sets the attribution of orders and positions to strategies used by
+// Exclude, usually a pnl.Tracker.
+func (s *Scheduler) SetStrategies(strategies Strategies) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.strategies = strategies
+}
+
+// Exclude leaves the orders and positions of strategies untouched. It requires
+// SetStrategies.
+func (s *Scheduler) Exclude(strategies ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, strategy := range strategies {
+		s.excluded[strategy] = true
+	}
+}
+
+// SetCalendar skips the exchange segments closed for the day according to cal.
+// Without a calendar, Run squares off every day.
+func (s *Scheduler) SetCalendar(cal *calendar.Calendar) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calendar = cal
+}
+
+// SetClock sets the time source of the schedule.
+func (s *Scheduler) SetClock(clock func() time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clock = clock
+}
+
+// OnReport callback, called by Run after each square-off.
+func (s *Scheduler) OnReport(f func(report Report, err error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onReport = f
+}
+
+// OnMessage decodes a SmartStream packet and passes it to OnTick. It can be
+// registered directly with SocketClientV2.OnMessage. Invalid packets are ignored.
+func (s *Scheduler) OnMessage(message []byte) {
+	tick, err := websocket.ParseBinaryData(message)
+	if err != nil {
+		return
+	}
+	s.OnTick(tick)
+}
+
+// OnTick records the last traded price used to price limit orders.
+func (s *Scheduler) OnTick(tick websocket.ParsedData) {
+	if tick.LastTradedPrice <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prices[priceKey{int(tick.ExchangeType), tick.Token}] = tick.LastTradedPrice
+}
+
+// Run squares off each exchange segment daily at its time until ctx is done. Times
+// already past when Run is called are first due the next day. Reports are passed to
+// OnReport.
+func (s *Scheduler) Run(ctx context.Context) error {
+	after := s.now()
+	for {
+		due, exchanges := s.next(after)
+		if len(exchanges) == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		timer := time.NewTimer(due.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		after = due
+
+		exchanges = s.tradingExchanges(exchanges, due)
+		if len(exchanges) == 0 {
+			continue
+		}
+		report, err := s.SquareOff(exchanges...)
+		s.mutex.Lock()
+		onReport := s.onReport
+		s.mutex.Unlock()
+		if onReport != nil {
+			onReport(report, err)
+		}
+	}
+}
+
+// tradingExchanges returns the exchange segments trading on the day of t.
+func (s *Scheduler) tradingExchanges(exchanges []string, t time.Time) []string {
+	s.mutex.Lock()
+	cal := s.calendar
+	s.mutex.Unlock()
+	if cal == nil {
+		return exchanges
+	}
+	var trading []string
+	for _, exchange := range exchanges {
+		if cal.IsTradingDay(exchange, t) {
+			trading = append(trading, exchange)
+		}
+	}
+	return trading
+}
+
+// next returns the first square-off time after a time and its exchange segments.
+func (s *Scheduler) next(after time.Time) (time.Time, []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	after = after.In(calendar.IST)
+	midnight := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, calendar.IST)
+
+	var next time.Time
+	var exchanges []string
+	for exchange, at := range s.times {
+		due := midnight.Add(at)
+		if !due.After(after) {
+			due = midnight.AddDate(0, 0, 1).Add(at)
+		}
+		switch {
+		case len(exchanges) == 0 || due.Before(next):
+			next, exchanges = due, []string{exchange}
+		case due.Equal(next):
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	sort.Strings(exchanges)
+	return next, exchanges
+}
+
+// SquareOff cancels the open orders and closes the positions of the exchange segments,
+// or of all segments if none are given, then checks that the positions are flat.
+// Failed cancellations and exits don't stop the others, the first failure is returned,
+// or ErrNotFlat if positions are still open.
+func (s *Scheduler) SquareOff(exchanges ...string) (Report, error) {
+	s.mutex.Lock()
+	report := Report{Time: s.clock(), Exchanges: exchanges, DryRun: s.dryRun}
+	verifyDelay := s.verifyDelay
+	s.mutex.Unlock()
+	segments := make(map[string]bool, len(exchanges))
+	for _, exchange := range exchanges {
+		segments[exchange] = true
+	}
+	inScope := func(exchange, productType string) bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return (len(segments) == 0 || segments[exchange]) && s.productTypes[productType]
+	}
+	cancels := func(exchange, productType string) bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return (len(segments) == 0 || segments[exchange]) && s.cancelTypes[productType]
+	}
+
+	orders, err := s.broker.GetOrderBook()
+	if err != nil {
+		return report, err
+	}
+	var firstErr error
+	for _, order := range orders {
+		if !order.IsOpen() || !cancels(order.Exchange, order.ProductType) || s.excludedOrder(order.OrderID) {
+			continue
+		}
+		cancelled := CancelledOrder{Order: order}
+		if !report.DryRun {
+			variety := order.Variety
+			if variety == "" {
+				variety = smartapigo.VarietyNormal
+			}
+			if _, cancelled.Err = s.broker.CancelOrder(variety, order.OrderID); cancelled.Err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("cancelling order %s: %w", order.OrderID, cancelled.Err)
+			}
+		}
+		report.Cancelled = append(report.Cancelled, cancelled)
+	}
+
+	open, err := s.openPositions(inScope)
+	if err != nil {
+		return report, err
+	}
+	for _, position := range open {
+		exits, err := s.exitOrders(position)
+		if err != nil {
+			// Identify the position left open, as there is no order to report.
+			report.Exits = append(report.Exits, Exit{
+				Params: smartapigo.OrderParams{
+					TradingSymbol: position.Tradingsymbol,
+					SymbolToken:   position.SymbolToken,
+					Exchange:      position.Exchange,
+					ProductType:   position.ProductType,
+				},
+				Err: err,
+			})
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, params := range exits {
+			exit := Exit{Params: params}
+			if !report.DryRun {
+				var response smartapigo.OrderResponse
+				response, exit.Err = s.broker.PlaceOrder(params)
+				exit.OrderID = response.OrderID
+				if exit.Err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("closing %s: %w", position.Tradingsymbol, exit.Err)
+				}
+			}
+			report.Exits = append(report.Exits, exit)
+		}
+	}
+	if report.DryRun {
+		return report, firstErr
+	}
+
+	if len(report.Exits) > 0 {
+		time.Sleep(verifyDelay)
+	}
+	if report.Open, err = s.openPositionList(inScope); err != nil {
+		return report, err
+	}
+	report.Flat = len(report.Open) == 0
+	if firstErr == nil && !report.Flat {
+		firstErr = fmt.Errorf("%w: %d positions", ErrNotFlat, len(report.Open))
+	}
+	return report, firstErr
+}
+
+func (s *Scheduler) openPositionList(inScope func(exchange, productType string) bool) ([]OpenPosition, error) {
+	open, err := s.openPositions(inScope)
+	if err != nil {
+		return nil, err
+	}
+	var list []OpenPosition
+	for _, position := range open {
+		list = append(list, OpenPosition{
+			Exchange:      position.Exchange,
+			TradingSymbol: position.Tradingsymbol,
+			ProductType:   position.ProductType,
+			Quantity:      position.NetQuantity(),
+		})
+	}
+	return list, nil
+}
+
+// openPositions returns the positions in scope with their net quantity less the
+// positions of excluded strategies.
+func (s *Scheduler) openPositions(inScope func(exchange, productType string) bool) (smartapigo.Positions, error) {
+	positions, err := s.broker.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	excluded := s.excludedQuantities()
+
+	var open smartapigo.Positions
+	for _, position := range positions {
+		if !inScope(position.Exchange, position.ProductType) {
+			continue
+		}
+		quantity := position.NetQuantity() - excluded[positionKey{position.Exchange, position.Tradingsymbol, position.ProductType}]
+		if quantity == 0 {
+			continue
+		}
+		position.NetQty = strconv.Itoa(quantity)
+		open = append(open, position)
+	}
+	return open, nil
+}
+
+func (s *Scheduler) excludedQuantities() map[positionKey]int {
+	s.mutex.Lock()
+	strategies := s.strategies
+	excluded := make([]string, 0, len(s.excluded))
+	for strategy := range s.excluded {
+		excluded = append(excluded, strategy)
+	}
+	s.mutex.Unlock()
+
+	quantities := make(map[positionKey]int)
+	if strategies == nil {
+		return quantities
+	}
+	for _, strategy := range excluded {
+		for _, position := range strategies.StrategyPositions(strategy) {
+			quantities[positionKey{position.Exchange, position.TradingSymbol, position.ProductType}] += position.NetQuantity()
+		}
+	}
+	return quantities
+}
+
+func (s *Scheduler) excludedOrder(orderID string) bool {
+	s.mutex.Lock()
+	strategies := s.strategies
+	s.mutex.Unlock()
+	if strategies == nil {
+		return false
+	}
+	strategy := strategies.Strategy(orderID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.excluded[strategy]
+}
+
+// exitOrders returns the orders closing the net quantity of a position.
+func (s *Scheduler) exitOrders(position smartapigo.Position) ([]smartapigo.OrderParams, error) {
+	s.mutex.Lock()
+	freezeQuantity := s.freezeQuantities[position.SymbolName]
+	buffer := s.limitBuffer
+	price := s.prices[priceKey{websocket.EXCHANGE_TYPE_MAP[position.Exchange], position.SymbolToken}]
+	s.mutex.Unlock()
+
+	exits, err := position.ExitOrders(freezeQuantity)
+	if err != nil || buffer <= 0 || price <= 0 {
+		return exits, err
+	}
+	// Priced through the touch so the orders fill like market orders, within a bounded
+	// distance of the last price.
+	if exits[0].TransactionType == smartapigo.TransactionTypeBuy {
+		price = math.Ceil(price*(1+buffer)*20) / 20
+	} else {
+		price = math.Floor(price*(1-buffer)*20) / 20
+	}
+	for i := range exits {
+		exits[i].OrderType = smartapigo.OrderTypeLimit
+		exits[i].Price = strconv.FormatFloat(price, 'f', 2, 64)
+	}
+	return exits, nil
+}
+
+func (s *Scheduler) now() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.clock()
+}
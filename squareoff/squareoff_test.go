@@ -0,0 +1,222 @@
+package squareoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+	"github.com/piyushpatil22/smartapigo/paper"
+	"github.com/piyushpatil22/smartapigo/pnl"
+	"github.com/piyushpatil22/smartapigo/smartapitest"
+	"github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func tick(token string, price float64) websocket.ParsedData {
+	return websocket.ParsedData{
+		SubscriptionMode: websocket.LTP_MODE,
+		ExchangeType:     websocket.NSE_CM,
+		Token:            token,
+		LastTradedPrice:  price,
+	}
+}
+
+func placeOrder(t *testing.T, engine *paper.Engine, symbol, token, transactionType, productType, quantity, price string) string {
+	orderType := smartapigo.OrderTypeMarket
+	if price != "0" {
+		orderType = smartapigo.OrderTypeLimit
+	}
+	response, err := engine.PlaceOrder(smartapigo.OrderParams{
+		Variety:         smartapigo.VarietyNormal,
+		TradingSymbol:   symbol,
+		SymbolToken:     token,
+		TransactionType: transactionType,
+		Exchange:        smartapigo.NSE,
+		OrderType:       orderType,
+		ProductType:     productType,
+		Duration:        smartapigo.DurationDay,
+		Price:           price,
+		Quantity:        quantity,
+	})
+	if err != nil {
+		t.Fatalf("Error placing order. %v", err)
+	}
+	return response.OrderID
+}
+
+func netQuantities(t *testing.T, engine *paper.Engine) map[string]string {
+	positions, err := engine.GetPositions()
+	if err != nil {
+		t.Fatalf("Error fetching positions. %v", err)
+	}
+	quantities := make(map[string]string)
+	for _, position := range positions {
+		quantities[position.Tradingsymbol+"/"+position.ProductType] = position.NetQty
+	}
+	return quantities
+}
+
+func newEngine(t *testing.T) *paper.Engine {
+	engine := paper.NewEngine(1000000)
+	engine.OnTick(tick("3045", 100))
+	engine.OnTick(tick("1594", 1500))
+	placeOrder(t, engine, "SBIN-EQ", "3045", "BUY", smartapigo.ProductTypeIntraday, "10", "0")
+	placeOrder(t, engine, "INFY-EQ", "1594", "SELL", smartapigo.ProductTypeMargin, "5", "0")
+	placeOrder(t, engine, "SBIN-EQ", "3045", "BUY", smartapigo.ProductTypeDelivery, "3", "0")
+	placeOrder(t, engine, "SBIN-EQ", "3045", "BUY", smartapigo.ProductTypeIntraday, "10", "90")
+	return engine
+}
+
+func TestSquareOff(t *testing.T) {
+	engine := newEngine(t)
+	// Open MARGIN orders are left alone.
+	placeOrder(t, engine, "INFY-EQ", "1594", "BUY", smartapigo.ProductTypeMargin, "1", "1000")
+	scheduler := NewScheduler(engine)
+	scheduler.SetVerifyDelay(0)
+
+	scheduler.SetDryRun(true)
+	scheduler.SetLimitOrders(0.01)
+	scheduler.OnTick(tick("3045", 100))
+	report, err := scheduler.SquareOff()
+	if err != nil || len(report.Cancelled) != 1 || len(report.Exits) != 2 || report.Flat {
+		t.Fatalf("Unexpected dry-run report %+v. %v", report, err)
+	}
+	if exit := report.Exits[0].Params; exit.TransactionType != "SELL" || exit.Quantity != "10" || exit.OrderType != smartapigo.OrderTypeLimit || exit.Price != "99.00" {
+		t.Errorf("Unexpected limit exit %+v", exit)
+	}
+	if exit := report.Exits[1].Params; exit.TransactionType != "BUY" || exit.Quantity != "5" || exit.OrderType != smartapigo.OrderTypeMarket {
+		t.Errorf("Expected a market exit without a known price, got %+v", exit)
+	}
+	if quantities := netQuantities(t, engine); quantities["SBIN-EQ/INTRADAY"] != "10" {
+		t.Errorf("Expected nothing to be sent in dry-run mode, got %v", quantities)
+	}
+
+	scheduler.SetDryRun(false)
+	scheduler.SetLimitOrders(0)
+	report, err = scheduler.SquareOff()
+	if err != nil || !report.Flat || report.Exits[0].OrderID == "" {
+		t.Fatalf("Unexpected report %+v. %v", report, err)
+	}
+	quantities := netQuantities(t, engine)
+	if quantities["SBIN-EQ/INTRADAY"] != "0" || quantities["INFY-EQ/MARGIN"] != "0" || quantities["SBIN-EQ/DELIVERY"] != "3" {
+		t.Errorf("Expected intraday and margin positions only to be closed, got %v", quantities)
+	}
+	orders, _ := engine.GetOrderBook()
+	if status := orders[3].Status; status != smartapigo.OrderStatusCancelled {
+		t.Errorf("Expected the open intraday order to be cancelled, got %s", status)
+	}
+	if status := orders[4].Status; status != smartapigo.OrderStatusOpen {
+		t.Errorf("Expected the open margin order to stay open, got %s", status)
+	}
+}
+
+func TestSquareOffExclusions(t *testing.T) {
+	engine := newEngine(t)
+	tracker := pnl.NewTracker(engine)
+	if err := tracker.Sync(); err != nil {
+		t.Fatalf("Error syncing. %v", err)
+	}
+	orders, _ := engine.GetOrderBook()
+	tracker.Assign(orders[0].OrderID, "hedge")
+	tracker.Assign(orders[3].OrderID, "hedge")
+	placeOrder(t, engine, "SBIN-EQ", "3045", "SELL", smartapigo.ProductTypeIntraday, "4", "0")
+
+	scheduler := NewScheduler(engine)
+	scheduler.SetVerifyDelay(0)
+	scheduler.SetStrategies(tracker)
+	scheduler.Exclude("hedge")
+	report, err := scheduler.SquareOff(smartapigo.NSE)
+	if err != nil || !report.Flat || len(report.Cancelled) != 0 {
+		t.Fatalf("Unexpected report %+v. %v", report, err)
+	}
+	if len(report.Exits) != 2 || report.Exits[0].Params.TransactionType != "BUY" || report.Exits[0].Params.Quantity != "4" {
+		t.Errorf("Expected the unassigned short of 4 to be closed, got %+v", report.Exits)
+	}
+	if quantities := netQuantities(t, engine); quantities["SBIN-EQ/INTRADAY"] != "10" {
+		t.Errorf("Expected the hedge position to be left open, got %v", quantities)
+	}
+}
+
+func TestSquareOffNotFlat(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	engine.OnTick(tick("3045", 100))
+	placeOrder(t, engine, "SBIN-EQ", "3045", "BUY", smartapigo.ProductTypeIntraday, "10", "0")
+
+	scheduler := NewScheduler(engine)
+	scheduler.SetVerifyDelay(0)
+	// The exit is priced below the market and stays open.
+	scheduler.SetLimitOrders(0.5)
+	scheduler.OnTick(tick("3045", 300))
+	report, err := scheduler.SquareOff()
+	if !errors.Is(err, ErrNotFlat) || report.Flat || len(report.Open) != 1 || report.Open[0].Quantity != 10 {
+		t.Errorf("Expected the position to be reported open, got %+v. %v", report, err)
+	}
+}
+
+func TestSquareOffInvalidPosition(t *testing.T) {
+	client := &smartapitest.FakeClient{}
+	client.GetPositionsFunc = func() (smartapigo.Positions, error) {
+		return smartapigo.Positions{{
+			Exchange:      smartapigo.NFO,
+			Tradingsymbol: "NIFTY24JANFUT",
+			SymbolToken:   "35001",
+			ProductType:   smartapigo.ProductTypeMargin,
+			NetQty:        "10",
+			LotSize:       "25",
+		}}, nil
+	}
+
+	scheduler := NewScheduler(client)
+	scheduler.SetVerifyDelay(0)
+	report, err := scheduler.SquareOff()
+	if !errors.Is(err, smartapigo.ErrInvalidOrderParams) || len(report.Exits) != 1 {
+		t.Fatalf("Expected the exit to fail, got %+v. %v", report, err)
+	}
+	exit := report.Exits[0]
+	if exit.Params.TradingSymbol != "NIFTY24JANFUT" || exit.Params.SymbolToken != "35001" || exit.Params.Exchange != smartapigo.NFO || exit.Params.ProductType != smartapigo.ProductTypeMargin {
+		t.Errorf("Expected the failed exit to identify the position, got %+v", exit.Params)
+	}
+	if len(client.PlaceOrderCalls) != 0 {
+		t.Errorf("Expected no orders, got %d", len(client.PlaceOrderCalls))
+	}
+}
+
+func TestRun(t *testing.T) {
+	engine := paper.NewEngine(1000000)
+	scheduler := NewScheduler(engine)
+	scheduler.SetVerifyDelay(0)
+	now := time.Date(2024, 3, 1, 15, 14, 59, 950000000, calendar.IST)
+	scheduler.SetClock(func() time.Time { return now })
+	reports := make(chan Report, 1)
+	scheduler.OnReport(func(report Report, err error) { reports <- report })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- scheduler.Run(ctx) }()
+	select {
+	case report := <-reports:
+		if len(report.Exchanges) != 4 || report.Exchanges[3] != smartapigo.NSE || !report.Flat {
+			t.Errorf("Expected the equity and F&O segments to be squared off, got %+v", report)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Square-off not run")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	due, exchanges := scheduler.next(now.Add(time.Second))
+	if !due.Equal(time.Date(2024, 3, 1, 16, 45, 0, 0, calendar.IST)) || len(exchanges) != 1 || exchanges[0] != smartapigo.CDS {
+		t.Errorf("Expected CDS to be next, got %v %v", due, exchanges)
+	}
+
+	cal := calendar.NewCalendar()
+	cal.AddHoliday(calendar.Holiday{Exchange: smartapigo.NSE, Date: now})
+	scheduler.SetCalendar(cal)
+	if exchanges := scheduler.tradingExchanges([]string{smartapigo.BSE, smartapigo.NSE}, now); len(exchanges) != 1 || exchanges[0] != smartapigo.BSE {
+		t.Errorf("Expected NSE to be skipped on its holiday, got %v", exchanges)
+	}
+}
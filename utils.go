@@ -32,6 +32,8 @@ const (
 	URILTP              string = "rest/secure/angelbroking/order/v1/getLtpData"
 	URIRMS              string = "rest/secure/angelbroking/user/v1/getRMS"
 	URIConvertPosition  string = "rest/secure/angelbroking/order/v1/convertPosition"
+	URICandleData       string = "rest/secure/angelbroking/historical/v1/getCandleData"
+	URIMargin           string = "rest/secure/angelbroking/margin/v1/batch"
 )
 
 func structToMap(obj interface{}, tagName string) map[string]interface{} {
@@ -63,6 +65,16 @@ func structToMap(obj interface{}, tagName string) map[string]interface{} {
 			con := obj.(SearchScripPayload)
 			values = reflect.ValueOf(&con).Elem()
 		}
+	case CandleParams:
+		{
+			con := obj.(CandleParams)
+			values = reflect.ValueOf(&con).Elem()
+		}
+	case MarginParams:
+		{
+			con := obj.(MarginParams)
+			values = reflect.ValueOf(&con).Elem()
+		}
 	default:
 		{
 			return nil
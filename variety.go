@@ -0,0 +1,134 @@
+package smartapigo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+var ErrOrderNotFound = fmt.Errorf("order not found")
+
+// NewRoboOrder returns params of a ROBO (bracket) order: a limit entry with a target
+// and a stop-loss placed once it fills. squareOff and stopLoss are price differences
+// from the entry price. Set TrailingStopLoss on the result to trail the stop-loss.
+func NewRoboOrder(exchange, tradingSymbol, symbolToken, transactionType string, quantity int, price, squareOff, stopLoss float64) OrderParams {
+	return OrderParams{
+		Variety:         VarietyRobo,
+		TradingSymbol:   tradingSymbol,
+		SymbolToken:     symbolToken,
+		TransactionType: transactionType,
+		Exchange:        exchange,
+		OrderType:       OrderTypeLimit,
+		ProductType:     ProductTypeBracket,
+		Duration:        DurationDay,
+		Price:           formatPrice(price),
+		TriggerPrice:    "0",
+		SquareOff:       formatPrice(squareOff),
+		StopLoss:        formatPrice(stopLoss),
+		Quantity:        strconv.Itoa(quantity),
+	}
+}
+
+// NewStopLossOrder returns params of a stop-loss order triggered at triggerPrice. It
+// is a STOPLOSS_LIMIT order at price, or a STOPLOSS_MARKET order if price is zero.
+func NewStopLossOrder(exchange, tradingSymbol, symbolToken, transactionType, productType string, quantity int, triggerPrice, price float64) OrderParams {
+	orderType := OrderTypeStopLossLimit
+	if price == 0 {
+		orderType = OrderTypeStopLossMarket
+	}
+	return OrderParams{
+		Variety:         VarietyStopLoss,
+		TradingSymbol:   tradingSymbol,
+		SymbolToken:     symbolToken,
+		TransactionType: transactionType,
+		Exchange:        exchange,
+		OrderType:       orderType,
+		ProductType:     productType,
+		Duration:        DurationDay,
+		Price:           formatPrice(price),
+		TriggerPrice:    formatPrice(triggerPrice),
+		SquareOff:       "0",
+		StopLoss:        "0",
+		Quantity:        strconv.Itoa(quantity),
+	}
+}
+
+// NewAMOOrder returns params of an after market order sent to the exchange when it
+// opens. It is a LIMIT order at price, or a MARKET order if price is zero.
+func NewAMOOrder(exchange, tradingSymbol, symbolToken, transactionType, productType string, quantity int, price float64) OrderParams {
+	orderType := OrderTypeLimit
+	if price == 0 {
+		orderType = OrderTypeMarket
+	}
+	return OrderParams{
+		Variety:         VarietyAMO,
+		TradingSymbol:   tradingSymbol,
+		SymbolToken:     symbolToken,
+		TransactionType: transactionType,
+		Exchange:        exchange,
+		OrderType:       orderType,
+		ProductType:     productType,
+		Duration:        DurationDay,
+		Price:           formatPrice(price),
+		TriggerPrice:    "0",
+		SquareOff:       "0",
+		StopLoss:        "0",
+		Quantity:        strconv.Itoa(quantity),
+	}
+}
+
+// BracketLegs returns the target and stop-loss legs of a bracket order.
+func (o Orders) BracketLegs(parentOrderID string) Orders {
+	var legs Orders
+	for _, order := range o {
+		if order.ParentOrderID == parentOrderID && order.OrderID != parentOrderID {
+			legs = append(legs, order)
+		}
+	}
+	return legs
+}
+
+// ExitBracketOrder exits a bracket order. An entry that is still open is cancelled,
+// otherwise its open legs are cancelled, which squares off the position at market.
+func ExitBracketOrder(orders OrderService, parentOrderID string) ([]OrderResponse, error) {
+	book, err := orders.GetOrderBook()
+	if err != nil {
+		return nil, err
+	}
+
+	legs := book.BracketLegs(parentOrderID)
+	for _, order := range book {
+		if order.OrderID == parentOrderID && order.IsOpen() {
+			legs = Orders{order}
+			break
+		}
+	}
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("%w: bracket order %s", ErrOrderNotFound, parentOrderID)
+	}
+
+	var responses []OrderResponse
+	for _, leg := range legs {
+		if !leg.IsOpen() {
+			continue
+		}
+		variety := leg.Variety
+		if variety == "" {
+			variety = VarietyRobo
+		}
+		response, err := orders.CancelOrder(variety, leg.OrderID)
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// ExitBracketOrder exits a bracket order, see the ExitBracketOrder function.
+func (c *Client) ExitBracketOrder(parentOrderID string) ([]OrderResponse, error) {
+	return ExitBracketOrder(c, parentOrderID)
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
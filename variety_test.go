@@ -0,0 +1,51 @@
+package smartapigo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderConstructors(t *testing.T) {
+	robo := NewRoboOrder(NSE, "SBIN-EQ", "3045", TransactionTypeBuy, 10, 590.5, 5, 2.5)
+	if robo.Variety != VarietyRobo || robo.ProductType != ProductTypeBracket || robo.Price != "590.5" || robo.StopLoss != "2.5" {
+		t.Errorf("Unexpected robo order %+v", robo)
+	}
+	stopLoss := NewStopLossOrder(NSE, "SBIN-EQ", "3045", TransactionTypeSell, ProductTypeIntraday, 10, 580, 0)
+	if stopLoss.Variety != VarietyStopLoss || stopLoss.OrderType != OrderTypeStopLossMarket || stopLoss.TriggerPrice != "580" {
+		t.Errorf("Unexpected stop-loss order %+v", stopLoss)
+	}
+	amo := NewAMOOrder(NSE, "SBIN-EQ", "3045", TransactionTypeBuy, ProductTypeDelivery, 10, 585)
+	if amo.Variety != VarietyAMO || amo.OrderType != OrderTypeLimit {
+		t.Errorf("Unexpected AMO order %+v", amo)
+	}
+	for _, params := range []OrderParams{robo, stopLoss, amo} {
+		if err := params.Validate(); err != nil {
+			t.Errorf("Expected %s order to be valid, got %v", params.Variety, err)
+		}
+	}
+}
+
+func TestExitBracketOrder(t *testing.T) {
+	broker := &basketBroker{orders: Orders{
+		{OrderID: "1", Variety: VarietyRobo, Status: "complete", ParentOrderID: "1"},
+		{OrderID: "2", Variety: VarietyRobo, Status: "open", ParentOrderID: "1"},
+		{OrderID: "3", Variety: VarietyRobo, Status: "trigger pending", ParentOrderID: "1"},
+		{OrderID: "4", Variety: VarietyRobo, Status: "open"},
+	}}
+
+	if legs := broker.orders.BracketLegs("1"); len(legs) != 2 {
+		t.Errorf("Expected the two legs, got %+v", legs)
+	}
+	responses, err := ExitBracketOrder(broker, "1")
+	if err != nil || len(responses) != 2 || broker.cancelled[0] != "2" || broker.cancelled[1] != "3" {
+		t.Errorf("Expected both legs to be cancelled, got %v. %v", broker.cancelled, err)
+	}
+
+	broker.cancelled = nil
+	if _, err := ExitBracketOrder(broker, "4"); err != nil || len(broker.cancelled) != 1 || broker.cancelled[0] != "4" {
+		t.Errorf("Expected the open entry to be cancelled, got %v. %v", broker.cancelled, err)
+	}
+	if _, err := ExitBracketOrder(broker, "5"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+}
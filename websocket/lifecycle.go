@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ConnectionState is the lifecycle state of a socket client.
+type ConnectionState int
+
+const (
+	StateIdle ConnectionState = iota
+	StateConnecting
+	StateConnected
+	StateReconnecting
+	// StateClosed is the final state after a shutdown requested by the caller.
+	StateClosed
+	// StateFailed is the final state after the connection could not be established
+	// or reconnect attempts were exhausted.
+	StateFailed
+)
+
+const (
+	// Time given to the server to acknowledge a close frame before the socket is dropped.
+	closeGracePeriod = 2 * time.Second
+)
+
+var (
+	ErrRetriesExhausted = fmt.Errorf("max reconnect attempts reached")
+)
+
+func (st ConnectionState) String() string {
+	switch st {
+	case StateIdle:
+		return "IDLE"
+	case StateConnecting:
+		return "CONNECTING"
+	case StateConnected:
+		return "CONNECTED"
+	case StateReconnecting:
+		return "RECONNECTING"
+	case StateClosed:
+		return "CLOSED"
+	case StateFailed:
+		return "FAILED"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int(st))
+}
+
+// authError is returned when the server rejects the credentials. It is never retried.
+type authError struct {
+	error
+}
+
+// handshakeError adds the HTTP status of a failed websocket handshake to err.
+func handshakeError(resp *http.Response, err error) error {
+	if resp == nil {
+		return err
+	}
+	err = fmt.Errorf("websocket handshake failed with status %d: %v", resp.StatusCode, err)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return authError{err}
+	}
+	return err
+}
+
+// Run connects, serves ticks and reconnects until ctx is cancelled or reconnect
+// attempts are exhausted. An error establishing the first connection, such as a
+// rejected feed token, is returned right away. On cancellation a close frame is
+// sent and Run returns nil once every callback has completed.
+func (s *SocketClient) Run(ctx context.Context) error {
+	return s.serve(ctx, true)
+}
+
+// State returns the current lifecycle state.
+func (s *SocketClient) State() ConnectionState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state
+}
+
+func (s *SocketClient) setState(state ConnectionState) {
+	s.mutex.Lock()
+	s.state = state
+	s.mutex.Unlock()
+}
+
+// Run connects, serves ticks and reconnects as per RetryParams until ctx is
+// cancelled, CloseConnection is called or retries are exhausted. An error dialing
+// the first connection, such as rejected credentials, is returned right away. On
+// cancellation a close frame is sent, and Run returns nil once the writer,
+// heartbeat and watchdog routines have stopped and every callback has completed.
+func (sw *SocketClientV2) Run(ctx context.Context) error {
+	if err := sw.connect(); err != nil {
+		sw.setState(StateFailed)
+		return err
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			sw.CloseConnection()
+		case <-stopped:
+		}
+	}()
+
+	sw.Serve()
+	close(stopped)
+	sw.routines.Wait()
+
+	if sw.State() == StateFailed {
+		return ErrRetriesExhausted
+	}
+	return nil
+}
+
+// State returns the current lifecycle state.
+func (sw *SocketClientV2) State() ConnectionState {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	return sw.state
+}
+
+func (sw *SocketClientV2) setState(state ConnectionState) {
+	sw.mutex.Lock()
+	sw.state = state
+	sw.mutex.Unlock()
+	sw.recordState()
+}
+
+// recordState records the current state to the metrics. It calls into the caller's
+// Metrics, so it must be called without the mutex held, after every state change.
+func (sw *SocketClientV2) recordState() {
+	sw.feed.state(sw.State)
+}
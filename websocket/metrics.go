@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo/metrics"
+)
+
+// Measurements of the SmartStream feed.
+const (
+	MetricConnectionState = "smartapi_ws_connection_state"
+	MetricReconnects      = "smartapi_ws_reconnects_total"
+	MetricTicks           = "smartapi_ws_ticks_total"
+	MetricTicksPerSecond  = "smartapi_ws_ticks_per_second"
+	MetricDecodeErrors    = "smartapi_ws_decode_errors_total"
+	MetricLastTickAge     = "smartapi_ws_last_tick_age_seconds"
+)
+
+var connectionStates = []ConnectionState{StateIdle, StateConnecting, StateConnected, StateReconnecting, StateClosed, StateFailed}
+
+// feedMetrics records the measurements of a socket client, if metrics are set.
+type feedMetrics struct {
+	metrics    metrics.Metrics
+	ticks      map[int]int
+	lastTick   time.Time
+	lastReport time.Time
+	mutex      sync.Mutex
+	// stateMutex serializes state records so the last one holds the current state.
+	stateMutex sync.Mutex
+}
+
+func newFeedMetrics() *feedMetrics {
+	return &feedMetrics{ticks: make(map[int]int)}
+}
+
+func (f *feedMetrics) set(m metrics.Metrics) {
+	if m != nil {
+		metrics.Describe(m, MetricConnectionState, "Connection state of the SmartStream client, 1 for the current state.")
+		metrics.Describe(m, MetricReconnects, "Reconnect attempts of the SmartStream client.")
+		metrics.Describe(m, MetricTicks, "Ticks received by subscription mode.")
+		metrics.Describe(m, MetricTicksPerSecond, "Ticks received per second by subscription mode, over the last watchdog interval.")
+		metrics.Describe(m, MetricDecodeErrors, "Binary packets of an unknown mode or invalid length.")
+		metrics.Describe(m, MetricLastTickAge, "Seconds since the last tick.")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.metrics = m
+	f.lastReport = time.Now()
+}
+
+func (f *feedMetrics) get() metrics.Metrics {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.metrics
+}
+
+// tick records a binary packet received.
+func (f *feedMetrics) tick(message []byte) {
+	f.mutex.Lock()
+	m := f.metrics
+	if m == nil {
+		f.mutex.Unlock()
+		return
+	}
+	mode := -1
+	if len(message) > 0 {
+		mode = int(message[0])
+	}
+	size, ok := PACKET_SIZE_MAP[mode]
+	valid := ok && len(message) >= size
+	if valid {
+		f.ticks[mode]++
+		f.lastTick = time.Now()
+	}
+	f.mutex.Unlock()
+
+	if !valid {
+		m.Add(MetricDecodeErrors, nil, 1)
+		return
+	}
+	m.Add(MetricTicks, metrics.Labels{"mode": SUBSCRIPTION_MODE_MAP[mode]}, 1)
+}
+
+// report records the tick rate since the last report and the age of the last tick.
+func (f *feedMetrics) report(now time.Time) {
+	f.mutex.Lock()
+	m := f.metrics
+	if m == nil {
+		f.mutex.Unlock()
+		return
+	}
+	elapsed := now.Sub(f.lastReport).Seconds()
+	rates := make(map[int]float64, len(SUBSCRIPTION_MODE_MAP))
+	for mode := range SUBSCRIPTION_MODE_MAP {
+		if elapsed > 0 {
+			rates[mode] = float64(f.ticks[mode]) / elapsed
+		}
+		f.ticks[mode] = 0
+	}
+	f.lastReport = now
+	lastTick := f.lastTick
+	f.mutex.Unlock()
+
+	for mode, rate := range rates {
+		m.Set(MetricTicksPerSecond, metrics.Labels{"mode": SUBSCRIPTION_MODE_MAP[mode]}, rate)
+	}
+	if !lastTick.IsZero() {
+		m.Set(MetricLastTickAge, nil, now.Sub(lastTick).Seconds())
+	}
+}
+
+// state records the connection state returned by current.
+func (f *feedMetrics) state(current func() ConnectionState) {
+	m := f.get()
+	if m == nil {
+		return
+	}
+	f.stateMutex.Lock()
+	defer f.stateMutex.Unlock()
+	state := current()
+	for _, s := range connectionStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.Set(MetricConnectionState, metrics.Labels{"state": s.String()}, value)
+	}
+}
+
+// reconnect records a reconnect attempt.
+func (f *feedMetrics) reconnect() {
+	if m := f.get(); m != nil {
+		m.Add(MetricReconnects, nil, 1)
+	}
+}
+
+// SetMetrics records the connection state, reconnect attempts, ticks and tick rate
+// by subscription mode, invalid packets and the age of the last tick to m. Rates and
+// ages are updated every watchdog interval while connected. A nil m stops recording.
+func (sw *SocketClientV2) SetMetrics(m metrics.Metrics) {
+	sw.feed.set(m)
+	sw.recordState()
+}
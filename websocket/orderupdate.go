@@ -0,0 +1,417 @@
+package websocket
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/piyushpatil22/smartapigo"
+)
+
+const (
+	ORDER_UPDATE_URI = "wss://tns.angelone.in/smart-order-update"
+
+	// Order status codes sent in the "order-status" field of an update.
+	ORDER_STATUS_CONNECTED       = "AB00"
+	ORDER_STATUS_OPEN            = "AB01"
+	ORDER_STATUS_CANCELLED       = "AB02"
+	ORDER_STATUS_REJECTED        = "AB03"
+	ORDER_STATUS_MODIFIED        = "AB04"
+	ORDER_STATUS_COMPLETE        = "AB05"
+	ORDER_STATUS_AMO_RECEIVED    = "AB06"
+	ORDER_STATUS_AMO_CANCELLED   = "AB07"
+	ORDER_STATUS_AMO_MODIFIED    = "AB08"
+	ORDER_STATUS_OPEN_PENDING    = "AB09"
+	ORDER_STATUS_TRIGGER_PENDING = "AB10"
+	ORDER_STATUS_MODIFY_PENDING  = "AB11"
+
+	// Buffer size of the channel returned by Updates.
+	orderUpdateChannelSize = 100
+)
+
+// OrderUpdate is a single order status event pushed by the order update websocket.
+type OrderUpdate struct {
+	UserID       string           `json:"user-id"`
+	StatusCode   string           `json:"status-code"`
+	OrderStatus  string           `json:"order-status"`
+	ErrorMessage string           `json:"error-message"`
+	Order        smartapigo.Order `json:"orderData"`
+}
+
+// OrderUpdateClient streams order status changes for the logged in user.
+type OrderUpdateClient struct {
+	authToken           string
+	url                 string
+	callbacks           orderUpdateCallbacks
+	autoReconnect       bool
+	reconnectMaxRetries int
+	reconnectMaxDelay   time.Duration
+	connectTimeout      time.Duration
+	reconnectAttempt    int
+	conn                *websocket.Conn
+	updates             chan OrderUpdate
+	updatesClosed       bool
+	serving             bool
+	lastPong            time.Time
+	closed              bool
+	stop                chan struct{}
+	mutex               sync.Mutex
+	writeMutex          sync.Mutex
+}
+
+// orderUpdateCallbacks represents callbacks available in the order update client.
+type orderUpdateCallbacks struct {
+	onOrderUpdate func(OrderUpdate)
+	onNoReconnect func(int)
+	onReconnect   func(int, time.Duration)
+	onConnect     func()
+	onClose       func(int, string)
+	onError       func(error)
+}
+
+// NewOrderUpdateClient creates a new order update client authenticated with the JWT
+// access token from UserSession.
+func NewOrderUpdateClient(authToken string) *OrderUpdateClient {
+	return &OrderUpdateClient{
+		authToken:           authToken,
+		url:                 ORDER_UPDATE_URI,
+		autoReconnect:       true,
+		reconnectMaxRetries: defaultReconnectMaxAttempts,
+		reconnectMaxDelay:   defaultReconnectMaxDelay,
+		connectTimeout:      defaultConnectTimeout,
+		stop:                make(chan struct{}),
+	}
+}
+
+// SetRootURL sets the order update websocket url.
+func (o *OrderUpdateClient) SetRootURL(u string) {
+	o.url = u
+}
+
+// SetAuthToken sets the JWT used to authenticate, e.g. after a session renewal.
+func (o *OrderUpdateClient) SetAuthToken(authToken string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.authToken = authToken
+}
+
+// SetConnectTimeout sets default timeout for initial connect handshake
+func (o *OrderUpdateClient) SetConnectTimeout(val time.Duration) {
+	o.connectTimeout = val
+}
+
+// SetAutoReconnect enable/disable auto reconnect.
+func (o *OrderUpdateClient) SetAutoReconnect(val bool) {
+	o.autoReconnect = val
+}
+
+// SetReconnectMaxDelay sets maximum auto reconnect delay.
+func (o *OrderUpdateClient) SetReconnectMaxDelay(val time.Duration) error {
+	if val < reconnectMinDelay {
+		return fmt.Errorf("ReconnectMaxDelay can't be less than %fms", reconnectMinDelay.Seconds()*1000)
+	}
+
+	o.reconnectMaxDelay = val
+	return nil
+}
+
+// SetReconnectMaxRetries sets maximum reconnect attempts.
+func (o *OrderUpdateClient) SetReconnectMaxRetries(val int) {
+	o.reconnectMaxRetries = val
+}
+
+// OnOrderUpdate callback.
+func (o *OrderUpdateClient) OnOrderUpdate(f func(update OrderUpdate)) {
+	o.callbacks.onOrderUpdate = f
+}
+
+// OnConnect callback.
+func (o *OrderUpdateClient) OnConnect(f func()) {
+	o.callbacks.onConnect = f
+}
+
+// OnError callback.
+func (o *OrderUpdateClient) OnError(f func(err error)) {
+	o.callbacks.onError = f
+}
+
+// OnClose callback.
+func (o *OrderUpdateClient) OnClose(f func(code int, reason string)) {
+	o.callbacks.onClose = f
+}
+
+// OnReconnect callback.
+func (o *OrderUpdateClient) OnReconnect(f func(attempt int, delay time.Duration)) {
+	o.callbacks.onReconnect = f
+}
+
+// OnNoReconnect callback.
+func (o *OrderUpdateClient) OnNoReconnect(f func(attempt int)) {
+	o.callbacks.onNoReconnect = f
+}
+
+// Updates returns a channel carrying every order update. Updates arriving while the
+// channel is full are dropped and reported to OnError, so the channel should be
+// drained. The channel is closed once Serve returns.
+func (o *OrderUpdateClient) Updates() <-chan OrderUpdate {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.updates == nil {
+		o.updates = make(chan OrderUpdate, orderUpdateChannelSize)
+		if o.updatesClosed {
+			close(o.updates)
+		}
+	}
+	return o.updates
+}
+
+// LastPong returns the time the last heartbeat response was received.
+func (o *OrderUpdateClient) LastPong() time.Time {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.lastPong
+}
+
+// Serve connects to the order update server and reads updates until Close is called
+// or reconnect attempts are exhausted. Since its blocking its recommended to use it in go routine.
+func (o *OrderUpdateClient) Serve() {
+	o.mutex.Lock()
+	o.serving = true
+	o.mutex.Unlock()
+	defer o.closeUpdates()
+
+	for {
+		if o.isClosed() {
+			return
+		}
+
+		// If reconnect attempt exceeds max then close the loop
+		if o.reconnectAttempt > o.reconnectMaxRetries {
+			o.triggerNoReconnect(o.reconnectAttempt)
+			return
+		}
+
+		// If its a reconnect then wait exponentially based on reconnect attempt
+		if o.reconnectAttempt > 0 {
+			nextDelay := time.Duration(math.Pow(2, float64(o.reconnectAttempt))) * time.Second
+			if nextDelay > o.reconnectMaxDelay {
+				nextDelay = o.reconnectMaxDelay
+			}
+
+			o.triggerReconnect(o.reconnectAttempt, nextDelay)
+
+			select {
+			case <-o.stop:
+				return
+			case <-time.After(nextDelay):
+			}
+		}
+
+		conn, err := o.dial()
+		if err != nil {
+			o.triggerError(err)
+			// If auto reconnect is enabled then try reconneting else return
+			if o.autoReconnect {
+				o.reconnectAttempt++
+				continue
+			}
+			return
+		}
+
+		// Close may have run during the dial and missed the connection.
+		o.mutex.Lock()
+		if o.closed {
+			o.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		o.conn = conn
+		o.lastPong = time.Now()
+		o.mutex.Unlock()
+
+		// Reset auto reconnect vars
+		o.reconnectAttempt = 0
+
+		conn.SetCloseHandler(o.handleClose)
+		o.triggerConnect()
+
+		done := make(chan struct{})
+		go o.runHeartbeat(conn, done)
+		o.readMessages(conn)
+		close(done)
+		conn.Close()
+
+		if o.isClosed() || !o.autoReconnect {
+			return
+		}
+		o.reconnectAttempt++
+	}
+}
+
+// Close tries to close the connection gracefully and stops Serve.
+func (o *OrderUpdateClient) Close() error {
+	o.mutex.Lock()
+	if o.closed {
+		o.mutex.Unlock()
+		return nil
+	}
+	o.closed = true
+	close(o.stop)
+	conn := o.conn
+	serving := o.serving
+	o.mutex.Unlock()
+
+	if !serving {
+		o.closeUpdates()
+	}
+	if conn == nil {
+		return nil
+	}
+	err := o.write(conn, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	conn.Close()
+	return err
+}
+
+func (o *OrderUpdateClient) dial() (*websocket.Conn, error) {
+	o.mutex.Lock()
+	headers := map[string][]string{
+		"Authorization": {"Bearer " + o.authToken},
+	}
+	o.mutex.Unlock()
+
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = o.connectTimeout
+	dialer.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	conn, _, err := dialer.Dial(o.url, headers)
+	return conn, err
+}
+
+// runHeartbeat pings the server until done is closed.
+func (o *OrderUpdateClient) runHeartbeat(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(HEART_BEAT_INTERVAL * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := o.write(conn, websocket.TextMessage, []byte(HEART_BEAT_MESSAGE)); err != nil {
+				o.triggerError(err)
+				return
+			}
+		}
+	}
+}
+
+// readMessages reads updates in a loop until the connection fails.
+func (o *OrderUpdateClient) readMessages(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if !o.isClosed() {
+				o.triggerError(fmt.Errorf("Error reading data: %v", err))
+			}
+			return
+		}
+
+		if string(message) == HEART_BEAT_RESPONSE {
+			o.mutex.Lock()
+			o.lastPong = time.Now()
+			o.mutex.Unlock()
+			continue
+		}
+
+		var update OrderUpdate
+		if err := json.Unmarshal(message, &update); err != nil {
+			o.triggerError(err)
+			continue
+		}
+		o.triggerOrderUpdate(update)
+	}
+}
+
+// write serializes writes to the connection since gorilla supports a single writer.
+func (o *OrderUpdateClient) write(conn *websocket.Conn, messageType int, data []byte) error {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	return conn.WriteMessage(messageType, data)
+}
+
+// closeUpdates closes the channel returned by Updates once no more updates are sent.
+func (o *OrderUpdateClient) closeUpdates() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.updatesClosed {
+		return
+	}
+	o.updatesClosed = true
+	if o.updates != nil {
+		close(o.updates)
+	}
+}
+
+func (o *OrderUpdateClient) isClosed() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.closed
+}
+
+func (o *OrderUpdateClient) handleClose(code int, reason string) error {
+	o.triggerClose(code, reason)
+	return nil
+}
+
+// Trigger callback methods
+func (o *OrderUpdateClient) triggerOrderUpdate(update OrderUpdate) {
+	if o.callbacks.onOrderUpdate != nil {
+		o.callbacks.onOrderUpdate(update)
+	}
+	o.mutex.Lock()
+	updates := o.updates
+	o.mutex.Unlock()
+	if updates == nil {
+		return
+	}
+	select {
+	case updates <- update:
+	default:
+		o.triggerError(fmt.Errorf("order update channel is full, dropped the update of order %s", update.Order.OrderID))
+	}
+}
+
+func (o *OrderUpdateClient) triggerError(err error) {
+	if o.callbacks.onError != nil {
+		o.callbacks.onError(err)
+	}
+}
+
+func (o *OrderUpdateClient) triggerClose(code int, reason string) {
+	if o.callbacks.onClose != nil {
+		o.callbacks.onClose(code, reason)
+	}
+}
+
+func (o *OrderUpdateClient) triggerConnect() {
+	if o.callbacks.onConnect != nil {
+		o.callbacks.onConnect()
+	}
+}
+
+func (o *OrderUpdateClient) triggerReconnect(attempt int, delay time.Duration) {
+	if o.callbacks.onReconnect != nil {
+		o.callbacks.onReconnect(attempt, delay)
+	}
+}
+
+func (o *OrderUpdateClient) triggerNoReconnect(attempt int) {
+	if o.callbacks.onNoReconnect != nil {
+		o.callbacks.onNoReconnect(attempt)
+	}
+}
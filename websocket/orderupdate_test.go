@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newOrderUpdateServer serves order updates, calling onConnect with each connection.
+// Requests wait for accept, if set, before the upgrade.
+func newOrderUpdateServer(t *testing.T, accept chan struct{}, onConnect func(conn *websocket.Conn, n int)) (*httptest.Server, func() int) {
+	var mutex sync.Mutex
+	var connections int
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if accept != nil {
+			<-accept
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Error upgrading connection. %v", err)
+			return
+		}
+		defer conn.Close()
+		mutex.Lock()
+		connections++
+		n := connections
+		mutex.Unlock()
+		onConnect(conn, n)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	return server, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return connections
+	}
+}
+
+func orderUpdateMessage(orderID, status string) []byte {
+	return []byte(`{"user-id":"A1","status-code":"200","order-status":"` + status + `","orderData":{"orderid":"` + orderID + `","status":"open"}}`)
+}
+
+func newTestOrderUpdateClient(server *httptest.Server) *OrderUpdateClient {
+	client := NewOrderUpdateClient("token")
+	client.SetRootURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	client.reconnectMaxDelay = 10 * time.Millisecond
+	return client
+}
+
+func TestOrderUpdateClientReconnect(t *testing.T) {
+	server, connections := newOrderUpdateServer(t, nil, func(conn *websocket.Conn, n int) {
+		conn.WriteMessage(websocket.TextMessage, orderUpdateMessage(string(rune('0'+n)), ORDER_STATUS_OPEN))
+		if n == 1 {
+			// Drop the first connection to force a reconnect.
+			conn.Close()
+		}
+	})
+	defer server.Close()
+
+	client := newTestOrderUpdateClient(server)
+	var mutex sync.Mutex
+	var reconnects int
+	client.OnReconnect(func(attempt int, delay time.Duration) {
+		mutex.Lock()
+		reconnects++
+		mutex.Unlock()
+	})
+	updates := client.Updates()
+	done := make(chan struct{})
+	go func() {
+		client.Serve()
+		close(done)
+	}()
+
+	for _, orderID := range []string{"1", "2"} {
+		select {
+		case update := <-updates:
+			if update.Order.OrderID != orderID || update.OrderStatus != ORDER_STATUS_OPEN {
+				t.Errorf("Expected an open update of order %s, got %+v", orderID, update)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the update of order %s", orderID)
+		}
+	}
+	mutex.Lock()
+	if reconnects != 1 || connections() != 2 {
+		t.Errorf("Expected one reconnect, got %d and %d connections", reconnects, connections())
+	}
+	mutex.Unlock()
+
+	client.Close()
+	<-done
+	if _, ok := <-updates; ok {
+		t.Errorf("Expected the updates channel to be closed")
+	}
+}
+
+func TestOrderUpdateClientSlowConsumer(t *testing.T) {
+	server, _ := newOrderUpdateServer(t, nil, func(conn *websocket.Conn, n int) {
+		for i := 0; i <= orderUpdateChannelSize; i++ {
+			conn.WriteMessage(websocket.TextMessage, orderUpdateMessage("1", ORDER_STATUS_OPEN))
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(HEART_BEAT_RESPONSE))
+	})
+	defer server.Close()
+
+	client := newTestOrderUpdateClient(server)
+	var mutex sync.Mutex
+	var dropped int
+	client.OnError(func(err error) {
+		mutex.Lock()
+		if strings.Contains(err.Error(), "dropped") {
+			dropped++
+		}
+		mutex.Unlock()
+	})
+	updates := client.Updates()
+	go client.Serve()
+	defer client.Close()
+
+	// The pong after the updates is read although nothing drains the channel.
+	start := time.Now()
+	waitFor(t, "the pong", func() bool { return client.LastPong().After(start) })
+	mutex.Lock()
+	if dropped != 1 || len(updates) != orderUpdateChannelSize {
+		t.Errorf("Expected one dropped update, got %d with %d buffered", dropped, len(updates))
+	}
+	mutex.Unlock()
+}
+
+func TestOrderUpdateClientCloseDuringDial(t *testing.T) {
+	accept := make(chan struct{})
+	closed := make(chan struct{})
+	server, connections := newOrderUpdateServer(t, accept, func(conn *websocket.Conn, n int) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadMessage(); err == nil {
+			t.Errorf("Expected the connection to be closed")
+		}
+		close(closed)
+	})
+	defer server.Close()
+
+	client := newTestOrderUpdateClient(server)
+	updates := client.Updates()
+	done := make(chan struct{})
+	go func() {
+		client.Serve()
+		close(done)
+	}()
+
+	// Close while the server holds the handshake.
+	time.Sleep(20 * time.Millisecond)
+	client.Close()
+	close(accept)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Serve to return")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the connection dialled during Close to be closed")
+	}
+	if _, ok := <-updates; ok || connections() != 1 {
+		t.Errorf("Expected the updates channel to be closed after %d connections", connections())
+	}
+}
@@ -0,0 +1,452 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Default number of SmartStream connections a pool may open for one session.
+	DEFAULT_POOL_SIZE = 3
+)
+
+var (
+	ErrPoolClosed = fmt.Errorf("socket pool is closed")
+)
+
+// SocketPool shards subscriptions across several SocketClientV2 connections opened
+// under the same session and merges their ticks into a single stream.
+type SocketPool struct {
+	authToken   string
+	apiKey      string
+	clientCode  string
+	feedToken   string
+	url         string
+	retryParams RetryParams
+	maxConns    int
+	quota       int
+	callbacks   callbacksV2
+	logger      *logrus.Logger
+	conns       []*poolConn
+	assigned    map[subscriptionKey]*poolConn
+	pending     map[subscriptionKey]bool
+	ticks       chan []byte
+	closed      bool
+	mutex       sync.Mutex
+	// placeMutex serializes placing tokens, which may dial, without holding mutex.
+	placeMutex sync.Mutex
+}
+
+// poolConn is a single connection of the pool along with the keys it serves.
+type poolConn struct {
+	client *SocketClientV2
+	keys   map[subscriptionKey]bool
+	lost   bool
+}
+
+// subscriptionKey identifies one token subscribed in one mode.
+type subscriptionKey struct {
+	Mode         int
+	ExchangeType int
+	Token        string
+}
+
+// NewSocketPool creates a pool that opens at most maxConns SmartStream connections.
+// Each connection carries at most QUOTA_LIMIT tokens.
+func NewSocketPool(auth_token, client_code, api_key, feed_token string, maxConns int, retryParam RetryParams) *SocketPool {
+	if maxConns <= 0 {
+		maxConns = DEFAULT_POOL_SIZE
+	}
+	p := &SocketPool{
+		authToken:   auth_token,
+		clientCode:  client_code,
+		apiKey:      api_key,
+		feedToken:   feed_token,
+		url:         ROOT_URI,
+		retryParams: retryParam,
+		maxConns:    maxConns,
+		quota:       QUOTA_LIMIT,
+		logger:      logrus.New(),
+		assigned:    make(map[subscriptionKey]*poolConn),
+		pending:     make(map[subscriptionKey]bool),
+	}
+	p.logger.SetLevel(logrus.InfoLevel)
+	p.logger.SetFormatter(&smartapigo.CustomFormatter{})
+	return p
+}
+
+// SetRootURL overrides the SmartStream url used by connections opened afterwards.
+func (p *SocketPool) SetRootURL(u string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.url = u
+}
+
+// SetQuota overrides the number of tokens placed on each connection.
+func (p *SocketPool) SetQuota(quota int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if quota > 0 {
+		p.quota = quota
+	}
+}
+
+// OnMessage callback. It receives ticks from every connection of the pool.
+func (p *SocketPool) OnMessage(f func(message []byte)) {
+	p.callbacks.onMessage = f
+}
+
+// OnError callback.
+func (p *SocketPool) OnError(f func(err error)) {
+	p.callbacks.onError = f
+}
+
+// OnConnect callback. It fires each time one of the pool connections connects.
+func (p *SocketPool) OnConnect(f func()) {
+	p.callbacks.onConnect = f
+}
+
+// OnClose callback. It fires each time one of the pool connections closes.
+func (p *SocketPool) OnClose(f func(code int, reason string)) {
+	p.callbacks.onClose = f
+}
+
+// Ticks returns a channel carrying the merged tick stream of all connections. Ticks
+// arriving while the channel is full are dropped and reported to OnError, so the
+// channel should be drained. The channel is closed by Close.
+func (p *SocketPool) Ticks() <-chan []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.ticks == nil {
+		p.ticks = make(chan []byte, 1024)
+		if p.closed {
+			close(p.ticks)
+		}
+	}
+	return p.ticks
+}
+
+// Connections returns the number of live connections in the pool.
+func (p *SocketPool) Connections() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.conns)
+}
+
+// Subscribe subscribes the given tokens, placing them on connections that still
+// have quota left and opening new connections as needed. If a connection fails to
+// open, the tokens placed before it stay subscribed and the error is returned.
+func (p *SocketPool) Subscribe(correlationID string, mode int, tokenList []TokenSet) error {
+	p.placeMutex.Lock()
+	defer p.placeMutex.Unlock()
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return ErrPoolClosed
+	}
+
+	var keys []subscriptionKey
+	for _, set := range tokenList {
+		for _, token := range set.Tokens {
+			key := subscriptionKey{Mode: mode, ExchangeType: set.ExchangeType, Token: token}
+			if _, ok := p.assigned[key]; ok || p.pending[key] {
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) > p.capacity() {
+		p.mutex.Unlock()
+		return ErrQuotaLimitExceeded
+	}
+	p.mutex.Unlock()
+
+	_, err := p.place(correlationID, keys)
+	return err
+}
+
+// Unsubscribe removes the given tokens from whichever connection serves them.
+func (p *SocketPool) Unsubscribe(correlationID string, mode int, tokenList []TokenSet) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	byConn := make(map[*poolConn][]subscriptionKey)
+	for _, set := range tokenList {
+		for _, token := range set.Tokens {
+			key := subscriptionKey{Mode: mode, ExchangeType: set.ExchangeType, Token: token}
+			delete(p.pending, key)
+			conn, ok := p.assigned[key]
+			if !ok {
+				continue
+			}
+			delete(p.assigned, key)
+			delete(conn.keys, key)
+			byConn[conn] = append(byConn[conn], key)
+		}
+	}
+
+	var err error
+	for conn, keys := range byConn {
+		for _, req := range groupKeys(keys) {
+			if uerr := conn.client.Unsubscribe(correlationID, req.mode, req.tokens); uerr != nil && err == nil {
+				err = uerr
+			}
+		}
+	}
+	return err
+}
+
+// Close closes every connection of the pool and the channel returned by Ticks.
+func (p *SocketPool) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	conns := p.conns
+	for _, conn := range conns {
+		conn.lost = true
+	}
+	p.conns = nil
+	p.assigned = make(map[subscriptionKey]*poolConn)
+	p.pending = make(map[subscriptionKey]bool)
+	if p.ticks != nil {
+		close(p.ticks)
+	}
+	p.mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.client.CloseConnection()
+	}
+}
+
+// capacity returns how many more tokens the pool can carry. Must be called with the mutex held.
+func (p *SocketPool) capacity() int {
+	free := (p.maxConns - len(p.conns)) * p.quota
+	for _, conn := range p.conns {
+		free += p.quota - len(conn.keys)
+	}
+	return free - len(p.pending)
+}
+
+// place assigns keys to connections, least loaded first, opening connections when
+// the existing ones are full. It returns the keys left unplaced once the pool is full
+// or a connection fails to open. Must be called with placeMutex held.
+func (p *SocketPool) place(correlationID string, keys []subscriptionKey) ([]subscriptionKey, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return keys, ErrPoolClosed
+		}
+		byConn := make(map[*poolConn][]subscriptionKey)
+		var unplaced []subscriptionKey
+		for _, key := range keys {
+			conn := p.leastLoaded()
+			if conn == nil {
+				unplaced = append(unplaced, key)
+				continue
+			}
+			delete(p.pending, key)
+			conn.keys[key] = true
+			p.assigned[key] = conn
+			byConn[conn] = append(byConn[conn], key)
+		}
+		full := len(p.conns) >= p.maxConns
+		p.mutex.Unlock()
+
+		for conn, keys := range byConn {
+			for _, req := range groupKeys(keys) {
+				if err := conn.client.Subscribe(correlationID, req.mode, req.tokens); err != nil {
+					p.triggerError(err)
+				}
+			}
+		}
+		if len(unplaced) == 0 || full {
+			return unplaced, nil
+		}
+		if err := p.open(); err != nil {
+			return unplaced, err
+		}
+		keys = unplaced
+	}
+}
+
+// leastLoaded returns the connection with the most free quota, nil if all
+// connections are full. Must be called with the mutex held.
+func (p *SocketPool) leastLoaded() *poolConn {
+	var best *poolConn
+	for _, conn := range p.conns {
+		if len(conn.keys) >= p.quota {
+			continue
+		}
+		if best == nil || len(conn.keys) < len(best.keys) {
+			best = conn
+		}
+	}
+	return best
+}
+
+// open dials a new connection and adds it to the pool once connected. Must be called
+// with placeMutex held.
+func (p *SocketPool) open() error {
+	p.mutex.Lock()
+	url := p.url
+	p.mutex.Unlock()
+
+	conn := &poolConn{
+		client: NewSocketConnV2(p.authToken, p.clientCode, p.apiKey, p.feedToken, p.retryParams),
+		keys:   make(map[subscriptionKey]bool),
+	}
+	conn.client.SetRootURL(url)
+	conn.client.OnMessage(p.triggerMessage)
+	conn.client.OnError(p.triggerError)
+	conn.client.OnConnect(p.triggerConnect)
+	conn.client.OnClose(p.triggerClose)
+	// Each connection reconnects and resubscribes on its own, tokens only move
+	// once it gives up.
+	conn.client.OnNoReconnect(func(attempt int) {
+		go p.handleLost(conn)
+	})
+
+	if err := conn.client.Connect(); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		conn.client.CloseConnection()
+		return ErrPoolClosed
+	}
+	p.conns = append(p.conns, conn)
+	p.mutex.Unlock()
+
+	go conn.client.Serve()
+	return nil
+}
+
+// handleLost drops a disconnected connection and moves its tokens to the rest of the pool.
+func (p *SocketPool) handleLost(lost *poolConn) {
+	p.placeMutex.Lock()
+	defer p.placeMutex.Unlock()
+	p.mutex.Lock()
+	if p.closed || lost.lost {
+		p.mutex.Unlock()
+		return
+	}
+	lost.lost = true
+
+	for i, conn := range p.conns {
+		if conn == lost {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+
+	var keys []subscriptionKey
+	for key := range lost.keys {
+		delete(p.assigned, key)
+		keys = append(keys, key)
+	}
+	for key := range p.pending {
+		keys = append(keys, key)
+	}
+	p.mutex.Unlock()
+	lost.client.CloseConnection()
+
+	p.logger.Warnf("Connection lost, rebalancing %d tokens", len(keys))
+	unplaced, err := p.place(fmt.Sprintf("rebalance-%d", time.Now().UnixNano()), keys)
+	if err != nil && err != ErrPoolClosed {
+		p.triggerError(err)
+	}
+	// Tokens that did not fit are placed by the next rebalance.
+	p.mutex.Lock()
+	if !p.closed {
+		for _, key := range unplaced {
+			p.pending[key] = true
+		}
+	}
+	p.mutex.Unlock()
+}
+
+func (p *SocketPool) triggerMessage(message []byte) {
+	if p.callbacks.onMessage != nil {
+		p.callbacks.onMessage(message)
+	}
+	// Sending under the mutex keeps Close from closing the channel meanwhile.
+	p.mutex.Lock()
+	dropped := false
+	if p.ticks != nil && !p.closed {
+		select {
+		case p.ticks <- message:
+		default:
+			dropped = true
+		}
+	}
+	p.mutex.Unlock()
+	if dropped {
+		p.triggerError(fmt.Errorf("tick channel is full, dropped a tick"))
+	}
+}
+
+func (p *SocketPool) triggerError(err error) {
+	if p.callbacks.onError != nil {
+		p.callbacks.onError(err)
+	}
+}
+
+func (p *SocketPool) triggerConnect() {
+	if p.callbacks.onConnect != nil {
+		p.callbacks.onConnect()
+	}
+}
+
+func (p *SocketPool) triggerClose(code int, reason string) {
+	if p.callbacks.onClose != nil {
+		p.callbacks.onClose(code, reason)
+	}
+}
+
+// subscriptionRequest is one subscribe or unsubscribe call for a single mode.
+type subscriptionRequest struct {
+	mode   int
+	tokens []TokenSet
+}
+
+// groupKeys folds keys into one request per mode with tokens grouped by exchange type.
+func groupKeys(keys []subscriptionKey) []subscriptionRequest {
+	var (
+		modes    []int
+		byMode   = make(map[int][]int)
+		byTokens = make(map[int]map[int][]string)
+	)
+	for _, key := range keys {
+		if _, ok := byTokens[key.Mode]; !ok {
+			byTokens[key.Mode] = make(map[int][]string)
+			modes = append(modes, key.Mode)
+		}
+		if _, ok := byTokens[key.Mode][key.ExchangeType]; !ok {
+			byMode[key.Mode] = append(byMode[key.Mode], key.ExchangeType)
+		}
+		byTokens[key.Mode][key.ExchangeType] = append(byTokens[key.Mode][key.ExchangeType], key.Token)
+	}
+
+	requests := make([]subscriptionRequest, 0, len(modes))
+	for _, mode := range modes {
+		req := subscriptionRequest{mode: mode}
+		for _, exchangeType := range byMode[mode] {
+			req.tokens = append(req.tokens, TokenSet{ExchangeType: exchangeType, Tokens: byTokens[mode][exchangeType]})
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestPool(ts *testServer, maxConns int) *SocketPool {
+	pool := NewSocketPool("auth", "client", "key", "feed", maxConns, RetryParams{MaxRetryAttempt: 1})
+	pool.SetRootURL("ws" + strings.TrimPrefix(ts.URL, "http"))
+	pool.SetQuota(2)
+	return pool
+}
+
+func TestSocketPoolPlacement(t *testing.T) {
+	ts := newTestServer(t, nil)
+	defer ts.Close()
+
+	pool := newTestPool(ts, 3)
+	defer pool.Close()
+	tokens := []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"1", "2", "3", "4", "5"}}}
+	if err := pool.Subscribe("abc", LTP_MODE, tokens); err != nil {
+		t.Fatalf("Error subscribing. %v", err)
+	}
+	if pool.Connections() != 3 {
+		t.Errorf("Expected 3 connections, got %d", pool.Connections())
+	}
+	waitFor(t, "the subscriptions", func() bool { return ts.requestCount() == 3 })
+
+	ts.mutex.Lock()
+	subscribed := make(map[string]bool)
+	for _, request := range ts.requests {
+		if len(request.Params.TokenList) != 1 || len(request.Params.TokenList[0].Tokens) > 2 {
+			t.Errorf("Expected at most 2 tokens per connection, got %+v", request.Params.TokenList)
+		}
+		for _, set := range request.Params.TokenList {
+			for _, token := range set.Tokens {
+				subscribed[token] = true
+			}
+		}
+	}
+	ts.mutex.Unlock()
+	if len(subscribed) != 5 {
+		t.Errorf("Expected every token to be subscribed once, got %v", subscribed)
+	}
+
+	more := []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"6", "7"}}}
+	if err := pool.Subscribe("abc", LTP_MODE, more); err != ErrQuotaLimitExceeded {
+		t.Errorf("Expected the quota to be exceeded, got %v", err)
+	}
+}
+
+func TestSocketPoolFailedDial(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.maxConnections = 1
+	defer ts.Close()
+
+	pool := newTestPool(ts, 3)
+	defer pool.Close()
+	tokens := []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"1", "2", "3"}}}
+	if err := pool.Subscribe("abc", LTP_MODE, tokens); err == nil {
+		t.Fatalf("Expected the second connection to fail")
+	}
+	if pool.Connections() != 1 {
+		t.Errorf("Expected the failed connection not to join the pool, got %d", pool.Connections())
+	}
+
+	// The token left over is not assigned and can be subscribed again.
+	ts.mutex.Lock()
+	ts.maxConnections = 0
+	ts.mutex.Unlock()
+	if err := pool.Subscribe("abc", LTP_MODE, tokens); err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+	if pool.Connections() != 2 {
+		t.Errorf("Expected 2 connections, got %d", pool.Connections())
+	}
+}
+
+func TestSocketPoolClose(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := write(websocket.BinaryMessage, ltpPacket(NSE_CM, "1", 59000)); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+
+	pool := newTestPool(ts, 2)
+	ticks := pool.Ticks()
+	if err := pool.Subscribe("abc", LTP_MODE, []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"1", "2", "3"}}}); err != nil {
+		t.Fatalf("Error subscribing. %v", err)
+	}
+	select {
+	case <-ticks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a tick")
+	}
+
+	pool.Close()
+	deadline := time.After(5 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-ticks:
+		case <-deadline:
+			t.Fatal("Expected the ticks channel to be closed")
+		}
+	}
+	if pool.Connections() != 0 {
+		t.Errorf("Expected no connections, got %d", pool.Connections())
+	}
+	if err := pool.Subscribe("abc", LTP_MODE, []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"4"}}}); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+// Package recorder writes the frames received by SocketClientV2 to append-only files
+// with their receive timestamps, and replays them through the same OnMessage API so a
+// session can be reproduced deterministically.
+//
+// A recording starts with a 6 byte header, "SSREC" followed by the format version,
+// and holds one record per frame: the receive time in Unix nanoseconds as a little
+// endian int64, the frame length as a little endian uint32 and the frame itself.
+// Recordings may be gzip compressed.
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo/calendar"
+)
+
+const (
+	FORMAT_VERSION = 1
+
+	// File extensions of recordings.
+	EXTENSION            = ".ssr"
+	COMPRESSED_EXTENSION = ".ssr.gz"
+
+	headerMagic  = "SSREC"
+	headerSize   = len(headerMagic) + 1
+	recordHeader = 12
+
+	// Largest frame accepted when reading, larger lengths mean a corrupt file.
+	maxFrameSize = 1 << 20
+
+	fileTimeFormat = "20060102T150405.000000"
+)
+
+var (
+	ErrInvalidRecording = fmt.Errorf("invalid recording: bad header or corrupt record")
+	ErrRecorderClosed   = fmt.Errorf("recorder is closed")
+)
+
+// Recorder appends frames to recording files in a directory. Writes are buffered,
+// call Flush to make recorded frames durable.
+type Recorder struct {
+	dir          string
+	prefix       string
+	maxSize      int64
+	rotateDaily  bool
+	compress     bool
+	clock        func() time.Time
+	onError      func(err error)
+	file         *os.File
+	writer       *bufio.Writer
+	path         string
+	size         int64
+	day          string
+	closed       bool
+	compressions sync.WaitGroup
+	mutex        sync.Mutex
+}
+
+// NewRecorder creates a recorder writing files named <prefix>-<IST timestamp>.ssr in dir.
+// The first file is created on the first recorded frame.
+func NewRecorder(dir, prefix string) *Recorder {
+	return &Recorder{
+		dir:    dir,
+		prefix: prefix,
+		clock:  time.Now,
+	}
+}
+
+// SetMaxSize starts a new file once the current one reaches size bytes. Zero, the
+// default, disables size based rotation.
+func (r *Recorder) SetMaxSize(size int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxSize = size
+}
+
+// SetRotateDaily starts a new file on the first frame of every IST day.
+func (r *Recorder) SetRotateDaily(rotate bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rotateDaily = rotate
+}
+
+// SetCompress gzips every file once it is rotated or the recorder is closed.
+func (r *Recorder) SetCompress(compress bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.compress = compress
+}
+
+// SetClock sets the clock used to timestamp frames passed to OnMessage.
+func (r *Recorder) SetClock(clock func() time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clock = clock
+}
+
+// OnError callback, called when OnMessage or a background compression fails.
+func (r *Recorder) OnError(f func(err error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onError = f
+}
+
+// OnMessage records a frame with the current time. It can be registered directly
+// with SocketClientV2.OnMessage, errors are reported through OnError.
+func (r *Recorder) OnMessage(message []byte) {
+	r.mutex.Lock()
+	at := r.clock()
+	r.mutex.Unlock()
+	if err := r.Record(message, at); err != nil {
+		r.triggerError(err)
+	}
+}
+
+// Record appends a frame received at the given time.
+func (r *Recorder) Record(message []byte, at time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrRecorderClosed
+	}
+
+	day := at.In(calendar.IST).Format("2006-01-02")
+	rotate := r.file == nil ||
+		(r.maxSize > 0 && r.size >= r.maxSize) ||
+		(r.rotateDaily && day != r.day)
+	if rotate {
+		if err := r.rotate(at); err != nil {
+			return err
+		}
+		r.day = day
+	}
+
+	var header [recordHeader]byte
+	binary.LittleEndian.PutUint64(header[:8], uint64(at.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(message)))
+	if _, err := r.writer.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := r.writer.Write(message); err != nil {
+		return err
+	}
+	r.size += int64(recordHeader + len(message))
+	return nil
+}
+
+// Flush writes buffered frames to the current file.
+func (r *Recorder) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.writer == nil {
+		return nil
+	}
+	return r.writer.Flush()
+}
+
+// Close flushes and closes the current file and waits for pending compressions.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	r.closed = true
+	err := r.closeFile()
+	r.mutex.Unlock()
+
+	r.compressions.Wait()
+	return err
+}
+
+// rotate closes the current file and creates the next one. Must be called with the mutex held.
+func (r *Recorder) rotate(at time.Time) error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+
+	// Names sort in recording order, so a taken name is bumped to the next microsecond.
+	var path string
+	for {
+		name := fmt.Sprintf("%s-%s%s", r.prefix, at.In(calendar.IST).Format(fileTimeFormat), EXTENSION)
+		path = filepath.Join(r.dir, name)
+		if !fileExists(path) && !fileExists(path+".gz") {
+			break
+		}
+		at = at.Add(time.Microsecond)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.writer = bufio.NewWriter(file)
+	r.path = path
+	r.size = int64(headerSize)
+	_, err = r.writer.Write(append([]byte(headerMagic), FORMAT_VERSION))
+	return err
+}
+
+// closeFile flushes and closes the current file and starts its compression. Must be
+// called with the mutex held.
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.writer.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	path := r.path
+	r.file, r.writer, r.path = nil, nil, ""
+	if err != nil {
+		return err
+	}
+
+	if r.compress {
+		r.compressions.Add(1)
+		go func() {
+			defer r.compressions.Done()
+			if err := compressFile(path); err != nil {
+				r.triggerError(err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (r *Recorder) triggerError(err error) {
+	r.mutex.Lock()
+	onError := r.onError
+	r.mutex.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// compressFile replaces path with a gzip compressed copy.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,145 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("Error creating temp dir. %v", err)
+	}
+	return dir
+}
+
+func record(t *testing.T, r *Recorder, start time.Time, count int) {
+	for i := 0; i < count; i++ {
+		if err := r.Record([]byte(fmt.Sprintf("frame-%03d", i)), start.Add(time.Duration(i)*10*time.Millisecond)); err != nil {
+			t.Fatalf("Error recording frame. %v", err)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	r := NewRecorder(dir, "ticks")
+	r.SetMaxSize(200)
+	r.SetCompress(true)
+	start := time.Date(2023, 9, 6, 9, 15, 0, 0, time.UTC)
+	record(t, r, start, 50)
+	if err := r.Close(); err != nil {
+		t.Fatalf("Error closing recorder. %v", err)
+	}
+	if err := r.Record([]byte("late"), start); err != ErrRecorderClosed {
+		t.Errorf("Expected ErrRecorderClosed, got %v", err)
+	}
+
+	paths, err := Files(dir, "ticks")
+	if err != nil {
+		t.Fatalf("Error listing recordings. %v", err)
+	}
+	if len(paths) < 2 {
+		t.Fatalf("Expected the recording to be rotated, got %v", paths)
+	}
+	for _, path := range paths {
+		if !strings.HasSuffix(path, COMPRESSED_EXTENSION) {
+			t.Errorf("Expected %s to be compressed", path)
+		}
+	}
+
+	var frames []string
+	replayer := NewReplayer(paths...)
+	replayer.SetSpeed(MAX_SPEED)
+	replayer.OnMessage(func(message []byte) {
+		frames = append(frames, string(message))
+	})
+	if err := replayer.Run(context.Background()); err != nil {
+		t.Fatalf("Error replaying. %v", err)
+	}
+	if len(frames) != 50 {
+		t.Fatalf("Expected 50 frames, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		if frame != fmt.Sprintf("frame-%03d", i) {
+			t.Fatalf("Expected frames in recorded order, got %v", frames)
+		}
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	r := NewRecorder(dir, "ticks")
+	// Ten frames 10ms apart take 90ms to replay in real time.
+	record(t, r, time.Now(), 10)
+	r.Close()
+	paths, _ := Files(dir, "ticks")
+
+	replayer := NewReplayer(paths...)
+	count := 0
+	replayer.OnMessage(func(message []byte) { count++ })
+	started := time.Now()
+	if err := replayer.Run(context.Background()); err != nil {
+		t.Fatalf("Error replaying. %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond || count != 10 {
+		t.Errorf("Expected 10 frames over 90ms, got %d over %v", count, elapsed)
+	}
+
+	replayer.SetSpeed(10)
+	started = time.Now()
+	replayer.Run(context.Background())
+	if elapsed := time.Since(started); elapsed > 80*time.Millisecond {
+		t.Errorf("Expected an accelerated replay, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	replayer.SetSpeed(REAL_TIME)
+	if err := replayer.Run(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestTruncatedRecording(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	r := NewRecorder(dir, "ticks")
+	record(t, r, time.Now(), 3)
+	r.Close()
+	paths, _ := Files(dir, "ticks")
+
+	info, _ := os.Stat(paths[0])
+	if err := os.Truncate(paths[0], info.Size()-4); err != nil {
+		t.Fatalf("Error truncating. %v", err)
+	}
+	reader, err := OpenFile(paths[0])
+	if err != nil {
+		t.Fatalf("Error opening recording. %v", err)
+	}
+	defer reader.Close()
+	count := 0
+	for {
+		if _, err := reader.Next(); err != nil {
+			break
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Expected the two complete frames, got %d", count)
+	}
+
+	if _, err := NewReader(strings.NewReader("not a recording")); err != ErrInvalidRecording {
+		t.Errorf("Expected ErrInvalidRecording, got %v", err)
+	}
+}
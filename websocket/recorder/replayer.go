@@ -0,0 +1,202 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MAX_SPEED replays frames back to back without waiting.
+	MAX_SPEED = 0
+	// REAL_TIME replays frames with the delays they were received with.
+	REAL_TIME = 1
+)
+
+// Frame is a recorded frame along with the time it was received.
+type Frame struct {
+	Time time.Time
+	Data []byte
+}
+
+// Reader reads the frames of a recording.
+type Reader struct {
+	reader  *bufio.Reader
+	closers []io.Closer
+}
+
+// NewReader reads a recording, compressed or not, from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{reader: bufio.NewReader(r)}
+	if magic, err := reader.reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader.reader)
+		if err != nil {
+			return nil, err
+		}
+		reader.reader = bufio.NewReader(gz)
+		reader.closers = append(reader.closers, gz)
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader.reader, header); err != nil {
+		return nil, ErrInvalidRecording
+	}
+	if !bytes.Equal(header[:len(headerMagic)], []byte(headerMagic)) || header[len(headerMagic)] != FORMAT_VERSION {
+		return nil, ErrInvalidRecording
+	}
+	return reader, nil
+}
+
+// OpenFile opens a recording file.
+func OpenFile(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closers = append(reader.closers, file)
+	return reader, nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the recording. A record cut
+// short, as left behind by a crash while recording, is treated as the end.
+func (r *Reader) Next() (Frame, error) {
+	var header [recordHeader]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Frame{}, err
+	}
+	length := binary.LittleEndian.Uint32(header[8:])
+	if length > maxFrameSize {
+		return Frame{}, ErrInvalidRecording
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Frame{}, err
+	}
+	return Frame{Time: time.Unix(0, int64(binary.LittleEndian.Uint64(header[:8]))), Data: data}, nil
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Files lists the recordings with the given prefix in dir in the order they were recorded.
+func Files(dir, prefix string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, prefix+"-") && (strings.HasSuffix(name, EXTENSION) || strings.HasSuffix(name, COMPRESSED_EXTENSION)) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Replayer feeds recorded frames to an OnMessage callback, in recorded order.
+type Replayer struct {
+	paths     []string
+	speed     float64
+	onMessage func(message []byte)
+}
+
+// NewReplayer creates a replayer of the given recordings, replayed in the order given.
+func NewReplayer(paths ...string) *Replayer {
+	return &Replayer{
+		paths: paths,
+		speed: REAL_TIME,
+	}
+}
+
+// SetSpeed sets the replay speed as a multiple of real time, for example 10 replays
+// ten times faster than recorded. MAX_SPEED replays without waiting.
+func (r *Replayer) SetSpeed(speed float64) {
+	r.speed = speed
+}
+
+// OnMessage callback, called with every recorded frame just like SocketClientV2.OnMessage.
+func (r *Replayer) OnMessage(f func(message []byte)) {
+	r.onMessage = f
+}
+
+// Run replays every recording and returns once done or when ctx is cancelled.
+func (r *Replayer) Run(ctx context.Context) error {
+	var (
+		first   time.Time
+		started time.Time
+	)
+	for _, path := range r.paths {
+		reader, err := OpenFile(path)
+		if err != nil {
+			return err
+		}
+		for {
+			frame, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				reader.Close()
+				return err
+			}
+
+			if first.IsZero() {
+				first, started = frame.Time, time.Now()
+			}
+			if r.speed > 0 {
+				due := started.Add(time.Duration(float64(frame.Time.Sub(first)) / r.speed))
+				if wait := time.Until(due); wait > 0 {
+					timer := time.NewTimer(wait)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						reader.Close()
+						return ctx.Err()
+					case <-timer.C:
+					}
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				reader.Close()
+				return err
+			}
+			if r.onMessage != nil {
+				r.onMessage(frame.Data)
+			}
+		}
+		if err := reader.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
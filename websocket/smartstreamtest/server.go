@@ -0,0 +1,420 @@
+// Package smartstreamtest provides an in-process SmartStream server for testing
+// and offline development of code built on websocket.SocketClientV2.
+package smartstreamtest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	smartstream "github.com/piyushpatil22/smartapigo/websocket"
+)
+
+const (
+	// Price step used to round generated prices and space order book levels.
+	tickSize = 0.05
+)
+
+// PricePath produces the successive traded prices of a token. It returns false
+// once exhausted, after which the token stops ticking.
+type PricePath interface {
+	Next() (float64, bool)
+}
+
+// ScriptedPath replays a fixed list of prices.
+type ScriptedPath struct {
+	prices []float64
+	index  int
+}
+
+// NewScriptedPath returns a path yielding the given prices in order.
+func NewScriptedPath(prices ...float64) *ScriptedPath {
+	return &ScriptedPath{prices: prices}
+}
+
+// Next returns the next scripted price.
+func (p *ScriptedPath) Next() (float64, bool) {
+	if p.index >= len(p.prices) {
+		return 0, false
+	}
+	price := p.prices[p.index]
+	p.index++
+	return price, true
+}
+
+// RandomWalk is an endless geometric random walk rounded to the tick size.
+type RandomWalk struct {
+	price      float64
+	volatility float64
+	rng        *rand.Rand
+}
+
+// NewRandomWalk returns a random walk starting at start where each step moves the
+// price by a normally distributed return with the given volatility. The same seed
+// yields the same path.
+func NewRandomWalk(start, volatility float64, seed int64) *RandomWalk {
+	return &RandomWalk{price: start, volatility: volatility, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Next returns the next price of the walk.
+func (w *RandomWalk) Next() (float64, bool) {
+	w.price *= math.Exp(w.rng.NormFloat64() * w.volatility)
+	w.price = roundToTick(w.price)
+	if w.price < tickSize {
+		w.price = tickSize
+	}
+	return w.price, true
+}
+
+// Server is a mock SmartStream server. It validates the auth headers, honors
+// subscribe and unsubscribe requests, answers heartbeats and emits binary packets
+// encoded for the mode each token was subscribed in.
+type Server struct {
+	// URL of the server, usable with SocketClientV2.SetRootURL.
+	URL string
+
+	authToken  string
+	clientCode string
+	apiKey     string
+	feedToken  string
+	httpServer *httptest.Server
+	conns      map[*serverConn]bool
+	paths      map[tokenKey]PricePath
+	tokens     map[tokenKey]*tokenState
+	requests   []smartstream.RequestData
+	stop       chan struct{}
+	closeOnce  sync.Once
+	mutex      sync.Mutex
+}
+
+// tokenKey identifies a token on an exchange.
+type tokenKey struct {
+	exchangeType int
+	token        string
+}
+
+// tokenState is the running market state of a token shared by all connections.
+type tokenState struct {
+	sequence      int64
+	ltp           float64
+	ltq           int64
+	open          float64
+	high          float64
+	low           float64
+	close         float64
+	volume        int64
+	turnover      float64
+	lastTradeTime time.Time
+}
+
+// serverConn is a connected client along with its subscriptions.
+type serverConn struct {
+	ws            *websocket.Conn
+	subscriptions map[tokenKey]map[int]bool
+	writeMutex    sync.Mutex
+}
+
+func (c *serverConn) write(messageType int, data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.ws.WriteMessage(messageType, data)
+}
+
+// NewServer starts a server accepting the given credentials. Empty credentials are
+// not checked. The caller should call Close when finished.
+func NewServer(auth_token, client_code, api_key, feed_token string) *Server {
+	s := &Server{
+		authToken:  auth_token,
+		clientCode: client_code,
+		apiKey:     api_key,
+		feedToken:  feed_token,
+		conns:      make(map[*serverConn]bool),
+		paths:      make(map[tokenKey]PricePath),
+		tokens:     make(map[tokenKey]*tokenState),
+		stop:       make(chan struct{}),
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = "ws" + strings.TrimPrefix(s.httpServer.URL, "http")
+	return s
+}
+
+// Close disconnects every client and shuts the server down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.DropConnections()
+		s.httpServer.Close()
+	})
+}
+
+// SetPricePath sets the price path of a token. Tokens without a path follow a
+// random walk seeded by the token.
+func (s *Server) SetPricePath(exchangeType int, token string, path PricePath) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paths[tokenKey{exchangeType, token}] = path
+}
+
+// Start emits a tick for every subscribed token at the given interval until the
+// server is closed.
+func (s *Server) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.Tick()
+			}
+		}
+	}()
+}
+
+// Tick advances the price path of every subscribed token by one step and sends
+// the resulting packets to the subscribers. It returns the number of packets sent.
+func (s *Server) Tick() int {
+	s.mutex.Lock()
+	now := time.Now()
+	advanced := make(map[tokenKey]bool)
+	type packet struct {
+		conn *serverConn
+		data []byte
+	}
+	var packets []packet
+	for conn := range s.conns {
+		for key, modes := range conn.subscriptions {
+			if _, ok := advanced[key]; !ok {
+				advanced[key] = s.advance(key, now)
+			}
+			if !advanced[key] {
+				continue
+			}
+			for mode := range modes {
+				data, err := smartstream.EncodeBinaryData(s.tokens[key].parsedData(key, mode, now))
+				if err != nil {
+					continue
+				}
+				packets = append(packets, packet{conn, data})
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	sent := 0
+	for _, p := range packets {
+		if err := p.conn.write(websocket.BinaryMessage, p.data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Subscribed reports whether any connection is subscribed to the token in the mode.
+func (s *Server) Subscribed(mode, exchangeType int, token string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		if conn.subscriptions[tokenKey{exchangeType, token}][mode] {
+			return true
+		}
+	}
+	return false
+}
+
+// Connections returns the number of connected clients.
+func (s *Server) Connections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.conns)
+}
+
+// Requests returns every subscribe and unsubscribe request received so far.
+func (s *Server) Requests() []smartstream.RequestData {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]smartstream.RequestData(nil), s.requests...)
+}
+
+// DropConnections abruptly closes every client connection, e.g. to exercise reconnects.
+func (s *Server) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.ws.Close()
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	expected := map[string]string{
+		"Authorization": s.authToken,
+		"x-api-key":     s.apiKey,
+		"x-client-code": s.clientCode,
+		"x-feed-token":  s.feedToken,
+	}
+	for header, value := range expected {
+		if value != "" && r.Header.Get(header) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &serverConn{ws: ws, subscriptions: make(map[tokenKey]map[int]bool)}
+
+	s.mutex.Lock()
+	s.conns[conn] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		ws.Close()
+	}()
+
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if string(message) == smartstream.HEART_BEAT_MESSAGE {
+			conn.write(websocket.TextMessage, []byte(smartstream.HEART_BEAT_RESPONSE))
+			continue
+		}
+
+		var request smartstream.RequestData
+		if err := json.Unmarshal(message, &request); err != nil {
+			continue
+		}
+		s.apply(conn, request)
+	}
+}
+
+// apply records a subscribe or unsubscribe request on the connection.
+func (s *Server) apply(conn *serverConn, request smartstream.RequestData) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, request)
+	for _, set := range request.Params.TokenList {
+		for _, token := range set.Tokens {
+			key := tokenKey{set.ExchangeType, token}
+			switch request.Action {
+			case smartstream.SUBSCRIBE_ACTION:
+				if conn.subscriptions[key] == nil {
+					conn.subscriptions[key] = make(map[int]bool)
+				}
+				conn.subscriptions[key][request.Params.Mode] = true
+			case smartstream.UNSUBSCRIBE_ACTION:
+				delete(conn.subscriptions[key], request.Params.Mode)
+				if len(conn.subscriptions[key]) == 0 {
+					delete(conn.subscriptions, key)
+				}
+			}
+		}
+	}
+}
+
+// advance moves the token one step along its price path. Must be called with the mutex held.
+func (s *Server) advance(key tokenKey, now time.Time) bool {
+	path, ok := s.paths[key]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(key.token))
+		path = NewRandomWalk(100, 0.001, int64(h.Sum64()))
+		s.paths[key] = path
+	}
+	price, ok := path.Next()
+	if !ok {
+		return false
+	}
+
+	state, ok := s.tokens[key]
+	if !ok {
+		state = &tokenState{open: price, high: price, low: price, close: price}
+		s.tokens[key] = state
+	}
+	state.sequence++
+	state.ltp = price
+	state.ltq = 1 + state.sequence%50
+	state.volume += state.ltq
+	state.turnover += price * float64(state.ltq)
+	state.high = math.Max(state.high, price)
+	state.low = math.Min(state.low, price)
+	state.lastTradeTime = now
+	return true
+}
+
+// parsedData renders the token state in the given subscription mode.
+func (st *tokenState) parsedData(key tokenKey, mode int, now time.Time) smartstream.ParsedData {
+	data := smartstream.ParsedData{
+		SubscriptionMode:     smartstream.SubscriptionMode(mode),
+		ExchangeType:         byte(key.exchangeType),
+		Token:                key.token,
+		SequenceNumber:       st.sequence,
+		ExchangeTimestamp:    now.UnixNano() / int64(time.Millisecond),
+		LastTradedPrice:      st.ltp,
+		LastTradedQuantity:   st.ltq,
+		AverageTradedPrice:   roundToTick(st.turnover / float64(st.volume)),
+		VolumeTradeForTheDay: st.volume,
+		OpenPriceOfTheDay:    st.open,
+		HighPriceOfTheDay:    st.high,
+		LowPriceOfTheDay:     st.low,
+		ClosedPrice:          st.close,
+		LastTradedTimestamp:  st.lastTradeTime.Unix(),
+		UpperCircuitLimit:    int64(math.Round(st.close * 1.2 * smartstream.SCALING_FACTOR)),
+		LowerCircuitLimit:    int64(math.Round(st.close * 0.8 * smartstream.SCALING_FACTOR)),
+		High52WeekPrice:      st.high,
+		Low52WeekPrice:       st.low,
+		PacketReceivedTime:   now.UnixNano() / int64(time.Millisecond),
+	}
+
+	for i := 0; i < 5; i++ {
+		quantity := int64(100 * (i + 1))
+		data.Best5BuyData = append(data.Best5BuyData, smartstream.OrderData{Flag: 0, Quantity: quantity, Price: st.bid(i), NoOfOrders: uint16(i + 1)})
+		data.Best5SellData = append(data.Best5SellData, smartstream.OrderData{Flag: 1, Quantity: quantity, Price: st.ask(i), NoOfOrders: uint16(i + 1)})
+		data.TotalBuyQuantity += float64(quantity)
+		data.TotalSellQuantity += float64(quantity)
+	}
+
+	if mode == smartstream.DEPTH {
+		for i := 0; i < smartstream.DEPTH_LEVELS; i++ {
+			quantity := int32(50 * (i + 1))
+			data.Depth20BuyData = append(data.Depth20BuyData, smartstream.DepthData{Quantity: quantity, Price: st.bid(i), NumOfOrders: int16(i + 1)})
+			data.Depth20SellData = append(data.Depth20SellData, smartstream.DepthData{Quantity: quantity, Price: st.ask(i), NumOfOrders: int16(i + 1)})
+		}
+	}
+	return data
+}
+
+// bid returns the price of the bid level, level 0 being the best bid.
+func (st *tokenState) bid(level int) float64 {
+	return roundToTick(st.ltp - tickSize*float64(level+1))
+}
+
+// ask returns the price of the ask level, level 0 being the best ask.
+func (st *tokenState) ask(level int) float64 {
+	return roundToTick(st.ltp + tickSize*float64(level+1))
+}
+
+func roundToTick(price float64) float64 {
+	return math.Round(price/tickSize) * tickSize
+}
@@ -0,0 +1,138 @@
+package smartstreamtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	smartstream "github.com/piyushpatil22/smartapigo/websocket"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServerTicks(t *testing.T) {
+	server := NewServer("auth", "client", "key", "feed")
+	defer server.Close()
+	server.SetPricePath(smartstream.NSE_CM, "3045", NewScriptedPath(590.5, 591, 589.75))
+
+	client := smartstream.NewSocketConnV2("auth", "client", "key", "feed", smartstream.RetryParams{})
+	client.SetRootURL(server.URL)
+
+	var (
+		mutex sync.Mutex
+		ticks []smartstream.ParsedData
+	)
+	client.OnMessage(func(message []byte) {
+		data, err := smartstream.ParseBinaryData(message)
+		if err != nil {
+			t.Errorf("Error parsing packet. %v", err)
+			return
+		}
+		mutex.Lock()
+		ticks = append(ticks, data)
+		mutex.Unlock()
+	})
+	tokens := []smartstream.TokenSet{{ExchangeType: smartstream.NSE_CM, Tokens: []string{"3045"}}}
+	client.Subscribe("ltp", smartstream.LTP_MODE, tokens)
+	client.Subscribe("snap", smartstream.SNAP_QUOTE, tokens)
+	client.Subscribe("depth", smartstream.DEPTH, tokens)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- client.Run(ctx)
+	}()
+
+	waitFor(t, "subscriptions", func() bool { return server.Subscribed(smartstream.DEPTH, smartstream.NSE_CM, "3045") })
+	for i := 0; i < 4; i++ {
+		server.Tick()
+	}
+	waitFor(t, "ticks", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(ticks) == 9
+	})
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned error. %v", err)
+	}
+
+	var ltps []float64
+	for _, tick := range ticks {
+		switch tick.SubscriptionMode {
+		case smartstream.LTP_MODE:
+			ltps = append(ltps, tick.LastTradedPrice)
+		case smartstream.SNAP_QUOTE:
+			if len(tick.Best5BuyData) != 5 || len(tick.Best5SellData) != 5 {
+				t.Errorf("Expected best 5 data on both sides, got %+v", tick)
+			}
+			if tick.Best5BuyData[0].Price >= tick.LastTradedPrice || tick.Best5SellData[0].Price <= tick.LastTradedPrice {
+				t.Errorf("Best bid and ask should straddle the LTP, got %+v", tick)
+			}
+		case smartstream.DEPTH:
+			if len(tick.Depth20BuyData) != 20 || len(tick.Depth20SellData) != 20 {
+				t.Errorf("Expected 20 depth levels on both sides, got %+v", tick)
+			}
+		}
+	}
+	expected := []float64{590.5, 591, 589.75}
+	if len(ltps) != len(expected) {
+		t.Fatalf("Expected LTPs %v, got %v", expected, ltps)
+	}
+	for i := range expected {
+		if ltps[i] != expected[i] {
+			t.Errorf("Expected LTPs %v, got %v", expected, ltps)
+		}
+	}
+}
+
+func TestServerRejectsInvalidFeedToken(t *testing.T) {
+	server := NewServer("auth", "client", "key", "feed")
+	defer server.Close()
+
+	client := smartstream.NewSocketConnV2("auth", "client", "key", "expired", smartstream.RetryParams{})
+	client.SetRootURL(server.URL)
+	if err := client.Run(context.Background()); err == nil {
+		t.Errorf("Expected Run to fail with an invalid feed token")
+	}
+}
+
+func TestEncodeBinaryDataRoundTrip(t *testing.T) {
+	state := &tokenState{ltp: 101.25, ltq: 10, open: 100, high: 102, low: 99.5, close: 100.5, volume: 500, turnover: 50500, sequence: 7}
+	for mode := range smartstream.PACKET_SIZE_MAP {
+		expected := state.parsedData(tokenKey{smartstream.NSE_FO, "52345"}, mode, time.Unix(1700000000, 0))
+		packet, err := smartstream.EncodeBinaryData(expected)
+		if err != nil {
+			t.Fatalf("Error encoding mode %d. %v", mode, err)
+		}
+		parsed, err := smartstream.ParseBinaryData(packet)
+		if err != nil {
+			t.Fatalf("Error parsing mode %d. %v", mode, err)
+		}
+		if parsed.Token != "52345" || parsed.ExchangeType != smartstream.NSE_FO {
+			t.Errorf("Mode %d: unexpected token %+v", mode, parsed)
+		}
+		if mode != smartstream.DEPTH && parsed.LastTradedPrice != 101.25 {
+			t.Errorf("Mode %d: expected LTP 101.25, got %v", mode, parsed.LastTradedPrice)
+		}
+		if mode == smartstream.QUOTE && (parsed.VolumeTradeForTheDay != 500 || parsed.HighPriceOfTheDay != 102) {
+			t.Errorf("Mode %d: unexpected quote %+v", mode, parsed)
+		}
+		if mode == smartstream.DEPTH && parsed.Depth20SellData[19].Price != expected.Depth20SellData[19].Price {
+			t.Errorf("Mode %d: unexpected depth %+v", mode, parsed.Depth20SellData[19])
+		}
+	}
+
+	if _, err := smartstream.ParseBinaryData(make([]byte, 60)); err == nil {
+		t.Errorf("Expected a short packet to be rejected")
+	}
+}
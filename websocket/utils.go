@@ -31,6 +31,27 @@ var (
 
 const (
 	SCALING_FACTOR = 100
+
+	// Size in bytes of the packet of each subscription mode.
+	LTP_PACKET_SIZE        = 51
+	QUOTE_PACKET_SIZE      = 123
+	SNAP_QUOTE_PACKET_SIZE = 379
+	DEPTH_PACKET_SIZE      = 443
+
+	BEST_5_PACKET_SIZE = 20
+	DEPTH_LEVELS       = 20
+	DEPTH_LEVEL_SIZE   = 10
+)
+
+var (
+	PACKET_SIZE_MAP = map[int]int{
+		LTP_MODE:   LTP_PACKET_SIZE,
+		QUOTE:      QUOTE_PACKET_SIZE,
+		SNAP_QUOTE: SNAP_QUOTE_PACKET_SIZE,
+		DEPTH:      DEPTH_PACKET_SIZE,
+	}
+
+	ErrInvalidPacket = fmt.Errorf("invalid packet: length does not match the subscription mode")
 )
 
 type SubscriptionMode int
@@ -78,12 +99,28 @@ type DepthData struct {
 	NumOfOrders int16
 }
 
+// ParseBinaryData decodes a SmartStream binary packet of any subscription mode.
 func ParseBinaryData(binaryData []byte) (ParsedData, error) {
 	var parsedData ParsedData
 
+	if len(binaryData) < LTP_PACKET_SIZE {
+		return parsedData, ErrInvalidPacket
+	}
+	mode := int(binaryData[0])
+	if size, ok := PACKET_SIZE_MAP[mode]; !ok || len(binaryData) < size {
+		return parsedData, ErrInvalidPacket
+	}
+
 	parsedData.SubscriptionMode = SubscriptionMode(binaryData[0])
 	parsedData.ExchangeType = binaryData[1]
 	parsedData.Token = parseTokenValue(binaryData[2:27])
+
+	if parsedData.SubscriptionMode == DEPTH {
+		parsedData.PacketReceivedTime = unpackData(binaryData, 35, 43, "q").(int64)
+		parsedData.Depth20BuyData, parsedData.Depth20SellData = parseDepth20Data(binaryData[43:DEPTH_PACKET_SIZE])
+		return parsedData, nil
+	}
+
 	parsedData.SequenceNumber = unpackData(binaryData, 27, 35, "q").(int64)
 	parsedData.ExchangeTimestamp = unpackData(binaryData, 35, 43, "q").(int64)
 	parsedData.LastTradedPrice = float64(unpackData(binaryData, 43, 51, "q").(int64)) / SCALING_FACTOR
@@ -105,17 +142,140 @@ func ParseBinaryData(binaryData []byte) (ParsedData, error) {
 		parsedData.LastTradedTimestamp = unpackData(binaryData, 123, 131, "q").(int64)
 		parsedData.OpenInterest = unpackData(binaryData, 131, 139, "q").(int64)
 		parsedData.OpenInterestChangePercentage = unpackData(binaryData, 139, 147, "q").(int64)
+		parsedData.Best5BuyData, parsedData.Best5SellData = parseBest5Data(binaryData[147:347])
 		parsedData.UpperCircuitLimit = unpackData(binaryData, 347, 355, "q").(int64)
 		parsedData.LowerCircuitLimit = unpackData(binaryData, 355, 363, "q").(int64)
 		parsedData.High52WeekPrice = float64(unpackData(binaryData, 363, 371, "q").(int64)) / SCALING_FACTOR
 		parsedData.Low52WeekPrice = float64(unpackData(binaryData, 371, 379, "q").(int64)) / SCALING_FACTOR
 	}
 
-	if parsedData.SubscriptionMode == DEPTH {
-		parsedData.PacketReceivedTime = unpackData(binaryData, 35, 43, "q").(int64)
+	return parsedData, nil
+}
+
+// parseBest5Data splits the 10 best 5 packets of a SNAP_QUOTE into buy and sell sides.
+func parseBest5Data(binaryData []byte) ([]OrderData, []OrderData) {
+	var buy, sell []OrderData
+	for i := 0; i+BEST_5_PACKET_SIZE <= len(binaryData); i += BEST_5_PACKET_SIZE {
+		data := OrderData{
+			Flag:       unpackData(binaryData, i, i+2, "H").(uint16),
+			Quantity:   unpackData(binaryData, i+2, i+10, "q").(int64),
+			Price:      float64(unpackData(binaryData, i+10, i+18, "q").(int64)) / SCALING_FACTOR,
+			NoOfOrders: unpackData(binaryData, i+18, i+20, "H").(uint16),
+		}
+		if data.Flag == 0 {
+			buy = append(buy, data)
+		} else {
+			sell = append(sell, data)
+		}
 	}
+	return buy, sell
+}
 
-	return parsedData, nil
+// parseDepth20Data decodes the 20 buy levels followed by the 20 sell levels of a DEPTH packet.
+func parseDepth20Data(binaryData []byte) ([]DepthData, []DepthData) {
+	buy := make([]DepthData, 0, DEPTH_LEVELS)
+	sell := make([]DepthData, 0, DEPTH_LEVELS)
+	for i := 0; i < DEPTH_LEVELS; i++ {
+		buy = append(buy, parseDepthLevel(binaryData[i*DEPTH_LEVEL_SIZE:]))
+		sell = append(sell, parseDepthLevel(binaryData[(DEPTH_LEVELS+i)*DEPTH_LEVEL_SIZE:]))
+	}
+	return buy, sell
+}
+
+func parseDepthLevel(binaryData []byte) DepthData {
+	return DepthData{
+		Quantity:    int32(unpackData(binaryData, 0, 4, "I").(uint32)),
+		Price:       float64(int32(unpackData(binaryData, 4, 8, "I").(uint32))) / SCALING_FACTOR,
+		NumOfOrders: int16(unpackData(binaryData, 8, 10, "H").(uint16)),
+	}
+}
+
+// EncodeBinaryData encodes parsed data into a SmartStream binary packet, the inverse
+// of ParseBinaryData. It is mostly useful to simulate a feed.
+func EncodeBinaryData(parsedData ParsedData) ([]byte, error) {
+	mode := int(parsedData.SubscriptionMode)
+	size, ok := PACKET_SIZE_MAP[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid subscription mode %d", mode)
+	}
+	if len(parsedData.Token) > 25 {
+		return nil, fmt.Errorf("token %s is longer than 25 bytes", parsedData.Token)
+	}
+
+	data := make([]byte, size)
+	data[0] = byte(mode)
+	data[1] = parsedData.ExchangeType
+	copy(data[2:27], parsedData.Token)
+
+	if mode == DEPTH {
+		packInt64(data, 35, parsedData.PacketReceivedTime)
+		for i := 0; i < DEPTH_LEVELS; i++ {
+			if i < len(parsedData.Depth20BuyData) {
+				packDepthLevel(data[43+i*DEPTH_LEVEL_SIZE:], parsedData.Depth20BuyData[i])
+			}
+			if i < len(parsedData.Depth20SellData) {
+				packDepthLevel(data[43+(DEPTH_LEVELS+i)*DEPTH_LEVEL_SIZE:], parsedData.Depth20SellData[i])
+			}
+		}
+		return data, nil
+	}
+
+	packInt64(data, 27, parsedData.SequenceNumber)
+	packInt64(data, 35, parsedData.ExchangeTimestamp)
+	packPrice(data, 43, parsedData.LastTradedPrice)
+
+	if mode == QUOTE || mode == SNAP_QUOTE {
+		packInt64(data, 51, parsedData.LastTradedQuantity)
+		packPrice(data, 59, parsedData.AverageTradedPrice)
+		packInt64(data, 67, parsedData.VolumeTradeForTheDay)
+		LITTLE_ENDIAN_BYTE_ORDER.PutUint64(data[75:83], math.Float64bits(parsedData.TotalBuyQuantity))
+		LITTLE_ENDIAN_BYTE_ORDER.PutUint64(data[83:91], math.Float64bits(parsedData.TotalSellQuantity))
+		packPrice(data, 91, parsedData.OpenPriceOfTheDay)
+		packPrice(data, 99, parsedData.HighPriceOfTheDay)
+		packPrice(data, 107, parsedData.LowPriceOfTheDay)
+		packPrice(data, 115, parsedData.ClosedPrice)
+	}
+
+	if mode == SNAP_QUOTE {
+		packInt64(data, 123, parsedData.LastTradedTimestamp)
+		packInt64(data, 131, parsedData.OpenInterest)
+		packInt64(data, 139, parsedData.OpenInterestChangePercentage)
+		levels := append(append([]OrderData(nil), parsedData.Best5BuyData...), parsedData.Best5SellData...)
+		for i, level := range levels {
+			if i == 10 {
+				break
+			}
+			offset := 147 + i*BEST_5_PACKET_SIZE
+			var flag uint16
+			if i >= len(parsedData.Best5BuyData) {
+				flag = 1
+			}
+			LITTLE_ENDIAN_BYTE_ORDER.PutUint16(data[offset:offset+2], flag)
+			packInt64(data, offset+2, level.Quantity)
+			packPrice(data, offset+10, level.Price)
+			LITTLE_ENDIAN_BYTE_ORDER.PutUint16(data[offset+18:offset+20], level.NoOfOrders)
+		}
+		packInt64(data, 347, parsedData.UpperCircuitLimit)
+		packInt64(data, 355, parsedData.LowerCircuitLimit)
+		packPrice(data, 363, parsedData.High52WeekPrice)
+		packPrice(data, 371, parsedData.Low52WeekPrice)
+	}
+
+	return data, nil
+}
+
+func packInt64(data []byte, start int, value int64) {
+	LITTLE_ENDIAN_BYTE_ORDER.PutUint64(data[start:start+8], uint64(value))
+}
+
+func packPrice(data []byte, start int, price float64) {
+	packInt64(data, start, int64(math.Round(price*SCALING_FACTOR)))
+}
+
+func packDepthLevel(data []byte, level DepthData) {
+	LITTLE_ENDIAN_BYTE_ORDER.PutUint32(data[0:4], uint32(level.Quantity))
+	LITTLE_ENDIAN_BYTE_ORDER.PutUint32(data[4:8], uint32(int32(math.Round(level.Price*SCALING_FACTOR))))
+	LITTLE_ENDIAN_BYTE_ORDER.PutUint16(data[8:10], uint16(level.NumOfOrders))
 }
 
 func unpackData(binaryData []byte, start, end int, byteFormat string) interface{} {
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/piyushpatil22/smartapigo"
+	"github.com/piyushpatil22/smartapigo/calendar"
+)
+
+const (
+	// Default window within which a heartbeat response must arrive before the
+	// connection is considered dead and a reconnect is forced.
+	defaultPongTimeout time.Duration = 3 * HEART_BEAT_INTERVAL * time.Second
+	// Default interval in which the watchdog checks the connection and token activity.
+	defaultWatchdogInterval time.Duration = time.Second
+)
+
+var (
+	ErrPongTimeout = fmt.Errorf("no heartbeat response received within the pong timeout, reconnecting")
+)
+
+// tokenKey identifies a subscribed token regardless of its subscription mode.
+type tokenKey struct {
+	ExchangeType int
+	Token        string
+}
+
+// tokenActivity is the last tick time of a subscribed token.
+type tokenActivity struct {
+	lastTick time.Time
+	stale    bool
+}
+
+// stalenessTracker keeps the last tick time of every subscribed token and
+// reports the ones that have not ticked within the timeout.
+type stalenessTracker struct {
+	timeout     time.Duration
+	marketHours func(time.Time) bool
+	tokens      map[tokenKey]*tokenActivity
+	mutex       sync.Mutex
+}
+
+func newStalenessTracker() *stalenessTracker {
+	return &stalenessTracker{
+		marketHours: calendar.NewCalendar().MarketHours(smartapigo.NSE),
+		tokens:      make(map[tokenKey]*tokenActivity),
+	}
+}
+
+// sync makes the tracked tokens match the subscriptions, keeping activity of
+// tokens that remain subscribed.
+func (st *stalenessTracker) sync(subscriptions map[int]map[int][]string) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	now := time.Now()
+	tokens := make(map[tokenKey]*tokenActivity)
+	for _, exchanges := range subscriptions {
+		for exchangeType, list := range exchanges {
+			for _, token := range list {
+				key := tokenKey{ExchangeType: exchangeType, Token: token}
+				if activity, ok := st.tokens[key]; ok {
+					tokens[key] = activity
+				} else {
+					tokens[key] = &tokenActivity{lastTick: now}
+				}
+			}
+		}
+	}
+	st.tokens = tokens
+}
+
+// reset restarts the clock of every token, used after a reconnect.
+func (st *stalenessTracker) reset() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	now := time.Now()
+	for _, activity := range st.tokens {
+		activity.lastTick = now
+		activity.stale = false
+	}
+}
+
+// tick records a tick of the token carried by a binary packet.
+func (st *stalenessTracker) tick(message []byte) {
+	if len(message) < 27 {
+		return
+	}
+	key := tokenKey{ExchangeType: int(message[1]), Token: parseTokenValue(message[2:27])}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if activity, ok := st.tokens[key]; ok {
+		activity.lastTick = time.Now()
+		activity.stale = false
+	}
+}
+
+// check returns the tokens that became stale since the last check. A token is
+// reported once until it ticks again.
+func (st *stalenessTracker) check(now time.Time) []StaleToken {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.timeout <= 0 || (st.marketHours != nil && !st.marketHours(now)) {
+		return nil
+	}
+	var stale []StaleToken
+	for key, activity := range st.tokens {
+		if activity.stale || now.Sub(activity.lastTick) < st.timeout {
+			continue
+		}
+		activity.stale = true
+		stale = append(stale, StaleToken{ExchangeType: key.ExchangeType, Token: key.Token, LastTick: activity.lastTick})
+	}
+	return stale
+}
+
+// StaleToken is reported when a subscribed token has not ticked within the stale timeout.
+type StaleToken struct {
+	ExchangeType int
+	Token        string
+	LastTick     time.Time
+}
+
+// SetPongTimeout sets the window within which a heartbeat response must arrive.
+// When it elapses the connection is dropped and a reconnect is forced. Zero disables the check.
+func (sw *SocketClientV2) SetPongTimeout(timeout time.Duration) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	sw.pongTimeout = timeout
+}
+
+// SetStaleTokenTimeout enables per token staleness detection. A subscribed token
+// that has not ticked for the timeout during market hours is reported to OnStaleToken.
+func (sw *SocketClientV2) SetStaleTokenTimeout(timeout time.Duration) {
+	sw.staleness.mutex.Lock()
+	defer sw.staleness.mutex.Unlock()
+	sw.staleness.timeout = timeout
+}
+
+// SetMarketHours overrides the predicate deciding when staleness is checked.
+// By default it is the NSE normal session on weekdays, without holidays.
+func (sw *SocketClientV2) SetMarketHours(f func(t time.Time) bool) {
+	sw.staleness.mutex.Lock()
+	defer sw.staleness.mutex.Unlock()
+	sw.staleness.marketHours = f
+}
+
+// OnStaleToken callback.
+func (sw *SocketClientV2) OnStaleToken(f func(token StaleToken)) {
+	sw.callbacks.onStaleToken = f
+}
+
+// runWatchdog forces a reconnect when heartbeat responses stop arriving and
+// reports stale tokens, until the connection is shut down.
+func (sw *SocketClientV2) runWatchdog(c *wsConnection) {
+	ticker := time.NewTicker(sw.watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			sw.mutex.Lock()
+			timeout := sw.pongTimeout
+			lastPong := sw.lastPongTimestamp
+			sw.mutex.Unlock()
+
+			if timeout > 0 && now.Sub(lastPong) > timeout {
+				sw.logger.Warnf("No pong since %v, reconnecting", lastPong)
+				sw.triggerError(ErrPongTimeout)
+				c.shutdown()
+				return
+			}
+
+			for _, token := range sw.staleness.check(now) {
+				sw.triggerStaleToken(token)
+			}
+			sw.feed.report(now)
+		}
+	}
+}
+
+func (sw *SocketClientV2) triggerStaleToken(token StaleToken) {
+	if sw.callbacks.onStaleToken != nil {
+		sw.callbacks.onStaleToken(token)
+	}
+}
@@ -3,6 +3,8 @@ package websocket
 import (
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 const (
 	ROOT_URI            = "wss://smartapisocket.angelone.in/smart-stream"
 	HEART_BEAT_MESSAGE  = "ping"
+	HEART_BEAT_RESPONSE = "pong"
 	HEART_BEAT_INTERVAL = 10
 	RESUBSCRIBE_FLAG    = false
 
@@ -40,6 +43,13 @@ const (
 	DEFAULT_RETRY_DELAY        = 10
 	DEFAULT_RETRY_MULTPLIER    = 2
 	DEFAULT_RETRY_DURATION     = 60
+
+	// Retry strategies for RetryParams.RetryStrategy
+	RETRY_STRATEGY_SIMPLE      = 0
+	RETRY_STRATEGY_EXPONENTIAL = 1
+
+	// Time allowed to write a message to the socket.
+	writeWait = 10 * time.Second
 )
 
 var (
@@ -49,6 +59,19 @@ var (
 		3: "SNAP_QUOTE",
 		4: "DEPTH",
 	}
+
+	// EXCHANGE_TYPE_MAP maps the exchange segments used by the REST API to exchange types.
+	EXCHANGE_TYPE_MAP = map[string]int{
+		smartapigo.NSE:   NSE_CM,
+		smartapigo.NFO:   NSE_FO,
+		smartapigo.BSE:   BSE_CM,
+		smartapigo.BFO:   BSE_FO,
+		smartapigo.MCX:   MCX_FO,
+		smartapigo.NCDEX: NCX_FO,
+		smartapigo.CDS:   CDE_FO,
+	}
+
+	ErrNotConnected = fmt.Errorf("websocket is not connected")
 )
 
 type SocketClientV2 struct {
@@ -57,13 +80,23 @@ type SocketClientV2 struct {
 	callbacks         callbacksV2
 	Client_code       string
 	Feed_token        string
+	url               string
+	heartbeatInterval time.Duration
+	pongTimeout       time.Duration
+	watchdogInterval  time.Duration
 	disconnectFlag    bool
-	LastPongTimestamp time.Time
+	lastPongTimestamp time.Time
+	staleness         *stalenessTracker
+	feed              *feedMetrics
 	inputRequestMap   map[int]map[int][]string
 	retryParams       RetryParams
 	resubscribeFlag   bool
 	logger            *logrus.Logger
-	wsConn            *websocket.Conn
+	conn              *wsConnection
+	state             ConnectionState
+	serving           bool
+	routines          sync.WaitGroup
+	stop              chan struct{}
 	mutex             sync.Mutex
 }
 
@@ -74,6 +107,7 @@ type callbacksV2 struct {
 	onConnect     func()
 	onClose       func(int, string)
 	onError       func(error)
+	onStaleToken  func(StaleToken)
 }
 
 type RetryParams struct {
@@ -85,16 +119,48 @@ type RetryParams struct {
 	RetryDuration   int
 }
 
+// wsConnection is a single dialed socket. All writes to it go through one writer
+// goroutine fed by the writes channel, since gorilla supports a single writer only.
+type wsConnection struct {
+	ws       *websocket.Conn
+	writes   chan writeRequest
+	done     chan struct{}
+	doneOnce sync.Once
+	readDone chan struct{}
+}
+
+// writeRequest is a single message queued for the writer goroutine.
+type writeRequest struct {
+	messageType int
+	data        []byte
+	result      chan error
+}
+
+// shutdown stops the writer and heartbeat goroutines and closes the socket.
+func (c *wsConnection) shutdown() {
+	c.doneOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
 // Create a new ticker instance with latest supported websocket streaming functionality
 func NewSocketConnV2(auth_token, client_code, api_key, feed_token string, retryParam RetryParams) *SocketClientV2 {
 	sw := &SocketClientV2{
-		Auth_token:      auth_token,
-		Client_code:     client_code,
-		Api_key:         api_key,
-		Feed_token:      feed_token,
-		retryParams:     retryParam,
-		logger:          logrus.New(),
-		inputRequestMap: make(map[int]map[int][]string),
+		Auth_token:        auth_token,
+		Client_code:       client_code,
+		Api_key:           api_key,
+		Feed_token:        feed_token,
+		url:               ROOT_URI,
+		heartbeatInterval: HEART_BEAT_INTERVAL * time.Second,
+		pongTimeout:       defaultPongTimeout,
+		watchdogInterval:  defaultWatchdogInterval,
+		staleness:         newStalenessTracker(),
+		feed:              newFeedMetrics(),
+		retryParams:       retryParam,
+		logger:            logrus.New(),
+		inputRequestMap:   make(map[int]map[int][]string),
+		stop:              make(chan struct{}),
 	}
 	sw.logger.SetLevel(logrus.InfoLevel)
 
@@ -102,8 +168,18 @@ func NewSocketConnV2(auth_token, client_code, api_key, feed_token string, retryP
 	return sw
 }
 
-func (s *SocketClientV2) Connect() {
+// SetRootURL overrides the SmartStream url, e.g. to point the client at a mock server.
+func (s *SocketClientV2) SetRootURL(u string) {
+	s.url = u
+}
 
+// Connect dials the SmartStream server and starts the writer and heartbeat routines.
+// Tokens subscribed before connecting are sent once the connection is up.
+func (s *SocketClientV2) Connect() error {
+	return s.connect()
+}
+
+func (s *SocketClientV2) connect() error {
 	headers := map[string][]string{
 		"Authorization": {s.Auth_token},
 		"x-api-key":     {s.Api_key},
@@ -111,112 +187,336 @@ func (s *SocketClientV2) Connect() {
 		"x-feed-token":  {s.Feed_token},
 	}
 
-	dialer := websocket.DefaultDialer
+	dialer := *websocket.DefaultDialer
 	dialer.TLSClientConfig = &tls.Config{
 		InsecureSkipVerify: true,
 	}
-	conn, _, err := dialer.Dial(ROOT_URI, headers)
+	s.mutex.Lock()
+	if s.state == StateIdle {
+		s.state = StateConnecting
+	}
+	s.mutex.Unlock()
+	s.recordState()
+
+	ws, resp, err := dialer.Dial(s.url, headers)
 	if err != nil {
-		s.logger.Errorf("Error connecting to websocket")
+		err = handshakeError(resp, err)
+		s.logger.Errorf("Error connecting to websocket: %v", err)
 		s.triggerError(err)
+		return err
 	}
 
-	s.wsConn = conn
-
-	defer s.wsConn.Close()
-
-	s.triggerConnect()
-
-	s.logger.Info("Connected to websocket!!")
+	c := &wsConnection{
+		ws:       ws,
+		writes:   make(chan writeRequest),
+		done:     make(chan struct{}),
+		readDone: make(chan struct{}),
+	}
 
-	s.wsConn.SetCloseHandler(s.handleClose)
+	ws.SetCloseHandler(func(code int, reason string) error {
+		s.triggerClose(code, reason)
+		message := websocket.FormatCloseMessage(code, "")
+		ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+		return nil
+	})
 
-	s.wsConn.SetPongHandler(func(appData string) error {
+	ws.SetPongHandler(func(appData string) error {
 		s.onPong(appData)
 		return nil
 	})
 
-	s.wsConn.SetPingHandler(func(appData string) error {
+	ws.SetPingHandler(func(appData string) error {
 		s.onPing(appData)
-		return nil
+		return ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
 	})
 
-	go s.runHeartbeat()
+	s.mutex.Lock()
+	if s.disconnectFlag {
+		s.mutex.Unlock()
+		ws.Close()
+		return ErrNotConnected
+	}
+	previous := s.conn
+	s.conn = c
+	s.state = StateConnected
+	s.lastPongTimestamp = time.Now()
+	resubscribe := s.resubscribeFlag
+	s.routines.Add(3)
+	s.mutex.Unlock()
+	s.recordState()
+
+	if previous != nil {
+		previous.shutdown()
+	}
+	s.staleness.reset()
+
+	go func() {
+		defer s.routines.Done()
+		s.runWriter(c)
+	}()
+	go func() {
+		defer s.routines.Done()
+		s.runHeartbeat(c)
+	}()
+	go func() {
+		defer s.routines.Done()
+		s.runWatchdog(c)
+	}()
+
+	s.triggerConnect()
+
+	s.logger.Info("Connected to websocket!!")
+
+	if resubscribe {
+		s.resubscribe()
+	}
+	return nil
+}
+
+// LastPongTimestamp returns the time the server last answered a heartbeat.
+func (sw *SocketClientV2) LastPongTimestamp() time.Time {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	return sw.lastPongTimestamp
 }
 
 func (sw *SocketClientV2) onPong(appData string) {
-	sw.LastPongTimestamp = time.Now()
-	sw.logger.Infof("Received pong: %s", appData)
+	sw.mutex.Lock()
+	sw.lastPongTimestamp = time.Now()
+	sw.mutex.Unlock()
+	sw.logger.Debugf("Received pong: %s", appData)
 }
 func (sw *SocketClientV2) onPing(appData string) {
-	sw.LastPongTimestamp = time.Now()
-	sw.logger.Infof("Received ping: %s", appData)
+	sw.mutex.Lock()
+	sw.lastPongTimestamp = time.Now()
+	sw.mutex.Unlock()
+	sw.logger.Debugf("Received ping: %s", appData)
 }
 
+// Serve reads messages and delivers them to OnMessage in the order they arrive,
+// reconnecting as per RetryParams when the connection drops. It returns once
+// CloseConnection is called or retries are exhausted.
 func (sw *SocketClientV2) Serve() {
+	sw.mutex.Lock()
+	sw.serving = true
+	sw.mutex.Unlock()
+	defer func() {
+		sw.mutex.Lock()
+		sw.serving = false
+		sw.mutex.Unlock()
+	}()
+
 	for {
-		//reconnect logic
 		sw.mutex.Lock()
+		c := sw.conn
+		sw.mutex.Unlock()
 
-		if sw.disconnectFlag {
-			sw.mutex.Unlock()
+		if c != nil {
+			sw.readMessages(c)
+			close(c.readDone)
+			c.shutdown()
+		}
+
+		if sw.isDisconnecting() {
 			return
 		}
-		//need to handle reconnect
 
-		sw.readMessages()
+		if !sw.handleReconnect() {
+			return
+		}
 	}
 }
-func (sw *SocketClientV2) runHeartbeat() {
-	ticker := time.NewTicker(HEART_BEAT_INTERVAL * time.Second)
+
+// runWriter writes queued messages to the connection until it is shut down.
+func (sw *SocketClientV2) runWriter(c *wsConnection) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case req := <-c.writes:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.ws.WriteMessage(req.messageType, req.data)
+			req.result <- err
+			if err != nil {
+				sw.logger.Errorf("Write message error: %v", err)
+				c.shutdown()
+				return
+			}
+		}
+	}
+}
+
+func (sw *SocketClientV2) runHeartbeat(c *wsConnection) {
+	ticker := time.NewTicker(sw.heartbeatInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		sw.mutex.Lock()
-		if sw.disconnectFlag {
-			sw.mutex.Unlock()
+	for {
+		select {
+		case <-c.done:
 			return
+		case <-ticker.C:
+			if err := sw.write(c, websocket.TextMessage, []byte(HEART_BEAT_MESSAGE)); err != nil {
+				return
+			}
+			sw.logger.Debug("Sent heartbeat")
 		}
-		sw.wsConn.WriteMessage(websocket.TextMessage, []byte(HEART_BEAT_MESSAGE))
-		sw.logger.Info("Sent heartbeat")
-		sw.mutex.Unlock()
 	}
 }
 
-func (sw *SocketClientV2) readMessages() {
+// write queues a message on the connection's writer and waits for the result.
+func (sw *SocketClientV2) write(c *wsConnection, messageType int, data []byte) error {
+	req := writeRequest{
+		messageType: messageType,
+		data:        data,
+		result:      make(chan error, 1),
+	}
+	select {
+	case c.writes <- req:
+	case <-c.done:
+		return ErrNotConnected
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-c.done:
+		return ErrNotConnected
+	}
+}
+
+// send writes a message on the current connection.
+func (sw *SocketClientV2) send(messageType int, data []byte) error {
+	sw.mutex.Lock()
+	c := sw.conn
+	sw.mutex.Unlock()
+	if c == nil {
+		return ErrNotConnected
+	}
+	return sw.write(c, messageType, data)
+}
+
+func (sw *SocketClientV2) readMessages(c *wsConnection) {
 	for {
-		_, message, err := sw.wsConn.ReadMessage()
+		_, message, err := c.ws.ReadMessage()
 		if err != nil {
-			sw.logger.Errorf("Read message error: %v", err)
-			sw.handleReconnect()
+			if !sw.isDisconnecting() {
+				sw.logger.Errorf("Read message error: %v", err)
+				sw.triggerError(err)
+			}
 			return
 		}
-		go sw.triggerMessage(message)
-		sw.handleMessage(message)
+		if string(message) == HEART_BEAT_RESPONSE {
+			sw.onPong(HEART_BEAT_RESPONSE)
+			continue
+		}
+		sw.staleness.tick(message)
+		sw.feed.tick(message)
+		sw.triggerMessage(message)
 	}
 }
 
-func (sw *SocketClientV2) handleMessage(message []byte) {
-	if string(message) == "pong" {
-		sw.onPong("pong")
-		return
+// handleReconnect dials again as per RetryParams and reports whether it succeeded.
+func (sw *SocketClientV2) handleReconnect() bool {
+	started := time.Now()
+	for {
+		sw.mutex.Lock()
+		if sw.disconnectFlag {
+			sw.mutex.Unlock()
+			return false
+		}
+		attempt := sw.retryParams.CurrentAttempt
+		expired := sw.retryParams.RetryDuration > 0 && time.Since(started) > time.Duration(sw.retryParams.RetryDuration)*time.Minute
+		if attempt >= sw.retryParams.MaxRetryAttempt || expired {
+			sw.state = StateFailed
+			sw.mutex.Unlock()
+			sw.recordState()
+			sw.logger.Warn("Max retry attempts reached, closing connection.")
+			sw.triggerNoReconnect(attempt)
+			return false
+		}
+		attempt++
+		sw.retryParams.CurrentAttempt = attempt
+		sw.state = StateReconnecting
+		delay := sw.retryDelay(attempt)
+		sw.mutex.Unlock()
+		sw.recordState()
+
+		sw.logger.Warnf("Reconnecting (Attempt %d)...", attempt)
+		sw.feed.reconnect()
+		sw.triggerReconnect(attempt, delay)
+
+		select {
+		case <-sw.stop:
+			return false
+		case <-time.After(delay):
+		}
+
+		if err := sw.connect(); err != nil {
+			if _, rejected := err.(authError); rejected {
+				sw.setState(StateFailed)
+				sw.triggerNoReconnect(attempt)
+				return false
+			}
+			continue
+		}
+
+		sw.mutex.Lock()
+		sw.retryParams.CurrentAttempt = 0
+		sw.mutex.Unlock()
+		return true
 	}
+}
 
+// retryDelay returns the wait before the given reconnect attempt. Must be called with the mutex held.
+func (sw *SocketClientV2) retryDelay(attempt int) time.Duration {
+	delay := time.Duration(sw.retryParams.RetryDelay) * time.Second
+	if sw.retryParams.RetryStrategy == RETRY_STRATEGY_EXPONENTIAL && sw.retryParams.RetryMultiplier > 1 {
+		delay *= time.Duration(math.Pow(float64(sw.retryParams.RetryMultiplier), float64(attempt-1)))
+	}
+	return delay
 }
 
-func (sw *SocketClientV2) handleReconnect() {
+func (sw *SocketClientV2) isDisconnecting() bool {
 	sw.mutex.Lock()
 	defer sw.mutex.Unlock()
-	sw.disconnectFlag = true
-	sw.wsConn.Close()
+	return sw.disconnectFlag
+}
 
-	if sw.retryParams.CurrentAttempt < sw.retryParams.MaxRetryAttempt {
-		sw.retryParams.CurrentAttempt++
-		sw.logger.Warnf("Reconnecting (Attempt %d)...", sw.retryParams.CurrentAttempt)
-		time.Sleep(time.Duration(sw.retryParams.RetryDelay) * time.Second)
-		sw.Connect()
-	} else {
-		sw.logger.Warn("Max retry attempts reached, closing connection.")
+// resubscribe sends every stored subscription on the current connection.
+func (sw *SocketClientV2) resubscribe() {
+	sw.mutex.Lock()
+	var requests []RequestData
+	for mode, exchanges := range sw.inputRequestMap {
+		request := RequestData{
+			CorrelationID: "resubscribe",
+			Action:        SUBSCRIBE_ACTION,
+			Params:        Params{Mode: mode},
+		}
+		for exchangeType, tokens := range exchanges {
+			if len(tokens) == 0 {
+				continue
+			}
+			request.Params.TokenList = append(request.Params.TokenList, TokenSet{
+				ExchangeType: exchangeType,
+				Tokens:       append([]string(nil), tokens...),
+			})
+		}
+		if len(request.Params.TokenList) > 0 {
+			requests = append(requests, request)
+		}
+	}
+	sw.mutex.Unlock()
+
+	for _, request := range requests {
+		data, err := json.Marshal(request)
+		if err != nil {
+			sw.logger.Errorf("Error marshaling subscribe request: %v", err)
+			continue
+		}
+		if err := sw.send(websocket.TextMessage, data); err != nil {
+			sw.logger.Errorf("Error resubscribing: %v", err)
+			sw.triggerError(err)
+			return
+		}
 	}
 }
 
@@ -257,11 +557,6 @@ func (s *SocketClientV2) triggerMessage(message []byte) {
 	}
 }
 
-func (s *SocketClientV2) handleClose(code int, reason string) error {
-	s.triggerClose(code, reason)
-	return nil
-}
-
 // OnConnect callback.
 func (s *SocketClientV2) OnConnect(f func()) {
 	s.callbacks.onConnect = f
@@ -277,7 +572,7 @@ func (s *SocketClientV2) OnClose(f func(code int, reason string)) {
 	s.callbacks.onClose = f
 }
 
-// OnMessage callback.
+// OnMessage callback. Messages are delivered one at a time, in the order received.
 func (s *SocketClientV2) OnMessage(f func(message []byte)) {
 	s.callbacks.onMessage = f
 }
@@ -292,10 +587,12 @@ func (s *SocketClientV2) OnNoReconnect(f func(attempt int)) {
 	s.callbacks.onNoReconnect = f
 }
 
-func (sw *SocketClientV2) Subscribe(correlationID string, mode int, tokenList []TokenSet) {
+// Subscribe subscribes the tokens in the given mode. When not connected the tokens
+// are stored and sent once the connection is established.
+func (sw *SocketClientV2) Subscribe(correlationID string, mode int, tokenList []TokenSet) error {
 	request := RequestData{
 		CorrelationID: correlationID,
-		Action:        1,
+		Action:        SUBSCRIBE_ACTION,
 		Params: Params{
 			Mode:      mode,
 			TokenList: tokenList,
@@ -304,7 +601,7 @@ func (sw *SocketClientV2) Subscribe(correlationID string, mode int, tokenList []
 	data, err := json.Marshal(request)
 	if err != nil {
 		sw.logger.Errorf("Error marshaling subscribe request: %v", err)
-		return
+		return err
 	}
 
 	sw.mutex.Lock()
@@ -313,18 +610,24 @@ func (sw *SocketClientV2) Subscribe(correlationID string, mode int, tokenList []
 	}
 
 	for _, token := range tokenList {
-		sw.inputRequestMap[mode][token.ExchangeType] = append(sw.inputRequestMap[mode][token.ExchangeType], token.Tokens...)
+		sw.inputRequestMap[mode][token.ExchangeType] = appendMissing(sw.inputRequestMap[mode][token.ExchangeType], token.Tokens)
 	}
+	sw.staleness.sync(sw.inputRequestMap)
+	sw.resubscribeFlag = true
+	connected := sw.conn != nil
 	sw.mutex.Unlock()
 
-	sw.wsConn.WriteMessage(websocket.TextMessage, data)
-	sw.resubscribeFlag = true
+	if !connected {
+		return nil
+	}
+	return sw.send(websocket.TextMessage, data)
 }
 
-func (sw *SocketClientV2) Unsubscribe(correlationID string, mode int, tokenList []TokenSet) {
+// Unsubscribe unsubscribes the tokens in the given mode.
+func (sw *SocketClientV2) Unsubscribe(correlationID string, mode int, tokenList []TokenSet) error {
 	request := RequestData{
 		CorrelationID: correlationID,
-		Action:        0,
+		Action:        UNSUBSCRIBE_ACTION,
 		Params: Params{
 			Mode:      mode,
 			TokenList: tokenList,
@@ -333,23 +636,86 @@ func (sw *SocketClientV2) Unsubscribe(correlationID string, mode int, tokenList
 	data, err := json.Marshal(request)
 	if err != nil {
 		sw.logger.Errorf("Error marshaling unsubscribe request: %v", err)
-		return
+		return err
 	}
 
 	sw.mutex.Lock()
-	sw.inputRequestMap[mode] = nil
+	for _, token := range tokenList {
+		if exchanges, exists := sw.inputRequestMap[mode]; exists {
+			exchanges[token.ExchangeType] = removeTokens(exchanges[token.ExchangeType], token.Tokens)
+		}
+	}
+	sw.staleness.sync(sw.inputRequestMap)
+	connected := sw.conn != nil
 	sw.mutex.Unlock()
 
-	sw.wsConn.WriteMessage(websocket.TextMessage, data)
-	sw.resubscribeFlag = true
+	if !connected {
+		return nil
+	}
+	return sw.send(websocket.TextMessage, data)
 }
 
+// CloseConnection sends a close frame and stops the client. When Serve is running it
+// waits for the server to acknowledge the close, up to closeGracePeriod.
+// A closed client can not be reused.
 func (sw *SocketClientV2) CloseConnection() {
 	sw.mutex.Lock()
-	defer sw.mutex.Unlock()
+	if sw.disconnectFlag {
+		sw.mutex.Unlock()
+		return
+	}
 	sw.resubscribeFlag = false
 	sw.disconnectFlag = true
-	if sw.wsConn != nil {
-		sw.wsConn.Close()
+	if sw.state != StateFailed {
+		sw.state = StateClosed
+	}
+	close(sw.stop)
+	c := sw.conn
+	sw.conn = nil
+	serving := sw.serving
+	sw.mutex.Unlock()
+	sw.recordState()
+
+	if c != nil {
+		err := sw.write(c, websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		if err == nil && serving {
+			select {
+			case <-c.readDone:
+			case <-time.After(closeGracePeriod):
+			}
+		}
+		c.shutdown()
+	}
+}
+
+// appendMissing appends the tokens not already present in list.
+func appendMissing(list []string, tokens []string) []string {
+	for _, token := range tokens {
+		found := false
+		for _, existing := range list {
+			if existing == token {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, token)
+		}
+	}
+	return list
+}
+
+// removeTokens returns list without the given tokens.
+func removeTokens(list []string, tokens []string) []string {
+	remove := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		remove[token] = true
+	}
+	kept := list[:0]
+	for _, token := range list {
+		if !remove[token] {
+			kept = append(kept, token)
+		}
 	}
+	return kept
 }
@@ -0,0 +1,488 @@
+package websocket
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/piyushpatil22/smartapigo/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer is a minimal SmartStream server recording the requests it receives.
+type testServer struct {
+	*httptest.Server
+	mutex          sync.Mutex
+	requests       []RequestData
+	connections    int
+	maxConnections int
+	ignorePings    bool
+	closeCodes     []int
+	onConnect      func(conn *websocket.Conn, write writeFunc, n int)
+}
+
+// writeFunc serializes the test server writes to a connection.
+type writeFunc func(messageType int, data []byte) error
+
+func newTestServer(t *testing.T, onConnect func(conn *websocket.Conn, write writeFunc, n int)) *testServer {
+	ts := &testServer{onConnect: onConnect}
+	upgrader := websocket.Upgrader{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-feed-token") != "feed" || r.Header.Get("Authorization") != "auth" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ts.mutex.Lock()
+		if ts.maxConnections > 0 && ts.connections >= ts.maxConnections {
+			ts.mutex.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ts.mutex.Unlock()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Error upgrading connection. %v", err)
+			return
+		}
+		defer conn.Close()
+
+		ts.mutex.Lock()
+		ts.connections++
+		n := ts.connections
+		ts.mutex.Unlock()
+
+		var writeMutex sync.Mutex
+		write := func(messageType int, data []byte) error {
+			writeMutex.Lock()
+			defer writeMutex.Unlock()
+			return conn.WriteMessage(messageType, data)
+		}
+
+		if ts.onConnect != nil {
+			go ts.onConnect(conn, write, n)
+		}
+
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				if closeErr, ok := err.(*websocket.CloseError); ok {
+					ts.mutex.Lock()
+					ts.closeCodes = append(ts.closeCodes, closeErr.Code)
+					ts.mutex.Unlock()
+				}
+				return
+			}
+			if string(message) == HEART_BEAT_MESSAGE {
+				if ts.ignorePings {
+					continue
+				}
+				write(websocket.TextMessage, []byte(HEART_BEAT_RESPONSE))
+				continue
+			}
+			var request RequestData
+			if err := json.Unmarshal(message, &request); err != nil {
+				t.Errorf("Invalid request %s. %v", message, err)
+				continue
+			}
+			ts.mutex.Lock()
+			ts.requests = append(ts.requests, request)
+			ts.mutex.Unlock()
+		}
+	}))
+	return ts
+}
+
+func (ts *testServer) requestCount() int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return len(ts.requests)
+}
+
+func (ts *testServer) connectionCount() int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.connections
+}
+
+func newTestClient(ts *testServer) *SocketClientV2 {
+	client := NewSocketConnV2("auth", "client", "key", "feed", RetryParams{MaxRetryAttempt: 3})
+	client.url = "ws" + strings.TrimPrefix(ts.URL, "http")
+	client.logger.SetLevel(logrus.FatalLevel)
+	return client
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSocketClientV2OrderedDelivery(t *testing.T) {
+	const count = 500
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		for i := 0; i < count; i++ {
+			packet := make([]byte, 8)
+			binary.LittleEndian.PutUint64(packet, uint64(i))
+			if err := write(websocket.BinaryMessage, packet); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	var (
+		mutex    sync.Mutex
+		received []uint64
+	)
+	client.OnMessage(func(message []byte) {
+		mutex.Lock()
+		received = append(received, binary.LittleEndian.Uint64(message))
+		mutex.Unlock()
+	})
+	client.Connect()
+
+	served := make(chan struct{})
+	go func() {
+		client.Serve()
+		close(served)
+	}()
+
+	waitFor(t, "ticks", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == count
+	})
+	for i, seq := range received {
+		if seq != uint64(i) {
+			t.Fatalf("Tick %d delivered out of order, got sequence %d", i, seq)
+		}
+	}
+
+	client.CloseConnection()
+	<-served
+}
+
+func TestSocketClientV2ConcurrentWrites(t *testing.T) {
+	ts := newTestServer(t, nil)
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	client.heartbeatInterval = time.Millisecond
+	client.Connect()
+	go client.Serve()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens := []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{string(rune('A' + i))}}}
+			if err := client.Subscribe("sub", LTP_MODE, tokens); err != nil {
+				t.Errorf("Error subscribing. %v", err)
+			}
+			if err := client.Unsubscribe("unsub", LTP_MODE, tokens); err != nil {
+				t.Errorf("Error unsubscribing. %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	waitFor(t, "requests", func() bool { return ts.requestCount() == 40 })
+	waitFor(t, "pong", func() bool { return !client.LastPongTimestamp().IsZero() })
+	client.CloseConnection()
+}
+
+func TestSocketClientV2Resubscribe(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		// Drop the first connection shortly after it is established.
+		if n == 1 {
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+		}
+	})
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	reconnects := make(chan int, 1)
+	client.OnReconnect(func(attempt int, delay time.Duration) {
+		reconnects <- attempt
+	})
+	if err := client.Subscribe("sub", QUOTE, []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"3045"}}}); err != nil {
+		t.Fatalf("Error subscribing. %v", err)
+	}
+	client.Connect()
+	go client.Serve()
+
+	if attempt := <-reconnects; attempt != 1 {
+		t.Errorf("Expected first reconnect attempt, got %d", attempt)
+	}
+	waitFor(t, "resubscribe", func() bool { return ts.connectionCount() == 2 && ts.requestCount() == 2 })
+
+	ts.mutex.Lock()
+	last := ts.requests[1]
+	ts.mutex.Unlock()
+	if last.Params.Mode != QUOTE || len(last.Params.TokenList) != 1 || last.Params.TokenList[0].Tokens[0] != "3045" {
+		t.Errorf("Unexpected resubscribe request %+v", last)
+	}
+	client.CloseConnection()
+}
+
+func TestSocketClientV2NoReconnect(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		conn.Close()
+	})
+	ts.maxConnections = 1
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	client.retryParams.MaxRetryAttempt = 1
+	gaveUp := make(chan int, 1)
+	client.OnNoReconnect(func(attempt int) {
+		gaveUp <- attempt
+	})
+	client.Connect()
+
+	served := make(chan struct{})
+	go func() {
+		client.Serve()
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after retries were exhausted")
+	}
+	if attempt := <-gaveUp; attempt != 1 {
+		t.Errorf("Expected to give up after 1 attempt, got %d", attempt)
+	}
+}
+
+// ltpPacket builds an LTP mode packet for the token.
+func ltpPacket(exchangeType int, token string, price int64) []byte {
+	packet := make([]byte, 51)
+	packet[0] = LTP_MODE
+	packet[1] = byte(exchangeType)
+	copy(packet[2:27], token)
+	binary.LittleEndian.PutUint64(packet[43:51], uint64(price))
+	return packet
+}
+
+func TestSocketClientV2PongWatchdog(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.ignorePings = true
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	client.heartbeatInterval = 10 * time.Millisecond
+	client.watchdogInterval = 10 * time.Millisecond
+	client.SetPongTimeout(50 * time.Millisecond)
+	timeouts := make(chan error, 10)
+	client.OnError(func(err error) {
+		if err == ErrPongTimeout {
+			timeouts <- err
+		}
+	})
+	client.Connect()
+	go client.Serve()
+
+	<-timeouts
+	waitFor(t, "reconnect", func() bool { return ts.connectionCount() >= 2 })
+	client.CloseConnection()
+}
+
+func TestSocketClientV2StaleToken(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := write(websocket.BinaryMessage, ltpPacket(NSE_CM, "3045", 59000)); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	client.watchdogInterval = 10 * time.Millisecond
+	client.SetStaleTokenTimeout(100 * time.Millisecond)
+	client.SetMarketHours(func(time.Time) bool { return true })
+	stale := make(chan StaleToken, 10)
+	client.OnStaleToken(func(token StaleToken) {
+		stale <- token
+	})
+	client.Subscribe("sub", LTP_MODE, []TokenSet{{ExchangeType: NSE_CM, Tokens: []string{"3045", "2885"}}})
+	client.Connect()
+	go client.Serve()
+
+	token := <-stale
+	if token.Token != "2885" || token.ExchangeType != NSE_CM {
+		t.Errorf("Expected 2885 to be stale, got %+v", token)
+	}
+	select {
+	case token := <-stale:
+		t.Errorf("Unexpected stale token %+v", token)
+	case <-time.After(200 * time.Millisecond):
+	}
+	client.CloseConnection()
+}
+
+func TestSocketClientV2RunAuthError(t *testing.T) {
+	ts := newTestServer(t, nil)
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	client.Feed_token = "invalid"
+	err := client.Run(context.Background())
+	if _, ok := err.(authError); !ok {
+		t.Errorf("Expected an auth error, got %v", err)
+	}
+	if client.State() != StateFailed {
+		t.Errorf("Expected state %v, got %v", StateFailed, client.State())
+	}
+}
+
+func TestSocketClientV2RunCancel(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		for i := 0; i < 100; i++ {
+			if err := write(websocket.BinaryMessage, ltpPacket(NSE_CM, "3045", int64(i))); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mutex sync.Mutex
+		ticks int
+	)
+	client.OnMessage(func(message []byte) {
+		mutex.Lock()
+		ticks++
+		mutex.Unlock()
+	})
+	client.OnConnect(func() {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+	})
+
+	if err := client.Run(ctx); err != nil {
+		t.Fatalf("Run returned error on cancel. %v", err)
+	}
+	if client.State() != StateClosed {
+		t.Errorf("Expected state %v, got %v", StateClosed, client.State())
+	}
+	mutex.Lock()
+	if ticks != 100 {
+		t.Errorf("Expected 100 ticks before shutdown, got %d", ticks)
+	}
+	mutex.Unlock()
+
+	waitFor(t, "close frame", func() bool {
+		ts.mutex.Lock()
+		defer ts.mutex.Unlock()
+		return len(ts.closeCodes) == 1 && ts.closeCodes[0] == websocket.CloseNormalClosure
+	})
+}
+
+func TestSocketClientV2Metrics(t *testing.T) {
+	ts := newTestServer(t, func(conn *websocket.Conn, write writeFunc, n int) {
+		write(websocket.BinaryMessage, []byte{LTP_MODE, NSE_CM})
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := write(websocket.BinaryMessage, ltpPacket(NSE_CM, "3045", 59000)); err != nil {
+				return
+			}
+		}
+	})
+	defer ts.Close()
+
+	registry := metrics.NewRegistry()
+	client := newTestClient(ts)
+	client.watchdogInterval = 10 * time.Millisecond
+	client.SetMetrics(registry)
+	client.Connect()
+	go client.Serve()
+
+	exported := func() string {
+		var buffer strings.Builder
+		registry.WriteTo(&buffer)
+		return buffer.String()
+	}
+	waitFor(t, "tick rate", func() bool {
+		return strings.Contains(exported(), MetricTicksPerSecond+`{mode="LTP"}`) && !strings.Contains(exported(), MetricTicksPerSecond+`{mode="LTP"} 0`)
+	})
+	output := exported()
+	for _, line := range []string{
+		MetricConnectionState + `{state="CONNECTED"} 1`,
+		MetricConnectionState + `{state="CONNECTING"} 0`,
+		MetricDecodeErrors + " 1",
+		MetricTicks + `{mode="LTP"} `,
+		MetricLastTickAge + " ",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in\n%s", line, output)
+		}
+	}
+
+	client.CloseConnection()
+	if output := exported(); !strings.Contains(output, MetricConnectionState+`{state="CLOSED"} 1`) {
+		t.Errorf("Expected the closed state in\n%s", output)
+	}
+}
+
+// stateMetrics reads the client state as each measurement is recorded.
+type stateMetrics struct {
+	*metrics.Registry
+	client *SocketClientV2
+}
+
+func (m stateMetrics) Set(name string, labels metrics.Labels, value float64) {
+	m.client.State()
+	m.Registry.Set(name, labels, value)
+}
+
+func TestSocketClientV2MetricsReentrant(t *testing.T) {
+	ts := newTestServer(t, nil)
+	defer ts.Close()
+
+	client := newTestClient(ts)
+	registry := metrics.NewRegistry()
+	client.SetMetrics(stateMetrics{Registry: registry, client: client})
+
+	// Metrics calling back into the client must not deadlock on a state change.
+	done := make(chan struct{})
+	go func() {
+		client.Connect()
+		client.CloseConnection()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out recording the connection state")
+	}
+
+	var buffer strings.Builder
+	registry.WriteTo(&buffer)
+	if !strings.Contains(buffer.String(), MetricConnectionState+`{state="CLOSED"} 1`) {
+		t.Errorf("Expected the closed state in\n%s", buffer.String())
+	}
+}
@@ -3,6 +3,7 @@ package websocket
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -33,6 +34,11 @@ type SocketClient struct {
 	scrips              string
 	feedToken           string
 	clientCode          string
+	pongTimeout         time.Duration
+	checkInterval       time.Duration
+	lastPong            time.Time
+	state               ConnectionState
+	mutex               sync.Mutex
 }
 
 // callbacks represents callbacks available in ticker.
@@ -75,6 +81,8 @@ func New(clientCode string, feedToken string, scrips string) *SocketClient {
 		reconnectMaxDelay:   defaultReconnectMaxDelay,
 		reconnectMaxRetries: defaultReconnectMaxAttempts,
 		connectTimeout:      defaultConnectTimeout,
+		pongTimeout:         defaultPongTimeout,
+		checkInterval:       connectionCheckInterval,
 		scrips:              scrips,
 	}
 
@@ -111,6 +119,15 @@ func (s *SocketClient) SetReconnectMaxDelay(val time.Duration) error {
 	return nil
 }
 
+// SetPongTimeout sets the window within which the server must respond, either
+// with data or a pong. When it elapses the connection is dropped and a reconnect is forced.
+// Zero disables the check, as does disabling auto reconnect.
+func (s *SocketClient) SetPongTimeout(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pongTimeout = timeout
+}
+
 // SetReconnectMaxRetries sets maximum reconnect attempts.
 func (s *SocketClient) SetReconnectMaxRetries(val int) {
 	s.reconnectMaxRetries = val
@@ -148,85 +165,73 @@ func (s *SocketClient) OnNoReconnect(f func(attempt int)) {
 
 // Serve starts the connection to ticker server. Since its blocking its recommended to use it in go routine.
 func (s *SocketClient) Serve() {
+	s.serve(context.Background(), false)
+}
 
+// serve runs the connect, read and reconnect loop until ctx is done, reconnects are
+// exhausted or the server rejects the feed token. With failFast an error on the very
+// first connection is returned instead of retried.
+func (s *SocketClient) serve(ctx context.Context, failFast bool) error {
+	connected := false
 	for {
+		if ctx.Err() != nil {
+			s.setState(StateClosed)
+			return nil
+		}
+
 		// If reconnect attempt exceeds max then close the loop
 		if s.reconnectAttempt > s.reconnectMaxRetries {
+			s.setState(StateFailed)
 			s.triggerNoReconnect(s.reconnectAttempt)
-			return
+			return ErrRetriesExhausted
 		}
 		// If its a reconnect then wait exponentially based on reconnect attempt
 		if s.reconnectAttempt > 0 {
+			s.setState(StateReconnecting)
 			nextDelay := time.Duration(math.Pow(2, float64(s.reconnectAttempt))) * time.Second
 			if nextDelay > s.reconnectMaxDelay {
 				nextDelay = s.reconnectMaxDelay
 			}
 
 			s.triggerReconnect(s.reconnectAttempt, nextDelay)
-
-			// Close the previous connection if exists
-			if s.Conn != nil {
-				s.Conn.Close()
+			select {
+			case <-ctx.Done():
+				s.setState(StateClosed)
+				return nil
+			case <-time.After(nextDelay):
 			}
+		} else {
+			s.setState(StateConnecting)
 		}
-		// create a dialer
-		d := websocket.DefaultDialer
-		d.HandshakeTimeout = s.connectTimeout
-		d.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		conn, _, err := d.Dial(s.url.String(), nil)
+
+		conn, err := s.dial()
 		if err != nil {
 			s.triggerError(err)
 			// If auto reconnect is enabled then try reconneting else return error
-			if s.autoReconnect {
+			if _, rejected := err.(authError); !rejected && s.autoReconnect && !(failFast && !connected) {
 				s.reconnectAttempt++
 				continue
 			}
-			return
+			s.setState(StateFailed)
+			return err
 		}
-
-		err = conn.WriteMessage(websocket.TextMessage, []byte(`{"task":"cn","channel":"","token":"`+s.feedToken+`","user": "`+s.clientCode+`","acctid":"`+s.clientCode+`"}`))
-		if err != nil {
-			s.triggerError(err)
-			return
-		}
-
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			s.triggerError(err)
-			return
-		}
-		sDec, _ := base64.StdEncoding.DecodeString(string(message))
-		val, err := readSegment(sDec)
-		var result []map[string]interface{}
-		err = json.Unmarshal(val, &result)
-		if err != nil {
-			s.triggerError(err)
-			return
-		}
-		if len(result) == 0 {
-			s.triggerError(fmt.Errorf("Invalid Message"))
-			return
-		}
-
-		if _, ok := result[0]["ak"]; !ok {
-			s.triggerError(fmt.Errorf("Invalid Message"))
-			return
-		}
-
-		if val, ok := result[0]["ak"]; ok {
-			if val == "nk" {
-				s.triggerError(fmt.Errorf("Invalid feed token or client code"))
-				return
-			}
-		}
-
-		// Close the connection when its done.
-		defer s.Conn.Close()
+		connected = true
 
 		// Assign the current connection to the instance.
+		s.mutex.Lock()
 		s.Conn = conn
+		s.state = StateConnected
+		s.mutex.Unlock()
+
+		// Set on close handler
+		conn.SetCloseHandler(s.handleClose)
+
+		// Any pong or message from the server counts as a sign of life.
+		s.markAlive()
+		conn.SetPongHandler(func(appData string) error {
+			s.markAlive()
+			return nil
+		})
 
 		// Trigger connect callback.
 		s.triggerConnect()
@@ -239,14 +244,15 @@ func (s *SocketClient) Serve() {
 		// Reset auto reconnect vars
 		s.reconnectAttempt = 0
 
-		// Set on close handler
-		s.Conn.SetCloseHandler(s.handleClose)
-
 		var wg sync.WaitGroup
 		Restart := make(chan bool, 1)
+		readDone := make(chan struct{})
 		// Receive ticker data in a go routine.
 		wg.Add(1)
-		go s.readMessage(&wg, Restart)
+		go func() {
+			s.readMessage(&wg, Restart)
+			close(readDone)
+		}()
 
 		// Run watcher to check last ping time and reconnect if required
 		if s.autoReconnect {
@@ -254,9 +260,89 @@ func (s *SocketClient) Serve() {
 			go s.checkConnection(&wg, Restart)
 		}
 
+		// Close gracefully once ctx is done, giving the server a chance to
+		// acknowledge the close frame.
+		stopped := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				if err := s.Close(); err == nil {
+					select {
+					case <-readDone:
+					case <-time.After(closeGracePeriod):
+					}
+				}
+				conn.Close()
+			case <-stopped:
+			}
+		}()
+
 		// Wait for go routines to finish before doing next reconnect
 		wg.Wait()
+		close(stopped)
+		conn.Close()
+
+		if ctx.Err() != nil {
+			s.setState(StateClosed)
+			return nil
+		}
+
+		// The connection dropped, the next iteration is a reconnect and resubscribes.
+		s.reconnectAttempt++
+	}
+}
+
+// dial connects to the ticker server and authenticates with the feed token.
+func (s *SocketClient) dial() (*websocket.Conn, error) {
+	// create a dialer
+	d := *websocket.DefaultDialer
+	d.HandshakeTimeout = s.connectTimeout
+	d.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	conn, resp, err := d.Dial(s.url.String(), nil)
+	if err != nil {
+		return nil, handshakeError(resp, err)
+	}
+
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`{"task":"cn","channel":"","token":"`+s.feedToken+`","user": "`+s.clientCode+`","acctid":"`+s.clientCode+`"}`))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sDec, _ := base64.StdEncoding.DecodeString(string(message))
+	val, err := readSegment(sDec)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var result []map[string]interface{}
+	err = json.Unmarshal(val, &result)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
+
+	if len(result) == 0 {
+		conn.Close()
+		return nil, authError{fmt.Errorf("Invalid Message")}
+	}
+
+	if val, ok := result[0]["ak"]; !ok || val == "nk" {
+		conn.Close()
+		if ok {
+			return nil, authError{fmt.Errorf("Invalid feed token or client code")}
+		}
+		return nil, authError{fmt.Errorf("Invalid Message")}
+	}
+
+	return conn, nil
 }
 
 func (s *SocketClient) handleClose(code int, reason string) error {
@@ -301,38 +387,66 @@ func (s *SocketClient) triggerMessage(message []map[string]interface{}) {
 	}
 }
 
-// Periodically check for last ping time and initiate reconnect if applicable.
+// Periodically ping the server and initiate reconnect if it stopped responding.
 func (s *SocketClient) checkConnection(wg *sync.WaitGroup, Restart chan bool) {
 	defer wg.Done()
-	switch {
-	case <-Restart:
-		return
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-Restart:
+			return
+		case now := <-ticker.C:
+			s.mutex.Lock()
+			timeout := s.pongTimeout
+			lastPong := s.lastPong
+			s.mutex.Unlock()
+
+			if timeout > 0 && now.Sub(lastPong) > timeout {
+				s.triggerError(ErrPongTimeout)
+				// Closing the connection makes readMessage return and Serve reconnect.
+				s.Conn.Close()
+				return
+			}
+			s.Conn.WriteControl(websocket.PingMessage, nil, now.Add(s.checkInterval))
+		}
 	}
 }
 
+func (s *SocketClient) markAlive() {
+	s.mutex.Lock()
+	s.lastPong = time.Now()
+	s.mutex.Unlock()
+}
+
 // readMessage reads the data in a loop.
 func (s *SocketClient) readMessage(wg *sync.WaitGroup, Restart chan bool) {
 	defer wg.Done()
 	for {
 		_, msg, err := s.Conn.ReadMessage()
 		if err != nil {
-			s.triggerError(fmt.Errorf("Error reading data: %v", err))
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				s.triggerError(fmt.Errorf("Error reading data: %v", err))
+			}
 			Restart <- true
 			return
 		}
 
+		s.markAlive()
+
 		sDec, _ := base64.StdEncoding.DecodeString(string(msg))
 		val, err := readSegment(sDec)
 		if err != nil {
 			s.triggerError(err)
-			return
+			continue
 		}
 
 		var finalMessage []map[string]interface{}
 		err = json.Unmarshal(val, &finalMessage)
 		if err != nil {
 			s.triggerError(err)
-			return
+			continue
 		}
 
 		if len(finalMessage) == 0 {
@@ -352,9 +466,15 @@ func (s *SocketClient) readMessage(wg *sync.WaitGroup, Restart chan bool) {
 	}
 }
 
-// Close tries to close the connection gracefully. If the server doesn't close it
+// Close tries to close the connection gracefully by sending a close frame.
 func (s *SocketClient) Close() error {
-	return s.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.mutex.Lock()
+	conn := s.Conn
+	s.mutex.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
 }
 
 // Subscribe subscribes tick for the given list of tokens.
@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// segment encodes a message the way the V1 ticker server does.
+func segment(message string) []byte {
+	var b bytes.Buffer
+	z := zlib.NewWriter(&b)
+	z.Write([]byte(message))
+	z.Close()
+	return []byte(base64.StdEncoding.EncodeToString(b.Bytes()))
+}
+
+func TestSocketClientPongTimeout(t *testing.T) {
+	var mutex sync.Mutex
+	var connections int
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Error upgrading connection. %v", err)
+			return
+		}
+		defer conn.Close()
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, segment(`[{"ak":"ok"}]`)); err != nil {
+			return
+		}
+		mutex.Lock()
+		connections++
+		mutex.Unlock()
+
+		// Never answer a ping so the connection goes quiet.
+		conn.SetPingHandler(func(string) error { return nil })
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client := New("client", "feed", "nse_cm|3045")
+	client.SetRootURL(url.URL{Scheme: "ws", Host: strings.TrimPrefix(server.URL, "http://")})
+	client.reconnectMaxDelay = 10 * time.Millisecond
+	client.checkInterval = 10 * time.Millisecond
+	client.SetPongTimeout(50 * time.Millisecond)
+	timeouts := make(chan error, 10)
+	client.OnError(func(err error) {
+		if err == ErrPongTimeout {
+			timeouts <- err
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+
+	select {
+	case <-timeouts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the pong timeout")
+	}
+	waitFor(t, "reconnect", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return connections >= 2
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Run to return nil, got %v", err)
+	}
+	if client.State() != StateClosed {
+		t.Errorf("Expected the client to be closed, got %v", client.State())
+	}
+}